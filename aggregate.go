@@ -0,0 +1,54 @@
+package tcpconn
+
+import "sort"
+
+// NamedSnapshot - снимок статистики с именем источника, например адресом соединения
+type NamedSnapshot struct {
+	Name     string
+	Snapshot Snapshot
+}
+
+// Ranking возвращает показатель, по которому источник считается хуже: чем больше, тем хуже
+type Ranking func(Snapshot) float64
+
+// ByLossRate ранжирует по доле потерянных пакетов
+func ByLossRate(snap Snapshot) float64 {
+	return snap.PacketLossRate
+}
+
+// ByP99Latency ранжирует по 99-му перцентилю задержки
+func ByP99Latency(snap Snapshot) float64 {
+	return float64(snap.P99LatencyUs)
+}
+
+// ByMaxLatency ранжирует по максимальной задержке
+func ByMaxLatency(snap Snapshot) float64 {
+	return float64(snap.MaxLatencyUs)
+}
+
+// ByRetransmits ранжирует по числу повторных отправок
+func ByRetransmits(snap Snapshot) float64 {
+	return float64(snap.PacketsRetried)
+}
+
+// TopN возвращает не более n худших источников по ranking, от худшего к лучшему.
+// При равенстве порядок определяется именем. Исходный срез не изменяется.
+func TopN(snaps []NamedSnapshot, n int, ranking Ranking) []NamedSnapshot {
+	if n <= 0 || len(snaps) == 0 {
+		return nil
+	}
+
+	sorted := append([]NamedSnapshot(nil), snaps...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := ranking(sorted[i].Snapshot), ranking(sorted[j].Snapshot)
+		if ri != rj {
+			return ri > rj
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	if n > len(sorted) {
+		n = len(sorted)
+	}
+	return sorted[:n]
+}
@@ -0,0 +1,85 @@
+package tcpconn
+
+import (
+	"testing"
+)
+
+func TestStatistics_NewChild(t *testing.T) {
+	root := NewStatisticsWithWindows(0, 0) // окна округляются до секунды
+	pool := root.NewChild()
+	a, b := pool.NewChild(), pool.NewChild()
+
+	if a.Parent() != pool || pool.Parent() != root || root.Parent() != nil {
+		t.Fatal("Parent() does not reflect the hierarchy")
+	}
+	if len(a.GetRateWindows()) != 2 {
+		t.Errorf("child windows = %v, want the parent's", a.GetRateWindows())
+	}
+
+	a.RecordPacketSent(100)
+	a.RecordPacketLost()
+	a.RecordLatency(1000)
+	b.RecordPacketSent(200)
+	b.RecordPacketReceived(50)
+	b.RecordError()
+	b.RecordTimeout()
+	b.RecordReset()
+	b.RecordPacketRetried()
+	b.RecordLatency(10)
+
+	if a.GetPacketsSent() != 1 || b.GetPacketsSent() != 1 {
+		t.Errorf("children sent = %d/%d, want 1/1", a.GetPacketsSent(), b.GetPacketsSent())
+	}
+
+	for name, s := range map[string]*Statistics{"pool": pool, "root": root} {
+		snap := s.GetSnapshot()
+		if snap.PacketsSent != 2 || snap.BytesSent != 300 || snap.PacketsReceived != 1 || snap.PacketsLost != 1 ||
+			snap.PacketsRetried != 1 || snap.Errors != 1 || snap.Timeouts != 1 || snap.Resets != 1 {
+			t.Errorf("%s totals = %+v", name, snap)
+		}
+		if snap.LatencyCount != 2 || snap.MinLatencyUs != 10 || snap.MaxLatencyUs != 1000 {
+			t.Errorf("%s latency count/min/max = %d/%d/%d, want 2/10/1000", name, snap.LatencyCount, snap.MinLatencyUs, snap.MaxLatencyUs)
+		}
+		if snap.SendRateBytesPerSec <= 0 {
+			t.Errorf("%s send rate = %.2f, want > 0", name, snap.SendRateBytesPerSec)
+		}
+	}
+
+	a.Reset()
+	if pool.GetPacketsSent() != 2 {
+		t.Errorf("child Reset changed parent: sent = %d, want 2", pool.GetPacketsSent())
+	}
+}
+
+func TestTopN(t *testing.T) {
+	snaps := []NamedSnapshot{
+		{Name: "a", Snapshot: Snapshot{PacketLossRate: 1, P99LatencyUs: 900}},
+		{Name: "b", Snapshot: Snapshot{PacketLossRate: 5, P99LatencyUs: 100}},
+		{Name: "c", Snapshot: Snapshot{PacketLossRate: 5, P99LatencyUs: 300, PacketsRetried: 7}},
+		{Name: "d", Snapshot: Snapshot{PacketLossRate: 0, P99LatencyUs: 200}},
+	}
+
+	names := func(snaps []NamedSnapshot) string {
+		var s string
+		for _, n := range snaps {
+			s += n.Name
+		}
+		return s
+	}
+
+	if got := names(TopN(snaps, 3, ByLossRate)); got != "bca" {
+		t.Errorf("TopN(ByLossRate) = %s, want bca", got)
+	}
+	if got := names(TopN(snaps, 2, ByP99Latency)); got != "ac" {
+		t.Errorf("TopN(ByP99Latency) = %s, want ac", got)
+	}
+	if got := names(TopN(snaps, 10, ByRetransmits)); got != "cabd" {
+		t.Errorf("TopN(ByRetransmits) = %s, want cabd", got)
+	}
+	if got := TopN(snaps, 0, ByLossRate); got != nil {
+		t.Errorf("TopN(0) = %v, want nil", got)
+	}
+	if snaps[0].Name != "a" {
+		t.Error("TopN modified its input")
+	}
+}
@@ -0,0 +1,281 @@
+package tcpconn
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrInvalidAlertRule возвращается при запуске оповещений с некорректным правилом
+var ErrInvalidAlertRule = errors.New("invalid alert rule")
+
+// AlertMetric вычисляет значение, которое сравнивается с порогом, по изменению
+// статистики за окно правила
+type AlertMetric func(Delta) float64
+
+// AlertLossRate - доля потерянных пакетов за окно в процентах
+func AlertLossRate(d Delta) float64 { return d.PacketLossRate }
+
+// AlertP99Latency - 99-й перцентиль задержки за окно в микросекундах
+func AlertP99Latency(d Delta) float64 { return float64(d.P99LatencyUs) }
+
+// AlertErrors - число ошибок за окно
+func AlertErrors(d Delta) float64 { return float64(d.Errors) }
+
+// AlertResets - число сбросов соединения за окно
+func AlertResets(d Delta) float64 { return float64(d.Resets) }
+
+// AlertTimeouts - число таймаутов за окно
+func AlertTimeouts(d Delta) float64 { return float64(d.Timeouts) }
+
+// AlertRetransmitRate - повторные отправки в секунду за окно
+func AlertRetransmitRate(d Delta) float64 { return d.RetriedPacketsPerSec }
+
+// AlertRule - условие оповещения. Оповещение срабатывает, когда значение
+// метрики за окно превышает Above, и снимается, когда опускается до Clear
+// или ниже. Зазор между Above и Clear предотвращает дребезг.
+type AlertRule struct {
+	Name   string
+	Metric AlertMetric
+	// Window - окно, за которое считается изменение статистики;
+	// не короче интервала проверки, иначе в окне нет второго снимка
+	Window time.Duration
+	// Above - порог срабатывания, значение должно быть строго больше
+	Above float64
+	// Clear - порог снятия, не больше Above; ноль означает Above
+	Clear float64
+	// MinPackets - минимум отправленных за окно пакетов, при котором правило
+	// проверяется; защищает долю потерь от выводов по единичным пакетам
+	MinPackets uint64
+}
+
+func (r AlertRule) clearThreshold() float64 {
+	if r.Clear == 0 {
+		return r.Above
+	}
+	return r.Clear
+}
+
+// Validate проверяет правило: имя, метрику, окно и порядок порогов
+func (r AlertRule) Validate() error {
+	switch {
+	case r.Name == "":
+		return fmt.Errorf("%w: empty name", ErrInvalidAlertRule)
+	case r.Metric == nil:
+		return fmt.Errorf("%w: %s has no metric", ErrInvalidAlertRule, r.Name)
+	case r.Window <= 0:
+		return fmt.Errorf("%w: %s has non-positive window", ErrInvalidAlertRule, r.Name)
+	case r.clearThreshold() > r.Above:
+		return fmt.Errorf("%w: %s clear threshold above firing threshold", ErrInvalidAlertRule, r.Name)
+	}
+	return nil
+}
+
+// ValidateInterval проверяет правило, как Validate, и что его окно
+// не короче интервала проверки interval
+func (r AlertRule) ValidateInterval(interval time.Duration) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if r.Window < interval {
+		return fmt.Errorf("%w: %s window %v is shorter than interval %v", ErrInvalidAlertRule, r.Name, r.Window, interval)
+	}
+	return nil
+}
+
+// AlertEvent сообщает о срабатывании (Firing) или снятии оповещения
+type AlertEvent struct {
+	Rule      string
+	Firing    bool
+	Value     float64
+	Threshold float64
+	Time      time.Time
+	Delta     Delta
+}
+
+// String возвращает однострочное описание события
+func (e AlertEvent) String() string {
+	status := "resolved"
+	if e.Firing {
+		status = "firing"
+	}
+	return fmt.Sprintf("alert %s %s: value=%g threshold=%g over %v",
+		e.Rule, status, e.Value, e.Threshold, e.Delta.Interval.Round(time.Millisecond))
+}
+
+// alertState - правило и его текущее состояние
+type alertState struct {
+	rule   AlertRule
+	firing bool
+}
+
+// Alerter периодически проверяет правила по статистике и сообщает об изменениях
+// их состояния обработчикам и подписчикам. События доставляются из горутины
+// Alerter по одному, в порядке возникновения.
+type Alerter struct {
+	stats    *Statistics
+	recorder *Recorder
+
+	mu          sync.Mutex
+	states      []alertState
+	handlers    []func(AlertEvent)
+	subscribers []chan AlertEvent
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// StartAlerter запускает проверку правил каждые interval. Для расчёта
+// изменений хранится столько снимков, сколько покрывает самое длинное окно.
+// Правило с окном короче interval отклоняется: оно никогда бы не сработало.
+func (s *Statistics) StartAlerter(interval time.Duration, rules ...AlertRule) (*Alerter, error) {
+	if interval <= 0 {
+		return nil, ErrInvalidInterval
+	}
+
+	var maxWindow time.Duration
+	states := make([]alertState, len(rules))
+	for i, r := range rules {
+		if err := r.ValidateInterval(interval); err != nil {
+			return nil, err
+		}
+		maxWindow = max(maxWindow, r.Window)
+		states[i].rule = r
+	}
+
+	a := &Alerter{
+		stats:    s,
+		recorder: newRecorder(s, interval, int(maxWindow/interval)+1),
+		states:   states,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	a.recorder.record(s.GetSnapshot())
+
+	go a.run(interval)
+	return a, nil
+}
+
+func (a *Alerter) run(interval time.Duration) {
+	defer close(a.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.Evaluate()
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// OnAlert регистрирует обработчик событий. Обработчик вызывается из горутины
+// Alerter и не должен вызывать Stop.
+func (a *Alerter) OnAlert(fn func(AlertEvent)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handlers = append(a.handlers, fn)
+}
+
+// Subscribe возвращает канал событий с буфером buffer. Если подписчик не
+// успевает читать, события для него отбрасываются, а не блокируют проверку.
+// Канал закрывается при Stop.
+func (a *Alerter) Subscribe(buffer int) <-chan AlertEvent {
+	ch := make(chan AlertEvent, buffer)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.stop:
+		close(ch)
+	default:
+		a.subscribers = append(a.subscribers, ch)
+	}
+	return ch
+}
+
+// Evaluate снимает статистику и проверяет правила немедленно, не дожидаясь тика
+func (a *Alerter) Evaluate() {
+	now := time.Now()
+	a.recorder.record(a.stats.GetSnapshot())
+
+	var events []AlertEvent
+	a.mu.Lock()
+	for i := range a.states {
+		st := &a.states[i]
+		// Тик может опоздать: снимок ровно на границе окна
+		// не должен выпадать из него
+		d, ok := a.recorder.DeltaOver(st.rule.Window + a.recorder.Interval()/2)
+		if !ok || d.PacketsSent < st.rule.MinPackets {
+			continue
+		}
+
+		value := st.rule.Metric(d)
+		switch {
+		case !st.firing && value > st.rule.Above:
+			st.firing = true
+			events = append(events, AlertEvent{Rule: st.rule.Name, Firing: true, Value: value, Threshold: st.rule.Above, Time: now, Delta: d})
+		case st.firing && value <= st.rule.clearThreshold():
+			st.firing = false
+			events = append(events, AlertEvent{Rule: st.rule.Name, Firing: false, Value: value, Threshold: st.rule.clearThreshold(), Time: now, Delta: d})
+		}
+	}
+	handlers := slices.Clone(a.handlers)
+	a.mu.Unlock()
+
+	for _, ev := range events {
+		for _, fn := range handlers {
+			fn(ev)
+		}
+		a.publish(ev)
+	}
+}
+
+// publish рассылает событие подписчикам без блокировки
+func (a *Alerter) publish(ev AlertEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, ch := range a.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Firing возвращает имена сработавших правил
+func (a *Alerter) Firing() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var names []string
+	for _, st := range a.states {
+		if st.firing {
+			names = append(names, st.rule.Name)
+		}
+	}
+	return names
+}
+
+// Stop останавливает проверку и закрывает каналы подписчиков.
+// Повторные вызовы безопасны.
+func (a *Alerter) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stop)
+		<-a.done
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		for _, ch := range a.subscribers {
+			close(ch)
+		}
+		a.subscribers = nil
+	})
+	<-a.done
+}
@@ -0,0 +1,158 @@
+package tcpconn
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertRule_Validate(t *testing.T) {
+	valid := AlertRule{Name: "loss", Metric: AlertLossRate, Window: time.Minute, Above: 5, Clear: 1}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+
+	for name, r := range map[string]AlertRule{
+		"no name":      {Metric: AlertLossRate, Window: time.Minute},
+		"no metric":    {Name: "x", Window: time.Minute},
+		"no window":    {Name: "x", Metric: AlertLossRate},
+		"clear > fire": {Name: "x", Metric: AlertLossRate, Window: time.Minute, Above: 1, Clear: 5},
+	} {
+		if err := r.Validate(); !errors.Is(err, ErrInvalidAlertRule) {
+			t.Errorf("%s: Validate() = %v, want ErrInvalidAlertRule", name, err)
+		}
+		if _, err := NewStatistics().StartAlerter(time.Second, r); !errors.Is(err, ErrInvalidAlertRule) {
+			t.Errorf("%s: StartAlerter() = %v, want ErrInvalidAlertRule", name, err)
+		}
+	}
+
+	// Окно короче интервала не содержит второго снимка и не сработало бы
+	if _, err := NewStatistics().StartAlerter(2*time.Minute, valid); !errors.Is(err, ErrInvalidAlertRule) {
+		t.Errorf("StartAlerter(window < interval) = %v, want ErrInvalidAlertRule", err)
+	}
+	a, err := NewStatistics().StartAlerter(time.Minute, valid)
+	if err != nil {
+		t.Errorf("StartAlerter(window == interval) = %v, want nil", err)
+	} else {
+		a.Stop()
+	}
+}
+
+func TestAlerter_Hysteresis(t *testing.T) {
+	stats := NewStatistics()
+
+	// Интервал и окно в час: проверки выполняются только явным Evaluate,
+	// и каждое изменение считается от предыдущей проверки
+	a, err := stats.StartAlerter(time.Hour, AlertRule{
+		Name:       "loss",
+		Metric:     AlertLossRate,
+		Window:     time.Hour,
+		Above:      10,
+		Clear:      2,
+		MinPackets: 10,
+	})
+	if err != nil {
+		t.Fatalf("StartAlerter failed: %v", err)
+	}
+	defer a.Stop()
+
+	var events []AlertEvent
+	a.OnAlert(func(ev AlertEvent) { events = append(events, ev) })
+
+	step := func(sent, lost int) {
+		for i := 0; i < sent; i++ {
+			stats.RecordPacketSent(100)
+		}
+		for i := 0; i < lost; i++ {
+			stats.RecordPacketLost()
+		}
+		a.Evaluate()
+	}
+
+	step(100, 20) // 20% - срабатывание
+	if len(events) != 1 || !events[0].Firing || events[0].Value != 20 {
+		t.Fatalf("events = %v, want one firing event with value 20", events)
+	}
+	if got := a.Firing(); len(got) != 1 || got[0] != "loss" {
+		t.Errorf("Firing() = %v, want [loss]", got)
+	}
+
+	step(100, 5) // 5% - между порогами, состояние не меняется
+	if len(events) != 1 {
+		t.Fatalf("events = %v, want no new event inside hysteresis band", events)
+	}
+
+	step(100, 1) // 1% - снятие
+	if len(events) != 2 || events[1].Firing || events[1].Threshold != 2 {
+		t.Fatalf("events = %v, want resolved event with threshold 2", events)
+	}
+
+	step(5, 5) // слишком мало пакетов для вывода
+	if len(events) != 2 || len(a.Firing()) != 0 {
+		t.Errorf("events = %v, want rule skipped below MinPackets", events)
+	}
+
+	if !strings.Contains(events[0].String(), "alert loss firing") {
+		t.Errorf("String() = %q", events[0].String())
+	}
+}
+
+func TestAlerter_SubscribePeriodic(t *testing.T) {
+	stats := NewStatistics()
+	a, err := stats.StartAlerter(5*time.Millisecond, AlertRule{
+		Name:   "errors",
+		Metric: AlertErrors,
+		Window: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("StartAlerter failed: %v", err)
+	}
+
+	events := a.Subscribe(4)
+	stats.RecordError()
+
+	select {
+	case ev := <-events:
+		if ev.Rule != "errors" || !ev.Firing || ev.Value < 1 {
+			t.Errorf("event = %+v, want errors firing", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no alert event")
+	}
+
+	a.Stop()
+	a.Stop()
+	for range events {
+	}
+
+	if _, ok := <-a.Subscribe(1); ok {
+		t.Error("Subscribe after Stop returned an open channel")
+	}
+}
+
+func TestAlerter_WindowEqualsInterval(t *testing.T) {
+	stats := NewStatistics()
+	a, err := stats.StartAlerter(20*time.Millisecond, AlertRule{
+		Name:   "errors",
+		Metric: AlertErrors,
+		Window: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("StartAlerter failed: %v", err)
+	}
+	defer a.Stop()
+
+	// Снимок предыдущего тика попадает в окно, даже если тик опоздал
+	events := a.Subscribe(4)
+	stats.RecordError()
+
+	select {
+	case ev := <-events:
+		if !ev.Firing {
+			t.Errorf("event = %+v, want firing", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no alert event")
+	}
+}
@@ -0,0 +1,125 @@
+package tcpconn
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock - источник времени машины состояний и ее таймеров.
+// Подменяется в тестах на ManualClock.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc вызывает f в отдельной горутине (или, для ManualClock,
+	// внутри Advance) через d
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer - взведенный таймер Clock
+type Timer interface {
+	// Stop отменяет таймер; false, если он уже сработал или остановлен
+	Stop() bool
+}
+
+// SystemClock возвращает часы на основе пакета time
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// ManualClock - часы, которые идут только при вызове Advance.
+// Таймеры срабатывают синхронно внутри Advance в порядке сроков,
+// поэтому тесты таймаутов детерминированы и не требуют sleep.
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    int
+	timers []*manualTimer
+}
+
+// manualTimer - таймер ManualClock
+type manualTimer struct {
+	clock *ManualClock
+	when  time.Time
+	seq   int // порядок взведения для таймеров с одинаковым сроком
+	f     func()
+}
+
+// NewManualClock создает часы, показывающие start
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+// Now возвращает текущее время часов
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc взводит таймер на d от текущего времени часов
+func (c *ManualClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &manualTimer{clock: c, when: c.now.Add(d), seq: c.seq, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance переводит часы на d, по очереди вызывая все таймеры со сроком
+// не позже нового времени. Таймеры, взведенные при этом, тоже учитываются.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		sort.Slice(c.timers, func(i, j int) bool {
+			a, b := c.timers[i], c.timers[j]
+			if !a.when.Equal(b.when) {
+				return a.when.Before(b.when)
+			}
+			return a.seq < b.seq
+		})
+		if len(c.timers) == 0 || c.timers[0].when.After(target) {
+			break
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = target
+	c.mu.Unlock()
+}
+
+// Pending возвращает число взведенных таймеров
+func (c *ManualClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// Stop отменяет таймер
+func (t *manualTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+// Command tcpgraph renders TCP state machine diagrams for docs and incident reports.
+//
+//	tcpgraph [-format dot|mermaid] [-machine rfc9293]
+//	tcpgraph -url http://host:6060/debug/tcpv2 -conn 10.0.0.2:51234 [-format dot|mermaid]
+//	tcpgraph -pcap trace.pcap [-local 10.0.0.1:9000] [-format dot|mermaid]
+//
+// Without -url or -pcap it prints the transition graph of the machine. With
+// -url it fetches a live connection's history from tcpv2.Listener.DebugHandler,
+// with -pcap it replays the tcpv2 segments of one connection from a capture.
+// A history is printed as a highlighted path (dot) or a sequence diagram (mermaid).
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"tcpconn"
+)
+
+func main() {
+	format := flag.String("format", "dot", "output format: dot or mermaid")
+	machine := flag.String("machine", tcpconn.DefaultMachine, "registered state machine to render")
+	debugURL := flag.String("url", "", "tcpv2 debug handler URL of a live listener")
+	conn := flag.String("conn", "", "remote address of the connection to fetch with -url")
+	pcapFile := flag.String("pcap", "", "pcap or pcapng capture to replay")
+	local := flag.String("local", "", "local endpoint ip:port for -pcap (default: first SYN sender)")
+	flag.Parse()
+
+	if *format != "dot" && *format != "mermaid" {
+		log.Fatalf("unknown format %q", *format)
+	}
+	table, ok := tcpconn.LookupMachine(*machine)
+	if !ok {
+		log.Fatalf("unknown machine %q, registered: %v", *machine, tcpconn.RegisteredMachines())
+	}
+
+	var history []tcpconn.StateTransition
+	switch {
+	case *debugURL != "":
+		if *conn == "" {
+			log.Fatal("-url requires -conn")
+		}
+		h, err := fetchHistory(table, *debugURL, *conn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		history = h
+	case *pcapFile != "":
+		h, err := replayPcap(table, *pcapFile, *local)
+		if err != nil {
+			log.Fatal(err)
+		}
+		history = h
+	default:
+		var err error
+		if *format == "dot" {
+			err = table.WriteDOT(os.Stdout)
+		} else {
+			err = table.WriteMermaid(os.Stdout)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var err error
+	if *format == "dot" {
+		err = table.WritePathDOT(os.Stdout, history)
+	} else {
+		err = table.WriteSequenceMermaid(os.Stdout, history)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// debugListener is the part of the debug handler's JSON that tcpgraph needs
+type debugListener struct {
+	Connections []struct {
+		History []struct {
+			From  string `json:"from"`
+			To    string `json:"to"`
+			Event string `json:"event"`
+		} `json:"history"`
+	} `json:"connections"`
+}
+
+// fetchHistory loads a connection's transition history from a debug handler
+func fetchHistory(table *tcpconn.TransitionTable, base, remote string) ([]tcpconn.StateTransition, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("format", "json")
+	q.Set("conn", remote)
+	u.RawQuery = q.Encode()
+
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+
+	var doc debugListener
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", u, err)
+	}
+	if len(doc.Connections) != 1 {
+		return nil, fmt.Errorf("%s: expected one connection, got %d", u, len(doc.Connections))
+	}
+	dc := doc.Connections[0]
+
+	states := make(map[string]tcpconn.TCPState)
+	for _, s := range table.States() {
+		states[table.StateName(s)] = s
+	}
+	events := make(map[string]tcpconn.TCPEvent)
+	for _, e := range table.Events() {
+		events[table.EventName(e)] = e
+	}
+
+	history := make([]tcpconn.StateTransition, 0, len(dc.History))
+	for _, tr := range dc.History {
+		from, okFrom := states[tr.From]
+		to, okTo := states[tr.To]
+		event, okEvent := events[tr.Event]
+		if !okFrom || !okTo || !okEvent {
+			return nil, fmt.Errorf("unknown transition %s -> %s on %s", tr.From, tr.To, tr.Event)
+		}
+		history = append(history, tcpconn.StateTransition{FromState: from, ToState: to, Event: event})
+	}
+	return history, nil
+}
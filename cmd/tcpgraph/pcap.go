@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"tcpconn"
+	"tcpconn/pkg/tcpv2"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// pcapngMagic is the block type of a pcapng Section Header Block
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// packetSource yields raw frames from a pcap or pcapng file
+type packetSource interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+}
+
+// replayPcap replays one tcpv2 connection from a capture through a state
+// machine built from table and returns the resulting history. local selects
+// the endpoint whose view is replayed; empty means the sender of the first SYN.
+func replayPcap(table *tcpconn.TransitionTable, path, local string) ([]tcpconn.StateTransition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var src packetSource
+	var link layers.LinkType
+	if bytes.Equal(magic, pcapngMagic) {
+		r, err := pcapgo.NewNgReader(br, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		src, link = r, r.LinkType()
+	} else {
+		r, err := pcapgo.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		src, link = r, r.LinkType()
+	}
+
+	rp := &replayer{local: local, sm: tcpconn.NewTCPStateMachineFromTable(table)}
+	for {
+		data, _, err := src.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		rp.frame(gopacket.NewPacket(data, link, gopacket.DecodeStreamsAsDatagrams))
+	}
+
+	if rp.peer == "" {
+		return nil, fmt.Errorf("%s: no tcpv2 connection found", path)
+	}
+	return rp.sm.GetHistory(), nil
+}
+
+// replayer maps the segments of one connection to state machine events,
+// the same way tcpv2.Conn.HandlePacket does for a live connection
+type replayer struct {
+	local, peer string
+	sm          *tcpconn.TCPStateMachine
+	finSent     bool
+	finEnd      uint32 // sequence number acknowledging the local FIN
+}
+
+// frame decodes a captured frame and feeds its tcpv2 segment to the machine
+func (r *replayer) frame(pkt gopacket.Packet) {
+	var srcIP, dstIP net.IP
+	switch ip := pkt.NetworkLayer().(type) {
+	case *layers.IPv4:
+		srcIP, dstIP = ip.SrcIP, ip.DstIP
+	case *layers.IPv6:
+		srcIP, dstIP = ip.SrcIP, ip.DstIP
+	default:
+		return
+	}
+	udp, ok := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if !ok {
+		return
+	}
+	seg, err := tcpv2.DecodePacketFrom(udp.Payload, srcIP, dstIP)
+	if err != nil {
+		return
+	}
+
+	src := (&net.UDPAddr{IP: srcIP, Port: int(udp.SrcPort)}).String()
+	dst := (&net.UDPAddr{IP: dstIP, Port: int(udp.DstPort)}).String()
+	if r.local == "" {
+		if !seg.TCP.SYN || seg.TCP.ACK {
+			return
+		}
+		r.local = src
+	}
+	if r.peer == "" {
+		switch r.local {
+		case src:
+			r.peer = dst
+		case dst:
+			r.peer = src
+		default:
+			return
+		}
+	}
+
+	switch {
+	case src == r.local && dst == r.peer:
+		r.sent(seg)
+	case src == r.peer && dst == r.local:
+		r.received(seg)
+	}
+}
+
+// sent handles a segment sent by the local endpoint
+func (r *replayer) sent(p *tcpv2.Packet) {
+	tcp := p.TCP
+	switch {
+	case tcp.RST:
+		r.sm.ProcessEvent(tcpconn.RST)
+	case tcp.SYN && !tcp.ACK:
+		if r.sm.GetState() == tcpconn.LISTEN {
+			r.sm.ProcessEvent(tcpconn.SEND)
+		} else {
+			r.sm.ProcessEvent(tcpconn.ACTIVE_OPEN)
+		}
+	case tcp.FIN && !r.finSent:
+		r.finSent = true
+		r.finEnd = tcp.Seq + uint32(len(p.Payload)) + 1
+		r.sm.ProcessEvent(tcpconn.CLOSE)
+	}
+}
+
+// received handles a segment sent by the peer
+func (r *replayer) received(p *tcpv2.Packet) {
+	tcp := p.TCP
+	state := r.sm.GetState()
+	// sequence numbers compare modulo 2^32, so a wrapped ACK still counts
+	ackedFin := r.finSent && tcp.ACK && int32(tcp.Ack-r.finEnd) >= 0
+
+	switch {
+	case tcp.RST:
+		r.sm.ProcessEvent(tcpconn.RST)
+	case tcp.SYN && tcp.ACK:
+		r.sm.ProcessEvent(tcpconn.SYN_ACK)
+	case tcp.SYN:
+		if state == tcpconn.CLOSED {
+			r.sm.ProcessEvent(tcpconn.PASSIVE_OPEN)
+		}
+		r.sm.ProcessEvent(tcpconn.SYN)
+	case tcp.FIN && ackedFin && state == tcpconn.FIN_WAIT_1:
+		r.sm.ProcessEvent(tcpconn.FIN_ACK)
+	case tcp.FIN:
+		if state == tcpconn.SYN_RECEIVED && tcp.ACK {
+			r.sm.ProcessEvent(tcpconn.ACK)
+		}
+		r.sm.ProcessEvent(tcpconn.FIN)
+	case tcp.ACK:
+		switch {
+		case state == tcpconn.SYN_RECEIVED:
+			r.sm.ProcessEvent(tcpconn.ACK)
+		case ackedFin && (state == tcpconn.FIN_WAIT_1 || state == tcpconn.CLOSING || state == tcpconn.LAST_ACK):
+			r.sm.ProcessEvent(tcpconn.ACK)
+		}
+	}
+}
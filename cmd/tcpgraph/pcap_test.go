@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tcpconn"
+	"tcpconn/pkg/tcpv2"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// segment is one tcpv2 segment of a synthetic capture
+type segment struct {
+	fromLocal bool
+	pkt       *tcpv2.Packet
+}
+
+// writeCapture writes segments between local and peer as Ethernet/IPv4/UDP
+// frames to a pcap file and returns its path
+func writeCapture(t *testing.T, local, peer *net.UDPAddr, segs []segment) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "trace.pcap")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, s := range segs {
+		src, dst := local, peer
+		if !s.fromLocal {
+			src, dst = peer, local
+		}
+		payload, err := s.pkt.Encode(src.IP, dst.IP)
+		if err != nil {
+			t.Fatalf("segment %d: %v", i, err)
+		}
+
+		eth := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+			DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: src.IP, DstIP: dst.IP}
+		udp := &layers.UDP{SrcPort: layers.UDPPort(src.Port), DstPort: layers.UDPPort(dst.Port)}
+		udp.SetNetworkLayerForChecksum(ip)
+
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload(payload)); err != nil {
+			t.Fatalf("segment %d: %v", i, err)
+		}
+		data := buf.Bytes()
+		ci := gopacket.CaptureInfo{Timestamp: ts.Add(time.Duration(i) * time.Millisecond), CaptureLength: len(data), Length: len(data)}
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestReplayPcap_SeqWraparound(t *testing.T) {
+	local := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 9000}
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 9001}
+
+	// The ISN sits just below 2^32: the data ends at 0xFFFFFFFB and the
+	// FIN wraps the sequence space, so the ACK covering it is 6
+	const isn, peerISN = 0xFFFFFFF0, 1000
+	data := make([]byte, 10)
+	segs := []segment{
+		{true, tcpv2.NewPacket(9000, 9001, isn, 0, true, false, false, false, 65535, nil)},
+		{false, tcpv2.NewPacket(9001, 9000, peerISN, isn+1, true, true, false, false, 65535, nil)},
+		{true, tcpv2.NewPacket(9000, 9001, isn+1, peerISN+1, false, true, false, false, 65535, nil)},
+		{true, tcpv2.NewPacket(9000, 9001, isn+1, peerISN+1, false, true, false, false, 65535, data)},
+		{true, tcpv2.NewPacket(9000, 9001, isn+11, peerISN+1, false, true, true, false, 65535, data)},
+		// Simultaneous close: the peer's FIN acknowledges only the data
+		{false, tcpv2.NewPacket(9001, 9000, peerISN+1, isn+11, false, true, true, false, 65535, nil)},
+		{false, tcpv2.NewPacket(9001, 9000, peerISN+2, 6, false, true, false, false, 65535, nil)},
+	}
+	path := writeCapture(t, local, peer, segs)
+
+	table, _ := tcpconn.LookupMachine(tcpconn.DefaultMachine)
+	history, err := replayPcap(table, path, "")
+	if err != nil {
+		t.Fatalf("replayPcap() error = %v", err)
+	}
+
+	want := []tcpconn.TCPState{tcpconn.SYN_SENT, tcpconn.ESTABLISHED, tcpconn.FIN_WAIT_1, tcpconn.CLOSING, tcpconn.TIME_WAIT}
+	if len(history) != len(want) {
+		t.Fatalf("history = %v, want states %v", history, want)
+	}
+	for i, st := range want {
+		if history[i].ToState != st {
+			t.Errorf("history[%d].ToState = %v, want %v", i, history[i].ToState, st)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package tcpconn
+
+import (
+	"fmt"
+	"time"
+)
+
+// Delta - изменение статистики между двумя снимками со скоростями за интервал
+type Delta struct {
+	Start    time.Time
+	End      time.Time
+	Interval time.Duration
+
+	// Приращения счётчиков
+	PacketsSent     uint64
+	PacketsReceived uint64
+	PacketsLost     uint64
+	PacketsRetried  uint64
+	BytesSent       uint64
+	BytesReceived   uint64
+	Errors          uint64
+	Timeouts        uint64
+	Resets          uint64
+
+	// Средние скорости за интервал
+	SendBytesPerSec      float64
+	RecvBytesPerSec      float64
+	SendPacketsPerSec    float64
+	RecvPacketsPerSec    float64
+	RetriedPacketsPerSec float64
+
+	// Доля потерь за интервал в процентах
+	PacketLossRate float64
+
+	// Задержки измерений, сделанных за интервал (микросекунды)
+	LatencyCount  uint64
+	AvgLatencyUs  uint64
+	P50LatencyUs  uint64
+	P99LatencyUs  uint64
+	P999LatencyUs uint64
+}
+
+// counterDelta возвращает приращение счётчика. Если счётчик уменьшился,
+// статистику сбросили, и приращением считается текущее значение.
+func counterDelta(cur, prev uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+// Sub возвращает изменение статистики от prev до snap
+func (snap Snapshot) Sub(prev Snapshot) Delta {
+	d := Delta{
+		Start:           prev.Timestamp,
+		End:             snap.Timestamp,
+		Interval:        snap.Timestamp.Sub(prev.Timestamp),
+		PacketsSent:     counterDelta(snap.PacketsSent, prev.PacketsSent),
+		PacketsReceived: counterDelta(snap.PacketsReceived, prev.PacketsReceived),
+		PacketsLost:     counterDelta(snap.PacketsLost, prev.PacketsLost),
+		PacketsRetried:  counterDelta(snap.PacketsRetried, prev.PacketsRetried),
+		BytesSent:       counterDelta(snap.BytesSent, prev.BytesSent),
+		BytesReceived:   counterDelta(snap.BytesReceived, prev.BytesReceived),
+		Errors:          counterDelta(snap.Errors, prev.Errors),
+		Timeouts:        counterDelta(snap.Timeouts, prev.Timeouts),
+		Resets:          counterDelta(snap.Resets, prev.Resets),
+	}
+
+	if secs := d.Interval.Seconds(); secs > 0 {
+		d.SendBytesPerSec = float64(d.BytesSent) / secs
+		d.RecvBytesPerSec = float64(d.BytesReceived) / secs
+		d.SendPacketsPerSec = float64(d.PacketsSent) / secs
+		d.RecvPacketsPerSec = float64(d.PacketsReceived) / secs
+		d.RetriedPacketsPerSec = float64(d.PacketsRetried) / secs
+	}
+	if d.PacketsSent > 0 {
+		d.PacketLossRate = float64(d.PacketsLost) / float64(d.PacketsSent) * 100.0
+	}
+
+	hist := snap.LatencyHistogram
+	if snap.LatencyCount >= prev.LatencyCount {
+		hist = hist.Sub(prev.LatencyHistogram)
+	}
+	d.LatencyCount = hist.Count
+	d.AvgLatencyUs = hist.Mean()
+	d.P50LatencyUs = hist.Percentile(50)
+	d.P99LatencyUs = hist.Percentile(99)
+	d.P999LatencyUs = hist.Percentile(99.9)
+
+	return d
+}
+
+// String возвращает однострочное представление изменения
+func (d Delta) String() string {
+	return fmt.Sprintf("%v: sent=%d (%s) recv=%d (%s) lost=%d (%.2f%%) retried=%d errors=%d timeouts=%d resets=%d p99=%dμs",
+		d.Interval.Round(time.Millisecond),
+		d.PacketsSent, FormatRate(d.SendBytesPerSec),
+		d.PacketsReceived, FormatRate(d.RecvBytesPerSec),
+		d.PacketsLost, d.PacketLossRate, d.PacketsRetried,
+		d.Errors, d.Timeouts, d.Resets, d.P99LatencyUs)
+}
@@ -0,0 +1,228 @@
+package tcpconn
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// snapshotJSON - схема JSON снимка. Имена полей стабильны: новые поля только
+// добавляются, поэтому старые записи читаются новыми версиями и наоборот.
+type snapshotJSON struct {
+	Timestamp time.Time `json:"timestamp"`
+
+	PacketsSent     uint64 `json:"packets_sent"`
+	PacketsReceived uint64 `json:"packets_received"`
+	PacketsLost     uint64 `json:"packets_lost"`
+	PacketsRetried  uint64 `json:"packets_retried"`
+	BytesSent       uint64 `json:"bytes_sent"`
+	BytesReceived   uint64 `json:"bytes_received"`
+	Errors          uint64 `json:"errors"`
+	Timeouts        uint64 `json:"timeouts"`
+	Resets          uint64 `json:"resets"`
+
+	SendBytesPerSec   float64          `json:"send_bytes_per_sec"`
+	RecvBytesPerSec   float64          `json:"recv_bytes_per_sec"`
+	SendPacketsPerSec float64          `json:"send_packets_per_sec"`
+	RecvPacketsPerSec float64          `json:"recv_packets_per_sec"`
+	Rates             []windowRateJSON `json:"rates,omitempty"`
+
+	MinLatencyUs     uint64         `json:"min_latency_us"`
+	MaxLatencyUs     uint64         `json:"max_latency_us"`
+	AvgLatencyUs     uint64         `json:"avg_latency_us"`
+	LatencyCount     uint64         `json:"latency_count"`
+	P50LatencyUs     uint64         `json:"p50_latency_us"`
+	P90LatencyUs     uint64         `json:"p90_latency_us"`
+	P99LatencyUs     uint64         `json:"p99_latency_us"`
+	P999LatencyUs    uint64         `json:"p999_latency_us"`
+	LatencyHistogram *histogramJSON `json:"latency_histogram,omitempty"`
+
+	PacketLossRate   float64 `json:"packet_loss_rate"`
+	UptimeMs         float64 `json:"uptime_ms"`
+	TimeSinceResetMs float64 `json:"time_since_reset_ms"`
+}
+
+type windowRateJSON struct {
+	WindowMs          float64 `json:"window_ms"`
+	SendBytesPerSec   float64 `json:"send_bytes_per_sec"`
+	RecvBytesPerSec   float64 `json:"recv_bytes_per_sec"`
+	SendPacketsPerSec float64 `json:"send_packets_per_sec"`
+	RecvPacketsPerSec float64 `json:"recv_packets_per_sec"`
+}
+
+type histogramJSON struct {
+	Count   uint64                `json:"count"`
+	SumUs   uint64                `json:"sum_us"`
+	MinUs   uint64                `json:"min_us"`
+	MaxUs   uint64                `json:"max_us"`
+	Buckets []histogramBucketJSON `json:"buckets"`
+}
+
+type histogramBucketJSON struct {
+	UpperBoundUs uint64 `json:"le_us"`
+	Count        uint64 `json:"count"`
+}
+
+// msToDuration переводит миллисекунды обратно в длительность с округлением до наносекунды
+func msToDuration(ms float64) time.Duration {
+	return time.Duration(math.Round(ms * float64(time.Millisecond)))
+}
+
+// MarshalJSON кодирует снимок с явными именами полей; длительности в миллисекундах
+func (snap Snapshot) MarshalJSON() ([]byte, error) {
+	out := snapshotJSON{
+		Timestamp:         snap.Timestamp,
+		PacketsSent:       snap.PacketsSent,
+		PacketsReceived:   snap.PacketsReceived,
+		PacketsLost:       snap.PacketsLost,
+		PacketsRetried:    snap.PacketsRetried,
+		BytesSent:         snap.BytesSent,
+		BytesReceived:     snap.BytesReceived,
+		Errors:            snap.Errors,
+		Timeouts:          snap.Timeouts,
+		Resets:            snap.Resets,
+		SendBytesPerSec:   snap.SendRateBytesPerSec,
+		RecvBytesPerSec:   snap.RecvRateBytesPerSec,
+		SendPacketsPerSec: snap.SendRatePacketsPerSec,
+		RecvPacketsPerSec: snap.RecvRatePacketsPerSec,
+		MinLatencyUs:      snap.MinLatencyUs,
+		MaxLatencyUs:      snap.MaxLatencyUs,
+		AvgLatencyUs:      snap.AvgLatencyUs,
+		LatencyCount:      snap.LatencyCount,
+		P50LatencyUs:      snap.P50LatencyUs,
+		P90LatencyUs:      snap.P90LatencyUs,
+		P99LatencyUs:      snap.P99LatencyUs,
+		P999LatencyUs:     snap.P999LatencyUs,
+		PacketLossRate:    snap.PacketLossRate,
+		UptimeMs:          durationMs(snap.Uptime),
+		TimeSinceResetMs:  durationMs(snap.TimeSinceReset),
+	}
+
+	for _, r := range snap.Rates {
+		out.Rates = append(out.Rates, windowRateJSON{
+			WindowMs:          durationMs(r.Window),
+			SendBytesPerSec:   r.SendBytesPerSec,
+			RecvBytesPerSec:   r.RecvBytesPerSec,
+			SendPacketsPerSec: r.SendPacketsPerSec,
+			RecvPacketsPerSec: r.RecvPacketsPerSec,
+		})
+	}
+
+	if hist := snap.LatencyHistogram; hist.Count > 0 {
+		out.LatencyHistogram = &histogramJSON{
+			Count:   hist.Count,
+			SumUs:   hist.SumUs,
+			MinUs:   hist.MinUs,
+			MaxUs:   hist.MaxUs,
+			Buckets: make([]histogramBucketJSON, len(hist.Buckets)),
+		}
+		for i, b := range hist.Buckets {
+			out.LatencyHistogram.Buckets[i] = histogramBucketJSON(b)
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON декодирует снимок, записанный MarshalJSON. Отсутствующие поля
+// остаются нулевыми, неизвестные игнорируются.
+func (snap *Snapshot) UnmarshalJSON(data []byte) error {
+	var in snapshotJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	*snap = Snapshot{
+		Timestamp:             in.Timestamp,
+		PacketsSent:           in.PacketsSent,
+		PacketsReceived:       in.PacketsReceived,
+		PacketsLost:           in.PacketsLost,
+		PacketsRetried:        in.PacketsRetried,
+		BytesSent:             in.BytesSent,
+		BytesReceived:         in.BytesReceived,
+		Errors:                in.Errors,
+		Timeouts:              in.Timeouts,
+		Resets:                in.Resets,
+		SendRateBytesPerSec:   in.SendBytesPerSec,
+		RecvRateBytesPerSec:   in.RecvBytesPerSec,
+		SendRatePacketsPerSec: in.SendPacketsPerSec,
+		RecvRatePacketsPerSec: in.RecvPacketsPerSec,
+		MinLatencyUs:          in.MinLatencyUs,
+		MaxLatencyUs:          in.MaxLatencyUs,
+		AvgLatencyUs:          in.AvgLatencyUs,
+		LatencyCount:          in.LatencyCount,
+		P50LatencyUs:          in.P50LatencyUs,
+		P90LatencyUs:          in.P90LatencyUs,
+		P99LatencyUs:          in.P99LatencyUs,
+		P999LatencyUs:         in.P999LatencyUs,
+		PacketLossRate:        in.PacketLossRate,
+		Uptime:                msToDuration(in.UptimeMs),
+		TimeSinceReset:        msToDuration(in.TimeSinceResetMs),
+	}
+
+	for _, r := range in.Rates {
+		snap.Rates = append(snap.Rates, WindowRate{
+			Window:            msToDuration(r.WindowMs),
+			SendBytesPerSec:   r.SendBytesPerSec,
+			RecvBytesPerSec:   r.RecvBytesPerSec,
+			SendPacketsPerSec: r.SendPacketsPerSec,
+			RecvPacketsPerSec: r.RecvPacketsPerSec,
+		})
+	}
+
+	if h := in.LatencyHistogram; h != nil {
+		snap.LatencyHistogram = HistogramSnapshot{
+			Count: h.Count,
+			SumUs: h.SumUs,
+			MinUs: h.MinUs,
+			MaxUs: h.MaxUs,
+		}
+		for _, b := range h.Buckets {
+			snap.LatencyHistogram.Buckets = append(snap.LatencyHistogram.Buckets, HistogramBucket(b))
+		}
+	}
+
+	return nil
+}
+
+// MarshalZerologObject позволяет писать снимок в лог: log.Info().Object("stats", snap)
+func (snap Snapshot) MarshalZerologObject(e *zerolog.Event) {
+	e.Uint64("packets_sent", snap.PacketsSent).
+		Uint64("packets_received", snap.PacketsReceived).
+		Uint64("packets_lost", snap.PacketsLost).
+		Uint64("packets_retried", snap.PacketsRetried).
+		Uint64("bytes_sent", snap.BytesSent).
+		Uint64("bytes_received", snap.BytesReceived).
+		Uint64("errors", snap.Errors).
+		Uint64("timeouts", snap.Timeouts).
+		Uint64("resets", snap.Resets).
+		Float64("send_bytes_per_sec", snap.SendRateBytesPerSec).
+		Float64("recv_bytes_per_sec", snap.RecvRateBytesPerSec).
+		Float64("send_packets_per_sec", snap.SendRatePacketsPerSec).
+		Float64("recv_packets_per_sec", snap.RecvRatePacketsPerSec).
+		Float64("packet_loss_rate", snap.PacketLossRate).
+		Uint64("min_latency_us", snap.MinLatencyUs).
+		Uint64("avg_latency_us", snap.AvgLatencyUs).
+		Uint64("max_latency_us", snap.MaxLatencyUs).
+		Uint64("p50_latency_us", snap.P50LatencyUs).
+		Uint64("p90_latency_us", snap.P90LatencyUs).
+		Uint64("p99_latency_us", snap.P99LatencyUs).
+		Uint64("p999_latency_us", snap.P999LatencyUs).
+		Float64("uptime_ms", durationMs(snap.Uptime))
+}
+
+// Compact возвращает снимок одной строкой key=value для агрегаторов логов
+func (snap Snapshot) Compact() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "sent=%d recv=%d lost=%d retried=%d", snap.PacketsSent, snap.PacketsReceived, snap.PacketsLost, snap.PacketsRetried)
+	fmt.Fprintf(&b, " bytes_sent=%d bytes_recv=%d", snap.BytesSent, snap.BytesReceived)
+	fmt.Fprintf(&b, " errors=%d timeouts=%d resets=%d", snap.Errors, snap.Timeouts, snap.Resets)
+	fmt.Fprintf(&b, " send_bps=%.0f recv_bps=%.0f loss=%.2f", snap.SendRateBytesPerSec, snap.RecvRateBytesPerSec, snap.PacketLossRate)
+	fmt.Fprintf(&b, " p50_us=%d p99_us=%d p999_us=%d max_us=%d", snap.P50LatencyUs, snap.P99LatencyUs, snap.P999LatencyUs, snap.MaxLatencyUs)
+	fmt.Fprintf(&b, " uptime_ms=%d", snap.Uptime.Milliseconds())
+	return b.String()
+}
@@ -0,0 +1,166 @@
+package tcpconn
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// goldenSnapshot и goldenSnapshotJSON фиксируют схему JSON. Если тест
+// падает, изменение ломает совместимость с уже записанными данными.
+var goldenSnapshot = Snapshot{
+	Timestamp:             time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	PacketsSent:           10,
+	PacketsReceived:       8,
+	PacketsLost:           1,
+	PacketsRetried:        2,
+	BytesSent:             15000,
+	BytesReceived:         12000,
+	Errors:                3,
+	Timeouts:              4,
+	Resets:                5,
+	SendRateBytesPerSec:   1500.5,
+	RecvRateBytesPerSec:   1200.25,
+	SendRatePacketsPerSec: 1,
+	RecvRatePacketsPerSec: 0.8,
+	Rates: []WindowRate{
+		{Window: 10 * time.Second, SendBytesPerSec: 1500.5, RecvBytesPerSec: 1200.25, SendPacketsPerSec: 1, RecvPacketsPerSec: 0.8},
+	},
+	MinLatencyUs:  100,
+	MaxLatencyUs:  300,
+	AvgLatencyUs:  200,
+	LatencyCount:  2,
+	P50LatencyUs:  100,
+	P90LatencyUs:  300,
+	P99LatencyUs:  300,
+	P999LatencyUs: 300,
+	LatencyHistogram: HistogramSnapshot{
+		Count:   2,
+		SumUs:   400,
+		MinUs:   100,
+		MaxUs:   300,
+		Buckets: []HistogramBucket{{UpperBoundUs: 101, Count: 1}, {UpperBoundUs: 303, Count: 1}},
+	},
+	PacketLossRate: 10,
+	Uptime:         90*time.Second + 500*time.Microsecond,
+	TimeSinceReset: 1500 * time.Millisecond,
+}
+
+const goldenSnapshotJSON = `{"timestamp":"2024-05-01T12:00:00Z",` +
+	`"packets_sent":10,"packets_received":8,"packets_lost":1,"packets_retried":2,` +
+	`"bytes_sent":15000,"bytes_received":12000,"errors":3,"timeouts":4,"resets":5,` +
+	`"send_bytes_per_sec":1500.5,"recv_bytes_per_sec":1200.25,"send_packets_per_sec":1,"recv_packets_per_sec":0.8,` +
+	`"rates":[{"window_ms":10000,"send_bytes_per_sec":1500.5,"recv_bytes_per_sec":1200.25,"send_packets_per_sec":1,"recv_packets_per_sec":0.8}],` +
+	`"min_latency_us":100,"max_latency_us":300,"avg_latency_us":200,"latency_count":2,` +
+	`"p50_latency_us":100,"p90_latency_us":300,"p99_latency_us":300,"p999_latency_us":300,` +
+	`"latency_histogram":{"count":2,"sum_us":400,"min_us":100,"max_us":300,"buckets":[{"le_us":101,"count":1},{"le_us":303,"count":1}]},` +
+	`"packet_loss_rate":10,"uptime_ms":90000.5,"time_since_reset_ms":1500}`
+
+func TestSnapshot_MarshalJSONGolden(t *testing.T) {
+	data, err := json.Marshal(goldenSnapshot)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != goldenSnapshotJSON {
+		t.Errorf("Marshal =\n%s\nwant\n%s", data, goldenSnapshotJSON)
+	}
+
+	var decoded Snapshot
+	if err := json.Unmarshal([]byte(goldenSnapshotJSON), &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, goldenSnapshot) {
+		t.Errorf("Unmarshal =\n%+v\nwant\n%+v", decoded, goldenSnapshot)
+	}
+}
+
+func TestSnapshot_JSONRoundTrip(t *testing.T) {
+	stats := NewStatistics()
+	stats.RecordPacketSent(1000)
+	stats.RecordPacketReceived(700)
+	stats.RecordPacketLost()
+	for v := uint64(1); v <= 500; v++ {
+		stats.RecordLatency(v * 13)
+	}
+
+	snap := stats.GetSnapshot()
+	snap.Timestamp = snap.Timestamp.Round(0) // без монотонного времени, которое JSON не хранит
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var decoded Snapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !decoded.Timestamp.Equal(snap.Timestamp) {
+		t.Errorf("Timestamp = %v, want %v", decoded.Timestamp, snap.Timestamp)
+	}
+	decoded.Timestamp = snap.Timestamp
+	if !reflect.DeepEqual(decoded, snap) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", decoded, snap)
+	}
+
+	// Гистограмма после декодирования остаётся объединяемой
+	merged := MergeSnapshots(decoded, snap)
+	if merged.LatencyHistogram.Count != 1000 || merged.P99LatencyUs != snap.P99LatencyUs {
+		t.Errorf("merged count/p99 = %d/%d, want 1000/%d", merged.LatencyHistogram.Count, merged.P99LatencyUs, snap.P99LatencyUs)
+	}
+}
+
+func TestSnapshot_UnmarshalJSONCompatible(t *testing.T) {
+	// Старые записи без новых полей и записи с неизвестными полями читаются
+	data := `{"packets_sent":7,"uptime_ms":2500,"some_future_field":{"x":1}}`
+
+	var snap Snapshot
+	if err := json.Unmarshal([]byte(data), &snap); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if snap.PacketsSent != 7 || snap.Uptime != 2500*time.Millisecond || snap.Rates != nil {
+		t.Errorf("decoded = %+v", snap)
+	}
+}
+
+func TestSnapshot_MarshalZerologObject(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Info().Object("stats", goldenSnapshot).Msg("snapshot")
+
+	var entry struct {
+		Stats map[string]any `json:"stats"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v\n%s", err, buf.String())
+	}
+
+	for key, want := range map[string]float64{
+		"packets_retried":  2,
+		"packet_loss_rate": 10,
+		"p99_latency_us":   300,
+		"uptime_ms":        90000.5,
+	} {
+		if entry.Stats[key] != want {
+			t.Errorf("stats[%q] = %v, want %v", key, entry.Stats[key], want)
+		}
+	}
+}
+
+func TestSnapshot_Compact(t *testing.T) {
+	line := goldenSnapshot.Compact()
+	if strings.Contains(line, "\n") {
+		t.Fatalf("Compact() has newlines: %q", line)
+	}
+
+	want := "sent=10 recv=8 lost=1 retried=2 bytes_sent=15000 bytes_recv=12000 errors=3 timeouts=4 resets=5 " +
+		"send_bps=1500 recv_bps=1200 loss=10.00 p50_us=100 p99_us=300 p999_us=300 max_us=300 uptime_ms=90000"
+	if line != want {
+		t.Errorf("Compact() =\n%s\nwant\n%s", line, want)
+	}
+}
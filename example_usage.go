@@ -1,18 +1,18 @@
 package tcpconn
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"sync"
-	"time"
 )
 
 // TCPConnection представляет TCP соединение с управлением состоянием и буферами
 type TCPConnection struct {
 	state       *TCPStateMachine
-	readBuffer  *RingBuffer
+	readBuffer  *BlockingRingBuffer
 	writeBuffer *RingBuffer
 	stats       *Statistics
 	mu          sync.RWMutex
@@ -32,7 +32,7 @@ func NewTCPConnectionWithStats(bufferSize int, stats *Statistics) (*TCPConnectio
 		bufferSize = 4096
 	}
 
-	readBuf, err := NewRingBuffer(bufferSize)
+	readBuf, err := NewBlockingRingBuffer(bufferSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create read buffer: %w", err)
 	}
@@ -140,7 +140,7 @@ func (c *TCPConnection) Read(buf []byte) (int, error) {
 		return 0, fmt.Errorf("cannot receive data in state %s", c.state.GetState())
 	}
 
-	n, err := c.readBuffer.Read(buf)
+	n, err := c.readBuffer.TryRead(buf)
 	if err == nil && n > 0 {
 		c.stats.RecordPacketReceived(uint64(n))
 	} else if err != nil {
@@ -149,6 +149,28 @@ func (c *TCPConnection) Read(buf []byte) (int, error) {
 	return n, err
 }
 
+// ReadContext читает данные из буфера приема, ожидая их появления.
+// Close соединения прерывает ожидание с io.EOF, отмена ctx - с ctx.Err().
+func (c *TCPConnection) ReadContext(ctx context.Context, buf []byte) (int, error) {
+	// Блокировка соединения не удерживается во время ожидания, иначе Close не сможет его прервать
+	c.mu.RLock()
+	if !c.closed && !c.state.CanReceiveData() && c.readBuffer.IsEmpty() {
+		state := c.state.GetState()
+		c.mu.RUnlock()
+		c.stats.RecordError()
+		return 0, fmt.Errorf("cannot receive data in state %s", state)
+	}
+	c.mu.RUnlock()
+
+	n, err := c.readBuffer.ReadContext(ctx, buf)
+	if n > 0 {
+		c.stats.RecordPacketReceived(uint64(n))
+	} else if err != nil && err != io.EOF {
+		c.stats.RecordError()
+	}
+	return n, err
+}
+
 // Close закрывает соединение
 func (c *TCPConnection) Close() error {
 	c.mu.Lock()
@@ -163,7 +185,7 @@ func (c *TCPConnection) Close() error {
 	}
 
 	c.closed = true
-	return nil
+	return c.readBuffer.Close()
 }
 
 // GetState возвращает текущее состояние соединения
@@ -250,19 +272,18 @@ func (mp *MessageProtocol) SendMessage(data []byte) error {
 
 // ReceiveMessage получает сообщение (блокируется до получения полного сообщения)
 func (mp *MessageProtocol) ReceiveMessage() ([]byte, error) {
+	return mp.ReceiveMessageContext(context.Background())
+}
+
+// ReceiveMessageContext - ReceiveMessage с отменой через ctx.
+// Закрытие соединения посреди сообщения возвращает io.ErrUnexpectedEOF.
+func (mp *MessageProtocol) ReceiveMessageContext(ctx context.Context) ([]byte, error) {
+	r := contextReader{ctx: ctx, conn: mp.conn}
+
 	// Читаем заголовок (4 байта)
 	header := make([]byte, 4)
-	totalRead := 0
-
-	for totalRead < 4 {
-		n, err := mp.conn.Read(header[totalRead:])
-		if err != nil {
-			return nil, err
-		}
-		totalRead += n
-		if totalRead < 4 {
-			time.Sleep(10 * time.Millisecond) // Небольшая задержка
-		}
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
 	}
 
 	// Декодируем длину
@@ -273,22 +294,23 @@ func (mp *MessageProtocol) ReceiveMessage() ([]byte, error) {
 
 	// Читаем данные
 	data := make([]byte, length)
-	totalRead = 0
-
-	for totalRead < int(length) {
-		n, err := mp.conn.Read(data[totalRead:])
-		if err != nil {
-			return nil, err
-		}
-		totalRead += n
-		if totalRead < int(length) {
-			time.Sleep(10 * time.Millisecond)
-		}
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
 	}
 
 	return data, nil
 }
 
+// contextReader привязывает блокирующее чтение соединения к ctx для io.ReadFull
+type contextReader struct {
+	ctx  context.Context
+	conn *TCPConnection
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	return r.conn.ReadContext(r.ctx, p)
+}
+
 // Connect устанавливает соединение
 func (mp *MessageProtocol) Connect() error {
 	return mp.conn.Connect()
@@ -343,11 +365,10 @@ func (sp *StreamProcessor) processMessages() error {
 			break
 		}
 
-		// Читаем заголовок без удаления
-		header := make([]byte, 5)
-		if _, err := sp.buffer.Peek(header); err != nil {
-			return err
-		}
+		// Читаем заголовок без удаления и без выделения памяти
+		var header [5]byte
+		a, b := sp.buffer.PeekSlices(len(header))
+		copy(header[copy(header[:], a):], b)
 
 		msgType := header[0]
 		length := binary.BigEndian.Uint32(header[1:5])
@@ -388,19 +409,33 @@ type ConnectionPool struct {
 	mu          sync.Mutex
 	maxSize     int
 	bufferSize  int
+	stats       *Statistics
 }
 
 // NewConnectionPool создает новый пул соединений
 func NewConnectionPool(maxSize, bufferSize int) (*ConnectionPool, error) {
+	return NewConnectionPoolWithStats(maxSize, bufferSize, nil)
+}
+
+// NewConnectionPoolWithStats создает пул, итоговая статистика которого является
+// дочерней для parent. Каждое соединение пула получает собственную статистику,
+// дочернюю для статистики пула. Если parent == nil, статистика пула корневая.
+func NewConnectionPoolWithStats(maxSize, bufferSize int, parent *Statistics) (*ConnectionPool, error) {
 	if maxSize <= 0 {
 		return nil, errors.New("pool size must be positive")
 	}
 
+	stats := NewStatistics()
+	if parent != nil {
+		stats = parent.NewChild()
+	}
+
 	pool := &ConnectionPool{
 		connections: make([]*TCPConnection, 0, maxSize),
 		available:   make(chan int, maxSize),
 		maxSize:     maxSize,
 		bufferSize:  bufferSize,
+		stats:       stats,
 	}
 
 	return pool, nil
@@ -419,7 +454,7 @@ func (cp *ConnectionPool) Acquire() (*TCPConnection, error) {
 	default:
 		// Если пул не заполнен, создаем новое соединение
 		if len(cp.connections) < cp.maxSize {
-			conn, err := NewTCPConnection(cp.bufferSize)
+			conn, err := NewTCPConnectionWithStats(cp.bufferSize, cp.stats.NewChild())
 			if err != nil {
 				cp.mu.Unlock()
 				return nil, err
@@ -460,6 +495,29 @@ func (cp *ConnectionPool) Release(conn *TCPConnection) error {
 	return errors.New("connection not found in pool")
 }
 
+// Stats возвращает итоговую статистику всех соединений пула
+func (cp *ConnectionPool) Stats() Snapshot {
+	return cp.stats.GetSnapshot()
+}
+
+// ConnectionStats возвращает статистику каждого соединения пула, именуя их conn-<индекс>
+func (cp *ConnectionPool) ConnectionStats() []NamedSnapshot {
+	cp.mu.Lock()
+	conns := append([]*TCPConnection(nil), cp.connections...)
+	cp.mu.Unlock()
+
+	snaps := make([]NamedSnapshot, len(conns))
+	for i, conn := range conns {
+		snaps[i] = NamedSnapshot{Name: fmt.Sprintf("conn-%d", i), Snapshot: conn.GetStatisticsSnapshot()}
+	}
+	return snaps
+}
+
+// WorstConnections возвращает не более n худших соединений пула по ranking
+func (cp *ConnectionPool) WorstConnections(n int, ranking Ranking) []NamedSnapshot {
+	return TopN(cp.ConnectionStats(), n, ranking)
+}
+
 // Close закрывает все соединения в пуле
 func (cp *ConnectionPool) Close() error {
 	cp.mu.Lock()
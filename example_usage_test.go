@@ -1,6 +1,8 @@
 package tcpconn
 
 import (
+	"context"
+	"io"
 	"testing"
 	"time"
 )
@@ -182,6 +184,48 @@ func TestMessageProtocol_EmptyMessage(t *testing.T) {
 	}
 }
 
+func TestMessageProtocol_ReceiveBlocks(t *testing.T) {
+	mp, err := NewMessageProtocol(4096)
+	if err != nil {
+		t.Fatalf("NewMessageProtocol() error = %v", err)
+	}
+	mp.Connect()
+
+	// Сообщение приходит частями после начала ожидания
+	go func() {
+		mp.SendMessage([]byte("delayed"))
+		data := mp.conn.writeBuffer.ReadAll()
+		for _, part := range [][]byte{data[:2], data[2:6], data[6:]} {
+			time.Sleep(5 * time.Millisecond)
+			mp.conn.readBuffer.Write(part)
+		}
+	}()
+
+	received, err := mp.ReceiveMessage()
+	if err != nil {
+		t.Fatalf("ReceiveMessage() error = %v", err)
+	}
+	if string(received) != "delayed" {
+		t.Errorf("ReceiveMessage() = %q, want \"delayed\"", received)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := mp.ReceiveMessageContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("ReceiveMessageContext() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// Закрытие посреди сообщения
+	mp.conn.readBuffer.Write([]byte{0, 0, 0, 10, 'a'})
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		mp.Close()
+	}()
+	if _, err := mp.ReceiveMessage(); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReceiveMessage() after Close error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
 func TestStreamProcessor_RegisterHandler(t *testing.T) {
 	sp, err := NewStreamProcessor(1024)
 	if err != nil {
@@ -408,6 +452,45 @@ func TestConnectionPool_Close(t *testing.T) {
 	}
 }
 
+func TestConnectionPool_StatsHierarchy(t *testing.T) {
+	root := NewStatistics()
+	pool, err := NewConnectionPoolWithStats(3, 1024, root)
+	if err != nil {
+		t.Fatalf("NewConnectionPoolWithStats() error = %v", err)
+	}
+	defer pool.Close()
+
+	conn1, _ := pool.Acquire()
+	conn2, _ := pool.Acquire()
+	conn1.Connect()
+	conn2.Connect()
+
+	conn1.Write([]byte("hello"))
+	conn2.Write([]byte("world!"))
+	conn2.Write([]byte("again"))
+	conn2.stats.RecordPacketLost()
+
+	// Соединения считают отдельно, пул и корень - итоги
+	if got := conn1.GetStatisticsSnapshot().PacketsSent; got != 1 {
+		t.Errorf("conn1 PacketsSent = %d, want 1", got)
+	}
+	if got := pool.Stats().PacketsSent; got != 3 {
+		t.Errorf("pool PacketsSent = %d, want 3", got)
+	}
+	if got := root.GetBytesSent(); got != 16 {
+		t.Errorf("root BytesSent = %d, want 16", got)
+	}
+
+	if got := pool.ConnectionStats(); len(got) != 2 || got[0].Name != "conn-0" {
+		t.Errorf("ConnectionStats() = %+v, want conn-0 and conn-1", got)
+	}
+
+	worst := pool.WorstConnections(1, ByLossRate)
+	if len(worst) != 1 || worst[0].Name != "conn-1" {
+		t.Errorf("WorstConnections(1, ByLossRate) = %+v, want conn-1", worst)
+	}
+}
+
 func TestTCPConnection_WithExternalStats(t *testing.T) {
 	// Создаём внешний объект статистики
 	stats := NewStatistics()
@@ -269,7 +269,7 @@ func ExampleTCPStateMachine_reset() {
 	sm.ProcessEvent(tcpconn.SYN_ACK)
 	fmt.Printf("Состояние: %s\n", sm.GetState())
 
-	// RST сбрасывает соединение из любого состояния
+	// RST сбрасывает соединение из любого синхронизированного состояния
 	sm.ProcessEvent(tcpconn.RST)
 	fmt.Printf("После RST: %s\n", sm.GetState())
 
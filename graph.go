@@ -0,0 +1,177 @@
+package tcpconn
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// edgeKey идентифицирует ребро графа переходов
+type edgeKey struct {
+	from, to TCPState
+	event    TCPEvent
+}
+
+// WriteDOT выводит граф переходов таблицы в формате Graphviz DOT
+func (t *TransitionTable) WriteDOT(w io.Writer) error {
+	return t.WritePathDOT(w, nil)
+}
+
+// WritePathDOT выводит граф переходов в формате DOT и выделяет путь соединения
+// по его истории (GetHistory). Подписи ребер пути содержат номера шагов;
+// переходы истории, которых нет в таблице, добавляются отдельными ребрами.
+func (t *TransitionTable) WritePathDOT(w io.Writer, history []StateTransition) error {
+	steps := make(map[edgeKey][]string)
+	visited := make(map[TCPState]bool)
+	var order []edgeKey
+	for i, tr := range history {
+		key := edgeKey{tr.FromState, tr.ToState, tr.Event}
+		if _, ok := steps[key]; !ok {
+			order = append(order, key)
+		}
+		steps[key] = append(steps[key], fmt.Sprint(i+1))
+		visited[tr.FromState] = true
+		visited[tr.ToState] = true
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(t.Name()))
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box, style=rounded];\n")
+
+	states := t.States()
+	for _, state := range states {
+		attrs := []string{}
+		if state == t.Initial() {
+			attrs = append(attrs, "peripheries=2")
+		}
+		if visited[state] {
+			attrs = append(attrs, "color=red", "penwidth=2")
+		}
+		b.WriteString("\t" + dotQuote(t.StateName(state)))
+		if len(attrs) > 0 {
+			b.WriteString(" [" + strings.Join(attrs, ", ") + "]")
+		}
+		b.WriteString(";\n")
+	}
+
+	drawn := make(map[edgeKey]bool)
+	edge := func(key edgeKey, guarded bool) {
+		label := t.EventName(key.event)
+		attrs := []string{}
+		if guarded {
+			label += " [guard]"
+			attrs = append(attrs, "style=dashed")
+		}
+		if nums, ok := steps[key]; ok && !drawn[key] {
+			label += " (" + strings.Join(nums, ",") + ")"
+			attrs = append(attrs, "color=red", "fontcolor=red", "penwidth=2")
+		}
+		drawn[key] = true
+		attrs = append([]string{"label=" + dotQuote(label)}, attrs...)
+		fmt.Fprintf(&b, "\t%s -> %s [%s];\n",
+			dotQuote(t.StateName(key.from)), dotQuote(t.StateName(key.to)), strings.Join(attrs, ", "))
+	}
+
+	for _, row := range t.Transitions() {
+		if row.From != AnyState {
+			edge(edgeKey{row.From, row.To, row.Event}, row.Guard != nil)
+			continue
+		}
+		for _, state := range states {
+			edge(edgeKey{state, row.To, row.Event}, row.Guard != nil)
+		}
+	}
+	for _, key := range order {
+		if !drawn[key] {
+			edge(key, false)
+		}
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMermaid выводит граф переходов таблицы как stateDiagram-v2 Mermaid
+func (t *TransitionTable) WriteMermaid(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("stateDiagram-v2\n")
+
+	states := t.States()
+	for _, state := range states {
+		name := t.StateName(state)
+		if id := mermaidID(name); id != name {
+			fmt.Fprintf(&b, "\tstate %q as %s\n", name, id)
+		}
+	}
+	fmt.Fprintf(&b, "\t[*] --> %s\n", mermaidID(t.StateName(t.Initial())))
+
+	for _, row := range t.Transitions() {
+		label := t.EventName(row.Event)
+		if row.Guard != nil {
+			label += " [guard]"
+		}
+		from := []TCPState{row.From}
+		if row.From == AnyState {
+			from = states
+		}
+		for _, state := range from {
+			fmt.Fprintf(&b, "\t%s --> %s : %s\n",
+				mermaidID(t.StateName(state)), mermaidID(t.StateName(row.To)), label)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteSequenceMermaid выводит историю соединения как sequenceDiagram Mermaid:
+// локальные события - стрелка к себе, полученные от собеседника - стрелка
+// от Peer, после каждого шага - заметка с новым состоянием.
+func (t *TransitionTable) WriteSequenceMermaid(w io.Writer, history []StateTransition) error {
+	var b strings.Builder
+	b.WriteString("sequenceDiagram\n")
+	b.WriteString("\tparticipant L as Local\n")
+	b.WriteString("\tparticipant P as Peer\n")
+
+	if len(history) > 0 {
+		fmt.Fprintf(&b, "\tNote over L: %s\n", t.StateName(history[0].FromState))
+	}
+	for _, tr := range history {
+		from := "L"
+		if peerEvent(tr.Event) {
+			from = "P"
+		}
+		fmt.Fprintf(&b, "\t%s->>L: %s\n", from, t.EventName(tr.Event))
+		fmt.Fprintf(&b, "\tNote over L: %s\n", t.StateName(tr.ToState))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// peerEvent сообщает, приходит ли событие от собеседника (сегмент из сети)
+func peerEvent(e TCPEvent) bool {
+	switch e {
+	case SYN, SYN_ACK, ACK, FIN, FIN_ACK, RST:
+		return true
+	default:
+		return false
+	}
+}
+
+// dotQuote экранирует идентификатор DOT
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// mermaidID превращает имя состояния в идентификатор Mermaid
+func mermaidID(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, name)
+}
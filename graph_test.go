@@ -0,0 +1,105 @@
+package tcpconn
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransitionTable_WriteDOT(t *testing.T) {
+	var b strings.Builder
+	if err := DefaultTransitionTable().WriteDOT(&b); err != nil {
+		t.Fatalf("WriteDOT() error = %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		`digraph "rfc9293" {`,
+		`"CLOSED" [peripheries=2];`,
+		`"CLOSED" -> "LISTEN" [label="PASSIVE_OPEN"];`,
+		`"SYN_RECEIVED" -> "LISTEN" [label="RST [guard]", style=dashed];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WriteDOT() missing %q", want)
+		}
+	}
+	if strings.Contains(out, "red") {
+		t.Error("WriteDOT() highlighted a path without history")
+	}
+}
+
+func TestTransitionTable_WritePathDOT(t *testing.T) {
+	sm := NewTCPStateMachine()
+	for _, e := range []TCPEvent{ACTIVE_OPEN, SYN_ACK, CLOSE, ACK, FIN, TIMEOUT, ACTIVE_OPEN} {
+		sm.ProcessEvent(e)
+	}
+
+	var b strings.Builder
+	if err := sm.Table().WritePathDOT(&b, sm.GetHistory()); err != nil {
+		t.Fatalf("WritePathDOT() error = %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		`"ESTABLISHED" [color=red, penwidth=2];`,
+		`"CLOSED" -> "SYN_SENT" [label="ACTIVE_OPEN (1,7)", color=red, fontcolor=red, penwidth=2];`,
+		`"TIME_WAIT" -> "CLOSED" [label="TIMEOUT (6)", color=red, fontcolor=red, penwidth=2];`,
+		`"LISTEN" -> "CLOSED" [label="CLOSE"];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WritePathDOT() missing %q", want)
+		}
+	}
+
+	// Переход, которого нет в таблице, все равно попадает на граф
+	extra := []StateTransition{{FromState: LISTEN, ToState: TIME_WAIT, Event: SYN}}
+	b.Reset()
+	sm.Table().WritePathDOT(&b, extra)
+	if !strings.Contains(b.String(), `"LISTEN" -> "TIME_WAIT" [label="SYN (1)"`) {
+		t.Error("WritePathDOT() dropped a transition missing from the table")
+	}
+}
+
+func TestTransitionTable_WriteMermaid(t *testing.T) {
+	var b strings.Builder
+	if err := newQUICTable("quic-mermaid").NameState(quicDraining, "DRAINING-3").WriteMermaid(&b); err != nil {
+		t.Fatalf("WriteMermaid() error = %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"stateDiagram-v2\n",
+		`state "DRAINING-3" as DRAINING_3`,
+		"[*] --> IDLE\n",
+		"ACTIVE --> DRAINING_3 : CLOSE\n",
+		// AnyState раскрывается в ребро из каждого состояния
+		"HANDSHAKE --> IDLE : IDLE_TIMEOUT\n",
+		"DRAINING_3 --> IDLE : IDLE_TIMEOUT\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WriteMermaid() missing %q\n%s", want, out)
+		}
+	}
+}
+
+func TestTransitionTable_WriteSequenceMermaid(t *testing.T) {
+	sm := NewTCPStateMachine()
+	sm.ProcessEvent(ACTIVE_OPEN)
+	sm.ProcessEvent(SYN_ACK)
+
+	var b strings.Builder
+	if err := sm.Table().WriteSequenceMermaid(&b, sm.GetHistory()); err != nil {
+		t.Fatalf("WriteSequenceMermaid() error = %v", err)
+	}
+
+	want := "sequenceDiagram\n" +
+		"\tparticipant L as Local\n" +
+		"\tparticipant P as Peer\n" +
+		"\tNote over L: CLOSED\n" +
+		"\tL->>L: ACTIVE_OPEN\n" +
+		"\tNote over L: SYN_SENT\n" +
+		"\tP->>L: SYN_ACK\n" +
+		"\tNote over L: ESTABLISHED\n"
+	if b.String() != want {
+		t.Errorf("WriteSequenceMermaid() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
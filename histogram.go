@@ -0,0 +1,275 @@
+package tcpconn
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// Параметры лог-линейной гистограммы: каждая степень двойки делится на
+// 2^histSubBits равных интервалов, что даёт относительную погрешность не
+// более 1/32 (~3%). Значения до 2^histSubBits мкс хранятся точно, значения
+// от 2^histMaxExp мкс (~71 мин) попадают в последний интервал.
+const (
+	histSubBits    = 5
+	histSubBuckets = 1 << histSubBits
+	histMaxExp     = 32
+	histBuckets    = histSubBuckets + (histMaxExp-histSubBits)*histSubBuckets
+)
+
+// LatencyHistogram - гистограмма задержек в микросекундах без блокировок.
+// Запись стоит несколько атомарных операций, снимки можно объединять между соединениями.
+type LatencyHistogram struct {
+	counts [histBuckets]atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Uint64
+	min    atomic.Uint64
+	max    atomic.Uint64
+}
+
+// NewLatencyHistogram создаёт пустую гистограмму
+func NewLatencyHistogram() *LatencyHistogram {
+	h := &LatencyHistogram{}
+	h.min.Store(^uint64(0))
+	return h
+}
+
+// histIndex возвращает номер интервала для значения
+func histIndex(v uint64) int {
+	if v < histSubBuckets {
+		return int(v)
+	}
+	exp := bits.Len64(v) - 1
+	if exp >= histMaxExp {
+		return histBuckets - 1
+	}
+	shift := exp - histSubBits
+	sub := int(v>>shift) - histSubBuckets
+	return histSubBuckets + (exp-histSubBits)*histSubBuckets + sub
+}
+
+// histUpperBound возвращает наибольшее значение, попадающее в интервал idx
+func histUpperBound(idx int) uint64 {
+	if idx < histSubBuckets {
+		return uint64(idx)
+	}
+	if idx >= histBuckets-1 {
+		return ^uint64(0)
+	}
+	exp := (idx-histSubBuckets)/histSubBuckets + histSubBits
+	sub := uint64((idx-histSubBuckets)%histSubBuckets + histSubBuckets)
+	shift := exp - histSubBits
+	return (sub+1)<<shift - 1
+}
+
+// Record записывает одно измерение
+func (h *LatencyHistogram) Record(us uint64) {
+	h.counts[histIndex(us)].Add(1)
+	h.sum.Add(us)
+	h.count.Add(1)
+
+	for {
+		old := h.min.Load()
+		if us >= old || h.min.CompareAndSwap(old, us) {
+			break
+		}
+	}
+	for {
+		old := h.max.Load()
+		if us <= old || h.max.CompareAndSwap(old, us) {
+			break
+		}
+	}
+}
+
+// Count возвращает количество измерений
+func (h *LatencyHistogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Min возвращает минимальное значение или 0, если измерений не было
+func (h *LatencyHistogram) Min() uint64 {
+	v := h.min.Load()
+	if v == ^uint64(0) {
+		return 0
+	}
+	return v
+}
+
+// Max возвращает максимальное значение
+func (h *LatencyHistogram) Max() uint64 {
+	return h.max.Load()
+}
+
+// Mean возвращает среднее значение
+func (h *LatencyHistogram) Mean() uint64 {
+	count := h.count.Load()
+	if count == 0 {
+		return 0
+	}
+	return h.sum.Load() / count
+}
+
+// Reset обнуляет гистограмму. Измерения, записываемые одновременно со
+// сбросом, могут быть учтены частично.
+func (h *LatencyHistogram) Reset() {
+	for i := range h.counts {
+		h.counts[i].Store(0)
+	}
+	h.count.Store(0)
+	h.sum.Store(0)
+	h.min.Store(^uint64(0))
+	h.max.Store(0)
+}
+
+// Snapshot возвращает копию гистограммы
+func (h *LatencyHistogram) Snapshot() HistogramSnapshot {
+	var snap HistogramSnapshot
+	for i := range h.counts {
+		if n := h.counts[i].Load(); n > 0 {
+			snap.Buckets = append(snap.Buckets, HistogramBucket{UpperBoundUs: histUpperBound(i), Count: n})
+			snap.Count += n
+		}
+	}
+	// Count берётся из интервалов, чтобы перцентили были согласованы с ними
+	snap.SumUs = h.sum.Load()
+	snap.MinUs = h.Min()
+	snap.MaxUs = h.Max()
+	return snap
+}
+
+// HistogramBucket - непустой интервал гистограммы
+type HistogramBucket struct {
+	UpperBoundUs uint64 // наибольшее значение интервала включительно
+	Count        uint64
+}
+
+// HistogramSnapshot - неизменяемая копия гистограммы задержек
+type HistogramSnapshot struct {
+	Count   uint64
+	SumUs   uint64
+	MinUs   uint64
+	MaxUs   uint64
+	Buckets []HistogramBucket // только непустые, по возрастанию границы
+}
+
+// Mean возвращает среднее значение
+func (hs HistogramSnapshot) Mean() uint64 {
+	if hs.Count == 0 {
+		return 0
+	}
+	return hs.SumUs / hs.Count
+}
+
+// Percentile возвращает значение, не превышаемое p процентами измерений
+// (p от 0 до 100), с точностью до интервала и в пределах [MinUs, MaxUs]
+func (hs HistogramSnapshot) Percentile(p float64) uint64 {
+	if hs.Count == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return hs.MinUs
+	}
+	if p >= 100 {
+		return hs.MaxUs
+	}
+
+	rank := uint64(p/100*float64(hs.Count) + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for _, b := range hs.Buckets {
+		seen += b.Count
+		if seen >= rank {
+			return clampUint64(b.UpperBoundUs, hs.MinUs, hs.MaxUs)
+		}
+	}
+	return hs.MaxUs
+}
+
+// Merge возвращает объединение двух снимков
+func (hs HistogramSnapshot) Merge(other HistogramSnapshot) HistogramSnapshot {
+	if other.Count == 0 {
+		return hs
+	}
+	if hs.Count == 0 {
+		return other
+	}
+
+	merged := HistogramSnapshot{
+		Count:   hs.Count + other.Count,
+		SumUs:   hs.SumUs + other.SumUs,
+		MinUs:   min(hs.MinUs, other.MinUs),
+		MaxUs:   max(hs.MaxUs, other.MaxUs),
+		Buckets: make([]HistogramBucket, 0, len(hs.Buckets)+len(other.Buckets)),
+	}
+
+	a, b := hs.Buckets, other.Buckets
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0].UpperBoundUs < b[0].UpperBoundUs:
+			merged.Buckets = append(merged.Buckets, a[0])
+			a = a[1:]
+		case a[0].UpperBoundUs > b[0].UpperBoundUs:
+			merged.Buckets = append(merged.Buckets, b[0])
+			b = b[1:]
+		default:
+			merged.Buckets = append(merged.Buckets, HistogramBucket{
+				UpperBoundUs: a[0].UpperBoundUs,
+				Count:        a[0].Count + b[0].Count,
+			})
+			a, b = a[1:], b[1:]
+		}
+	}
+	merged.Buckets = append(merged.Buckets, a...)
+	merged.Buckets = append(merged.Buckets, b...)
+	return merged
+}
+
+// Sub возвращает измерения, сделанные после prev, если hs получен позже из той же
+// гистограммы. Минимум и максимум интервала оцениваются по границам интервалов.
+func (hs HistogramSnapshot) Sub(prev HistogramSnapshot) HistogramSnapshot {
+	var diff HistogramSnapshot
+	p := prev.Buckets
+	for _, b := range hs.Buckets {
+		for len(p) > 0 && p[0].UpperBoundUs < b.UpperBoundUs {
+			p = p[1:]
+		}
+		n := b.Count
+		if len(p) > 0 && p[0].UpperBoundUs == b.UpperBoundUs {
+			n = counterDelta(b.Count, p[0].Count)
+		}
+		if n > 0 {
+			diff.Buckets = append(diff.Buckets, HistogramBucket{UpperBoundUs: b.UpperBoundUs, Count: n})
+			diff.Count += n
+		}
+	}
+	if diff.Count == 0 {
+		return HistogramSnapshot{}
+	}
+
+	diff.SumUs = counterDelta(hs.SumUs, prev.SumUs)
+	diff.MinUs = max(hs.MinUs, histLowerBound(diff.Buckets[0].UpperBoundUs))
+	diff.MaxUs = min(hs.MaxUs, diff.Buckets[len(diff.Buckets)-1].UpperBoundUs)
+	return diff
+}
+
+// histLowerBound возвращает наименьшее значение интервала с верхней границей upper
+func histLowerBound(upper uint64) uint64 {
+	idx := histIndex(upper)
+	if idx == 0 {
+		return 0
+	}
+	return histUpperBound(idx-1) + 1
+}
+
+func clampUint64(v, lo, hi uint64) uint64 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,197 @@
+package tcpconn
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// withinBucket сообщает, что got не меньше want и отличается не больше чем на ширину интервала
+func withinBucket(got, want uint64) bool {
+	return got >= want && float64(got-want) <= float64(want)/histSubBuckets
+}
+
+func TestLatencyHistogram_BucketBounds(t *testing.T) {
+	for v := uint64(0); v < 1<<20; v += 7 {
+		idx := histIndex(v)
+		upper := histUpperBound(idx)
+		if v > upper {
+			t.Fatalf("value %d above upper bound %d of bucket %d", v, upper, idx)
+		}
+		if idx > 0 && v <= histUpperBound(idx-1) {
+			t.Fatalf("value %d fits previous bucket %d", v, idx-1)
+		}
+		if v >= histSubBuckets && float64(upper-v) > float64(v)/histSubBuckets {
+			t.Fatalf("value %d: bucket upper bound %d exceeds relative error", v, upper)
+		}
+	}
+
+	if idx := histIndex(^uint64(0)); idx != histBuckets-1 {
+		t.Errorf("histIndex(max) = %d, want %d", idx, histBuckets-1)
+	}
+}
+
+func TestLatencyHistogram_Percentiles(t *testing.T) {
+	h := NewLatencyHistogram()
+	for v := uint64(1); v <= 10000; v++ {
+		h.Record(v)
+	}
+
+	snap := h.Snapshot()
+	if snap.Count != 10000 || snap.MinUs != 1 || snap.MaxUs != 10000 {
+		t.Fatalf("count/min/max = %d/%d/%d, want 10000/1/10000", snap.Count, snap.MinUs, snap.MaxUs)
+	}
+	if snap.Mean() != 5000 {
+		t.Errorf("Mean() = %d, want 5000", snap.Mean())
+	}
+
+	for _, tt := range []struct {
+		p    float64
+		want uint64
+	}{
+		{50, 5000},
+		{90, 9000},
+		{99, 9900},
+		{99.9, 9990},
+	} {
+		got := snap.Percentile(tt.p)
+		if !withinBucket(got, tt.want) {
+			t.Errorf("Percentile(%v) = %d, want %d within 1/%d", tt.p, got, tt.want, histSubBuckets)
+		}
+	}
+
+	if snap.Percentile(0) != 1 || snap.Percentile(100) != 10000 {
+		t.Errorf("Percentile(0)/Percentile(100) = %d/%d, want 1/10000", snap.Percentile(0), snap.Percentile(100))
+	}
+}
+
+func TestLatencyHistogram_TailNotHiddenByAverage(t *testing.T) {
+	h := NewLatencyHistogram()
+	for i := 0; i < 990; i++ {
+		h.Record(100)
+	}
+	for i := 0; i < 10; i++ {
+		h.Record(50000)
+	}
+
+	snap := h.Snapshot()
+	if p := snap.Percentile(50); !withinBucket(p, 100) {
+		t.Errorf("p50 = %d, want ~100", p)
+	}
+	if p := snap.Percentile(99.9); p != 50000 {
+		t.Errorf("p99.9 = %d, want 50000", p)
+	}
+}
+
+func TestHistogramSnapshot_Merge(t *testing.T) {
+	a, b, all := NewLatencyHistogram(), NewLatencyHistogram(), NewLatencyHistogram()
+	for v := uint64(1); v <= 5000; v++ {
+		if v%3 == 0 {
+			a.Record(v * 7)
+		} else {
+			b.Record(v)
+		}
+		all.Record(map[bool]uint64{true: v * 7, false: v}[v%3 == 0])
+	}
+
+	merged := a.Snapshot().Merge(b.Snapshot())
+	want := all.Snapshot()
+
+	if merged.Count != want.Count || merged.SumUs != want.SumUs ||
+		merged.MinUs != want.MinUs || merged.MaxUs != want.MaxUs {
+		t.Fatalf("merged = %+v, want count/sum/min/max of %+v", merged, want)
+	}
+	if len(merged.Buckets) != len(want.Buckets) {
+		t.Fatalf("merged has %d buckets, want %d", len(merged.Buckets), len(want.Buckets))
+	}
+	for i := range want.Buckets {
+		if merged.Buckets[i] != want.Buckets[i] {
+			t.Fatalf("bucket %d = %+v, want %+v", i, merged.Buckets[i], want.Buckets[i])
+		}
+	}
+
+	empty := HistogramSnapshot{}
+	if got := empty.Merge(want); got.Count != want.Count {
+		t.Errorf("empty.Merge(x).Count = %d, want %d", got.Count, want.Count)
+	}
+}
+
+func TestLatencyHistogram_Concurrent(t *testing.T) {
+	h := NewLatencyHistogram()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				h.Record(uint64(g*1000 + i))
+				if i%100 == 0 {
+					h.Snapshot().Percentile(99)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	snap := h.Snapshot()
+	if snap.Count != 8000 || snap.MinUs != 0 || snap.MaxUs != 7999 {
+		t.Errorf("count/min/max = %d/%d/%d, want 8000/0/7999", snap.Count, snap.MinUs, snap.MaxUs)
+	}
+}
+
+func TestStatistics_LatencyPercentiles(t *testing.T) {
+	stats := NewStatistics()
+	for v := uint64(1); v <= 1000; v++ {
+		stats.RecordLatency(v)
+	}
+
+	snap := stats.GetSnapshot()
+	if snap.P50LatencyUs < 500 || snap.P50LatencyUs > 520 {
+		t.Errorf("P50LatencyUs = %d, want ~500", snap.P50LatencyUs)
+	}
+	if snap.P999LatencyUs < 999 || snap.P999LatencyUs > 1000 {
+		t.Errorf("P999LatencyUs = %d, want ~999", snap.P999LatencyUs)
+	}
+	if got := stats.GetLatencyPercentile(90); got != snap.P90LatencyUs {
+		t.Errorf("GetLatencyPercentile(90) = %d, want %d", got, snap.P90LatencyUs)
+	}
+	if !strings.Contains(snap.String(), "P99.9:") {
+		t.Error("String() missing percentiles")
+	}
+
+	stats.Reset()
+	if snap := stats.GetSnapshot(); snap.P99LatencyUs != 0 || snap.LatencyCount != 0 {
+		t.Errorf("after Reset P99/count = %d/%d, want 0/0", snap.P99LatencyUs, snap.LatencyCount)
+	}
+}
+
+func TestMergeSnapshots_Percentiles(t *testing.T) {
+	fast, slow := NewStatistics(), NewStatistics()
+	for i := 0; i < 99; i++ {
+		fast.RecordLatency(100)
+	}
+	slow.RecordLatency(10000)
+
+	merged := MergeSnapshots(fast.GetSnapshot(), slow.GetSnapshot())
+	if !withinBucket(merged.P50LatencyUs, 100) {
+		t.Errorf("P50LatencyUs = %d, want ~100", merged.P50LatencyUs)
+	}
+	if merged.P999LatencyUs != 10000 {
+		t.Errorf("P999LatencyUs = %d, want 10000", merged.P999LatencyUs)
+	}
+	if merged.LatencyHistogram.Count != 100 {
+		t.Errorf("LatencyHistogram.Count = %d, want 100", merged.LatencyHistogram.Count)
+	}
+}
+
+func BenchmarkLatencyHistogram_Record(b *testing.B) {
+	h := NewLatencyHistogram()
+	b.RunParallel(func(pb *testing.PB) {
+		var v uint64
+		for pb.Next() {
+			v++
+			h.Record(v % 100000)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package tcpconn
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DefaultHistorySize - размер истории переходов по умолчанию
+const DefaultHistorySize = 100
+
+// TransitionMeta - необязательные сведения о причине перехода
+type TransitionMeta struct {
+	// Seq и Ack - номера сегмента, вызвавшего переход
+	Seq uint32
+	Ack uint32
+	// Reason - причина локального события (закрытие, таймаут, сброс)
+	Reason string
+	// Packet - краткое описание сегмента
+	Packet string
+}
+
+// IsZero сообщает, что сведения не заполнены
+func (m TransitionMeta) IsZero() bool {
+	return m == TransitionMeta{}
+}
+
+// String возвращает сведения в виде key=value
+func (m TransitionMeta) String() string {
+	var parts []string
+	if m.Seq != 0 || m.Ack != 0 {
+		parts = append(parts, fmt.Sprintf("seq=%d ack=%d", m.Seq, m.Ack))
+	}
+	if m.Reason != "" {
+		parts = append(parts, fmt.Sprintf("reason=%q", m.Reason))
+	}
+	if m.Packet != "" {
+		parts = append(parts, fmt.Sprintf("packet=%q", m.Packet))
+	}
+	return strings.Join(parts, " ")
+}
+
+// String возвращает переход в виде "15:04:05.000 FROM -> TO [EVENT] meta"
+func (t StateTransition) String() string {
+	s := fmt.Sprintf("%s -> %s [%s]", t.FromState, t.ToState, t.Event)
+	if !t.Time.IsZero() {
+		s = t.Time.Format("15:04:05.000") + " " + s
+	}
+	if !t.Meta.IsZero() {
+		s += " " + t.Meta.String()
+	}
+	return s
+}
+
+// TransitionObserver получает каждый успешный переход машины
+type TransitionObserver func(t StateTransition)
+
+// observer - зарегистрированный наблюдатель
+type observer struct {
+	id int
+	fn TransitionObserver
+}
+
+// historyRing - кольцевая история переходов фиксированного размера.
+// Буфер растет до size, затем самые старые записи перезаписываются.
+type historyRing struct {
+	buf   []StateTransition
+	start int // индекс самой старой записи, когда буфер заполнен
+	size  int
+}
+
+// push добавляет переход, вытесняя самый старый при переполнении
+func (r *historyRing) push(t StateTransition) {
+	if r.size <= 0 {
+		return
+	}
+	if len(r.buf) < r.size {
+		r.buf = append(r.buf, t)
+		return
+	}
+	r.buf[r.start] = t
+	r.start = (r.start + 1) % r.size
+}
+
+// snapshot возвращает копию истории от старых записей к новым
+func (r *historyRing) snapshot() []StateTransition {
+	out := make([]StateTransition, 0, len(r.buf))
+	out = append(out, r.buf[r.start:]...)
+	return append(out, r.buf[:r.start]...)
+}
+
+// resize меняет размер, сохраняя самые новые записи
+func (r *historyRing) resize(size int) {
+	entries := r.snapshot()
+	if size < 0 {
+		size = 0
+	}
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	r.buf, r.start, r.size = entries, 0, size
+}
+
+// clear удаляет все записи, сохраняя размер
+func (r *historyRing) clear() {
+	r.buf, r.start = nil, 0
+}
+
+// SetHistorySize задает число хранимых переходов; 0 отключает историю.
+// При уменьшении сохраняются самые новые записи.
+func (sm *TCPStateMachine) SetHistorySize(n int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.history.resize(n)
+}
+
+// HistorySize возвращает число хранимых переходов
+func (sm *TCPStateMachine) HistorySize() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.history.size
+}
+
+// AddObserver регистрирует наблюдателя переходов и возвращает функцию его удаления.
+// Наблюдатели вызываются по порядку регистрации после SetStateChangeCallback,
+// вне блокировки машины и в том же порядке, что и переходы.
+func (sm *TCPStateMachine) AddObserver(fn TransitionObserver) (remove func()) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.nextObserver++
+	id := sm.nextObserver
+	sm.observers = append(sm.observers, observer{id: id, fn: fn})
+
+	return func() {
+		sm.mu.Lock()
+		defer sm.mu.Unlock()
+		for i, o := range sm.observers {
+			if o.id == id {
+				sm.observers = append(sm.observers[:i:i], sm.observers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Subscribe возвращает канал переходов с буфером buffer и функцию отписки,
+// закрывающую канал. Если подписчик не успевает читать, переходы для него
+// отбрасываются, а не блокируют машину.
+func (sm *TCPStateMachine) Subscribe(buffer int) (<-chan StateTransition, func()) {
+	ch := make(chan StateTransition, buffer)
+
+	// Уведомление, поставленное в очередь до отписки, может прийти после нее
+	var mu sync.Mutex
+	closed := false
+	remove := sm.AddObserver(func(t StateTransition) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- t:
+		default:
+		}
+	})
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			remove()
+			mu.Lock()
+			closed = true
+			close(ch)
+			mu.Unlock()
+		})
+	}
+}
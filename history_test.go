@@ -0,0 +1,114 @@
+package tcpconn
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTCPStateMachine_HistoryRing(t *testing.T) {
+	sm := NewTCPStateMachine()
+	if sm.HistorySize() != DefaultHistorySize {
+		t.Errorf("HistorySize() = %d, want %d", sm.HistorySize(), DefaultHistorySize)
+	}
+	sm.SetHistorySize(3)
+
+	for i := 0; i < 4; i++ {
+		sm.ProcessEvent(ACTIVE_OPEN)
+		sm.ProcessEvent(CLOSE)
+	}
+
+	history := sm.GetHistory()
+	if len(history) != 3 {
+		t.Fatalf("len(GetHistory()) = %d, want 3", len(history))
+	}
+	// Самые новые записи в порядке поступления
+	want := []TCPEvent{CLOSE, ACTIVE_OPEN, CLOSE}
+	for i, tr := range history {
+		if tr.Event != want[i] {
+			t.Errorf("history[%d].Event = %s, want %s", i, tr.Event, want[i])
+		}
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].Time.Before(history[i-1].Time) {
+			t.Errorf("history[%d].Time before history[%d].Time", i, i-1)
+		}
+	}
+
+	// Уменьшение размера сохраняет последние записи
+	sm.SetHistorySize(1)
+	if h := sm.GetHistory(); len(h) != 1 || h[0].Event != CLOSE {
+		t.Errorf("GetHistory() after shrink = %v", h)
+	}
+
+	sm.SetHistorySize(0)
+	sm.ProcessEvent(ACTIVE_OPEN)
+	if h := sm.GetHistory(); len(h) != 0 {
+		t.Errorf("GetHistory() with size 0 = %v, want empty", h)
+	}
+
+	sm.SetHistorySize(2)
+	sm.ProcessEvent(SYN_ACK)
+	sm.ClearHistory()
+	if h := sm.GetHistory(); len(h) != 0 {
+		t.Errorf("GetHistory() after ClearHistory = %v, want empty", h)
+	}
+	if sm.HistorySize() != 2 {
+		t.Errorf("HistorySize() after ClearHistory = %d, want 2", sm.HistorySize())
+	}
+}
+
+func TestTCPStateMachine_ProcessEventWithMeta(t *testing.T) {
+	sm := NewTCPStateMachine()
+	before := time.Now()
+	meta := TransitionMeta{Seq: 100, Ack: 7, Reason: "dial", Packet: "SYN"}
+	if err := sm.ProcessEventWithMeta(ACTIVE_OPEN, meta); err != nil {
+		t.Fatalf("ProcessEventWithMeta() error = %v", err)
+	}
+
+	tr := sm.GetHistory()[0]
+	if tr.Meta != meta {
+		t.Errorf("Meta = %+v, want %+v", tr.Meta, meta)
+	}
+	if tr.Time.Before(before) || tr.Time.After(time.Now()) {
+		t.Errorf("Time = %v, want between %v and now", tr.Time, before)
+	}
+
+	s := tr.String()
+	for _, want := range []string{"CLOSED -> SYN_SENT [ACTIVE_OPEN]", "seq=100 ack=7", `reason="dial"`, `packet="SYN"`} {
+		if !strings.Contains(s, want) {
+			t.Errorf("String() = %q, missing %q", s, want)
+		}
+	}
+}
+
+func TestTCPStateMachine_Observers(t *testing.T) {
+	sm := NewTCPStateMachine()
+
+	var first, second []TCPState
+	removeFirst := sm.AddObserver(func(tr StateTransition) { first = append(first, tr.ToState) })
+	sm.AddObserver(func(tr StateTransition) { second = append(second, tr.ToState) })
+	ch, cancel := sm.Subscribe(1)
+
+	sm.ProcessEvent(ACTIVE_OPEN)
+	removeFirst()
+	sm.ProcessEvent(SYN_ACK)      // канал заполнен, переход для него отбрасывается
+	sm.ProcessEvent(PASSIVE_OPEN) // ошибка перехода наблюдателям не передается
+
+	if len(first) != 1 || first[0] != SYN_SENT {
+		t.Errorf("first observer = %v, want [SYN_SENT]", first)
+	}
+	if len(second) != 2 || second[1] != ESTABLISHED {
+		t.Errorf("second observer = %v, want [SYN_SENT ESTABLISHED]", second)
+	}
+
+	if tr := <-ch; tr.ToState != SYN_SENT {
+		t.Errorf("subscriber got %s, want SYN_SENT", tr.ToState)
+	}
+	cancel()
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Error("channel not closed after cancel")
+	}
+	sm.ProcessEvent(CLOSE) // после отписки не паникует на закрытом канале
+}
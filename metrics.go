@@ -0,0 +1,265 @@
+package tcpconn
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenMetricsContentType - тип содержимого ответа MetricsExporter
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Labels задаёт метки, которыми помечаются метрики источника
+type Labels map[string]string
+
+// MetricsCollector отдаёт снимки статистики с метками в момент сбора метрик.
+// Реализуется, например, слушателем, у которого набор соединений меняется.
+type MetricsCollector interface {
+	CollectSnapshots(emit func(labels Labels, snap Snapshot))
+}
+
+// MetricsCollectorFunc позволяет использовать функцию как MetricsCollector
+type MetricsCollectorFunc func(emit func(labels Labels, snap Snapshot))
+
+// CollectSnapshots вызывает f(emit)
+func (f MetricsCollectorFunc) CollectSnapshots(emit func(labels Labels, snap Snapshot)) {
+	f(emit)
+}
+
+// MetricsExporter отдаёт статистику в текстовом формате OpenMetrics
+// (совместим с Prometheus). Не зависит от клиентской библиотеки Prometheus.
+type MetricsExporter struct {
+	namespace  string
+	mu         sync.RWMutex
+	collectors map[string]MetricsCollector
+}
+
+// NewMetricsExporter создаёт экспортер; namespace становится префиксом имён
+// метрик, по умолчанию "tcpconn"
+func NewMetricsExporter(namespace string) *MetricsExporter {
+	if namespace == "" {
+		namespace = "tcpconn"
+	}
+	return &MetricsExporter{
+		namespace:  namespace,
+		collectors: make(map[string]MetricsCollector),
+	}
+}
+
+// Register добавляет источник под именем name, заменяя прежний с тем же именем
+func (e *MetricsExporter) Register(name string, c MetricsCollector) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.collectors[name] = c
+}
+
+// RegisterStatistics добавляет один объект Statistics с фиксированными метками
+func (e *MetricsExporter) RegisterStatistics(name string, labels Labels, s *Statistics) {
+	e.Register(name, MetricsCollectorFunc(func(emit func(Labels, Snapshot)) {
+		emit(labels, s.GetSnapshot())
+	}))
+}
+
+// Unregister удаляет источник
+func (e *MetricsExporter) Unregister(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.collectors, name)
+}
+
+// metricType - тип семейства метрик OpenMetrics
+type metricType string
+
+const (
+	metricCounter metricType = "counter"
+	metricGauge   metricType = "gauge"
+	metricSummary metricType = "summary"
+)
+
+// latencyQuantiles - квантили, экспортируемые в сводке задержек
+var latencyQuantiles = []float64{0.5, 0.9, 0.99, 0.999}
+
+// metricFamily описывает одну метрику и способ получить её значение из снимка
+type metricFamily struct {
+	name  string
+	typ   metricType
+	unit  string
+	help  string
+	value func(Snapshot) float64
+}
+
+var metricFamilies = []metricFamily{
+	{"packets_sent", metricCounter, "", "Packets sent.", func(s Snapshot) float64 { return float64(s.PacketsSent) }},
+	{"packets_received", metricCounter, "", "Packets received.", func(s Snapshot) float64 { return float64(s.PacketsReceived) }},
+	{"packets_lost", metricCounter, "", "Packets considered lost.", func(s Snapshot) float64 { return float64(s.PacketsLost) }},
+	{"packets_retried", metricCounter, "", "Packets retransmitted.", func(s Snapshot) float64 { return float64(s.PacketsRetried) }},
+	{"sent_bytes", metricCounter, "bytes", "Payload bytes sent.", func(s Snapshot) float64 { return float64(s.BytesSent) }},
+	{"received_bytes", metricCounter, "bytes", "Payload bytes received.", func(s Snapshot) float64 { return float64(s.BytesReceived) }},
+	{"errors", metricCounter, "", "Errors.", func(s Snapshot) float64 { return float64(s.Errors) }},
+	{"timeouts", metricCounter, "", "Timeouts.", func(s Snapshot) float64 { return float64(s.Timeouts) }},
+	{"resets", metricCounter, "", "Connection resets.", func(s Snapshot) float64 { return float64(s.Resets) }},
+	{"latency_samples", metricCounter, "", "Latency measurements taken.", func(s Snapshot) float64 { return float64(s.LatencyCount) }},
+	{"send_rate_bytes_per_second", metricGauge, "", "Current send rate in bytes per second.", func(s Snapshot) float64 { return s.SendRateBytesPerSec }},
+	{"receive_rate_bytes_per_second", metricGauge, "", "Current receive rate in bytes per second.", func(s Snapshot) float64 { return s.RecvRateBytesPerSec }},
+	{"send_rate_packets_per_second", metricGauge, "", "Current send rate in packets per second.", func(s Snapshot) float64 { return s.SendRatePacketsPerSec }},
+	{"receive_rate_packets_per_second", metricGauge, "", "Current receive rate in packets per second.", func(s Snapshot) float64 { return s.RecvRatePacketsPerSec }},
+	{"packet_loss_ratio", metricGauge, "", "Lost packets as a fraction of sent packets.", func(s Snapshot) float64 { return s.PacketLossRate / 100 }},
+	{"latency_min_seconds", metricGauge, "seconds", "Minimum observed latency.", func(s Snapshot) float64 { return usToSeconds(s.MinLatencyUs) }},
+	{"latency_avg_seconds", metricGauge, "seconds", "Average observed latency.", func(s Snapshot) float64 { return usToSeconds(s.AvgLatencyUs) }},
+	{"latency_max_seconds", metricGauge, "seconds", "Maximum observed latency.", func(s Snapshot) float64 { return usToSeconds(s.MaxLatencyUs) }},
+	{"uptime_seconds", metricGauge, "seconds", "Time since the statistics were created.", func(s Snapshot) float64 { return s.Uptime.Seconds() }},
+}
+
+func usToSeconds(us uint64) float64 {
+	return (time.Duration(us) * time.Microsecond).Seconds()
+}
+
+// labelledSnapshot - снимок вместе с отформатированными метками
+type labelledSnapshot struct {
+	labels string
+	snap   Snapshot
+}
+
+// collect опрашивает все источники и сортирует результат по меткам
+func (e *MetricsExporter) collect() []labelledSnapshot {
+	e.mu.RLock()
+	names := make([]string, 0, len(e.collectors))
+	for name := range e.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]MetricsCollector, len(names))
+	for i, name := range names {
+		collectors[i] = e.collectors[name]
+	}
+	e.mu.RUnlock()
+
+	var out []labelledSnapshot
+	for _, c := range collectors {
+		c.CollectSnapshots(func(labels Labels, snap Snapshot) {
+			out = append(out, labelledSnapshot{labels: formatLabels(labels), snap: snap})
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].labels < out[j].labels })
+	return out
+}
+
+// WriteTo пишет все метрики в формате OpenMetrics, завершая вывод "# EOF"
+func (e *MetricsExporter) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	snaps := e.collect()
+
+	for _, f := range metricFamilies {
+		name := e.namespace + "_" + f.name
+		cw.writeStrings("# TYPE ", name, " ", string(f.typ), "\n")
+		if f.unit != "" {
+			cw.writeStrings("# UNIT ", name, " ", f.unit, "\n")
+		}
+		cw.writeStrings("# HELP ", name, " ", f.help, "\n")
+
+		sample := name
+		if f.typ == metricCounter {
+			sample += "_total"
+		}
+		for _, ls := range snaps {
+			cw.writeStrings(sample, ls.labels, " ", formatFloat(f.value(ls.snap)), "\n")
+		}
+	}
+	e.writeLatencySummary(cw, snaps)
+	cw.writeStrings("# EOF\n")
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// writeLatencySummary пишет сводку задержек с квантилями по гистограмме снимка
+func (e *MetricsExporter) writeLatencySummary(cw *countingWriter, snaps []labelledSnapshot) {
+	name := e.namespace + "_latency_seconds"
+	cw.writeStrings("# TYPE ", name, " ", string(metricSummary), "\n")
+	cw.writeStrings("# UNIT ", name, " seconds\n")
+	cw.writeStrings("# HELP ", name, " Latency quantiles.\n")
+
+	for _, ls := range snaps {
+		hist := ls.snap.LatencyHistogram
+		for _, q := range latencyQuantiles {
+			labels := withLabel(ls.labels, "quantile", strconv.FormatFloat(q, 'g', -1, 64))
+			cw.writeStrings(name, labels, " ", formatFloat(usToSeconds(hist.Percentile(q*100))), "\n")
+		}
+		cw.writeStrings(name, "_sum", ls.labels, " ", formatFloat(usToSeconds(hist.SumUs)), "\n")
+		cw.writeStrings(name, "_count", ls.labels, " ", strconv.FormatUint(hist.Count, 10), "\n")
+	}
+}
+
+// ServeHTTP отдаёт метрики, позволяя смонтировать экспортер на /metrics
+func (e *MetricsExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", OpenMetricsContentType)
+	e.WriteTo(w)
+}
+
+// formatLabels форматирует метки как {a="1",b="2"} в порядке ключей
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(labels[k]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// withLabel добавляет метку к уже отформатированному набору меток
+func withLabel(labels, key, value string) string {
+	pair := key + `="` + labelValueEscaper.Replace(value) + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// countingWriter запоминает первую ошибку и число записанных байт
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// writeStrings записывает части подряд без форматирования
+func (cw *countingWriter) writeStrings(parts ...string) {
+	for _, p := range parts {
+		if cw.err != nil {
+			return
+		}
+		n, err := cw.w.WriteString(p)
+		cw.n += int64(n)
+		cw.err = err
+	}
+}
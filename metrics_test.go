@@ -0,0 +1,123 @@
+package tcpconn
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, h http.Handler) string {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != OpenMetricsContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, OpenMetricsContentType)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading body failed: %v", err)
+	}
+	return string(body)
+}
+
+func TestMetricsExporter_Scrape(t *testing.T) {
+	stats := NewStatistics()
+	stats.RecordPacketSent(1000)
+	stats.RecordPacketSent(500)
+	stats.RecordPacketLost()
+	stats.RecordPacketRetried()
+	stats.RecordLatency(2000)
+
+	exporter := NewMetricsExporter("")
+	exporter.RegisterStatistics("conn", Labels{"conn": "a"}, stats)
+
+	body := scrape(t, exporter)
+
+	for _, want := range []string{
+		"# TYPE tcpconn_packets_sent counter\n",
+		`tcpconn_packets_sent_total{conn="a"} 2` + "\n",
+		"# TYPE tcpconn_sent_bytes counter\n# UNIT tcpconn_sent_bytes bytes\n",
+		`tcpconn_sent_bytes_total{conn="a"} 1500` + "\n",
+		`tcpconn_packets_lost_total{conn="a"} 1` + "\n",
+		`tcpconn_packets_retried_total{conn="a"} 1` + "\n",
+		"# TYPE tcpconn_packet_loss_ratio gauge\n",
+		`tcpconn_packet_loss_ratio{conn="a"} 0.5` + "\n",
+		`tcpconn_latency_max_seconds{conn="a"} 0.002` + "\n",
+		`tcpconn_latency_samples_total{conn="a"} 1` + "\n",
+		"# TYPE tcpconn_latency_seconds summary\n",
+		`tcpconn_latency_seconds{conn="a",quantile="0.99"} 0.002` + "\n",
+		`tcpconn_latency_seconds_count{conn="a"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("scrape missing %q", want)
+		}
+	}
+
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Error("scrape does not end with # EOF")
+	}
+}
+
+func TestMetricsExporter_Collector(t *testing.T) {
+	a, b := NewStatistics(), NewStatistics()
+	a.RecordError()
+	b.RecordTimeout()
+
+	exporter := NewMetricsExporter("test")
+	exporter.Register("pool", MetricsCollectorFunc(func(emit func(Labels, Snapshot)) {
+		emit(Labels{"conn": "b"}, b.GetSnapshot())
+		emit(Labels{"conn": "a"}, a.GetSnapshot())
+	}))
+
+	body := scrape(t, exporter)
+
+	// Samples are ordered by labels regardless of emission order
+	ia := strings.Index(body, `test_errors_total{conn="a"} 1`)
+	ib := strings.Index(body, `test_errors_total{conn="b"} 0`)
+	if ia < 0 || ib < 0 || ia > ib {
+		t.Errorf("errors samples missing or out of order:\n%s", body)
+	}
+	if !strings.Contains(body, `test_timeouts_total{conn="b"} 1`) {
+		t.Error("timeouts sample for b missing")
+	}
+
+	exporter.Unregister("pool")
+	body = scrape(t, exporter)
+	if strings.Contains(body, "test_errors_total{") {
+		t.Error("samples remain after Unregister")
+	}
+	if strings.Count(body, "# TYPE test_errors counter") != 1 {
+		t.Error("metric family metadata missing after Unregister")
+	}
+}
+
+func TestMetricsExporter_LabelEscaping(t *testing.T) {
+	exporter := NewMetricsExporter("")
+	exporter.RegisterStatistics("x", Labels{"peer": "a\"b\\c\nd"}, NewStatistics())
+
+	var buf bytes.Buffer
+	n, err := exporter.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, buf.Len())
+	}
+
+	want := `tcpconn_resets_total{peer="a\"b\\c\nd"} 0`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("output missing %q", want)
+	}
+}
@@ -0,0 +1,78 @@
+package tcpconn
+
+// notification - отложенный вызов callback'ов для одного события.
+// Callback'и фиксируются в момент перехода, чтобы смена callback'а не
+// влияла на уже произошедшие события.
+type notification struct {
+	transition StateTransition
+	onChange   StateChangeCallback
+	observers  []observer
+
+	state   TCPState
+	event   TCPEvent
+	err     error
+	onError ErrorCallback
+}
+
+// run вызывает callback'и уведомления
+func (n notification) run() {
+	if n.err != nil {
+		n.onError(n.state, n.event, n.err)
+		return
+	}
+	t := n.transition
+	if n.onChange != nil {
+		n.onChange(t.FromState, t.ToState, t.Event)
+	}
+	for _, o := range n.observers {
+		o.fn(t)
+	}
+}
+
+// enqueue ставит уведомление в очередь. Вызывается под sm.mu.
+func (sm *TCPStateMachine) enqueue(n notification) {
+	sm.queue = append(sm.queue, n)
+}
+
+// claimDelivery делает вызывающего доставщиком очереди, если доставка еще
+// не идет. Вызывается под sm.mu.
+func (sm *TCPStateMachine) claimDelivery() bool {
+	if sm.delivering || sm.queueHead == len(sm.queue) {
+		return false
+	}
+	sm.delivering = true
+	return true
+}
+
+// deliver вызывает уведомления по одному, снимая блокировку на время вызова.
+// Доставщик в каждый момент один, поэтому порядок вызовов совпадает с
+// порядком переходов, а события из callback'ов доставляются после текущего.
+func (sm *TCPStateMachine) deliver() {
+	done := false
+	defer func() {
+		// Паника в callback'е не должна навсегда остановить доставку
+		if !done {
+			sm.mu.Lock()
+			sm.delivering = false
+			sm.mu.Unlock()
+		}
+	}()
+
+	for {
+		sm.mu.Lock()
+		if sm.queueHead == len(sm.queue) {
+			clear(sm.queue)
+			sm.queue, sm.queueHead = sm.queue[:0], 0
+			sm.delivering = false
+			done = true
+			sm.mu.Unlock()
+			return
+		}
+		n := sm.queue[sm.queueHead]
+		sm.queue[sm.queueHead] = notification{}
+		sm.queueHead++
+		sm.mu.Unlock()
+
+		n.run()
+	}
+}
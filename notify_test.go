@@ -0,0 +1,134 @@
+package tcpconn
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTCPStateMachine_CallbackReentrant(t *testing.T) {
+	sm := NewTCPStateMachine()
+
+	var seen []string
+	sm.SetStateChangeCallback(func(oldState, newState TCPState, event TCPEvent) {
+		// Методы машины доступны из callback'а
+		seen = append(seen, newState.String()+"/"+sm.GetState().String())
+		if newState == SYN_SENT {
+			if err := sm.ProcessEvent(SYN_ACK); err != nil {
+				t.Errorf("nested ProcessEvent() error = %v", err)
+			}
+			if !sm.IsConnected() {
+				t.Error("IsConnected() = false after nested SYN_ACK")
+			}
+		}
+	})
+	errs := 0
+	sm.SetErrorCallback(func(state TCPState, event TCPEvent, err error) {
+		errs++
+		if sm.GetState() != state {
+			t.Errorf("GetState() in error callback = %s, want %s", sm.GetState(), state)
+		}
+	})
+
+	if err := sm.ProcessEvent(ACTIVE_OPEN); err != nil {
+		t.Fatalf("ProcessEvent() error = %v", err)
+	}
+	sm.ProcessEvent(ACTIVE_OPEN)
+
+	// Вложенное событие доставляется после текущего
+	want := []string{"SYN_SENT/SYN_SENT", "ESTABLISHED/ESTABLISHED"}
+	if len(seen) != len(want) || seen[0] != want[0] || seen[1] != want[1] {
+		t.Errorf("callbacks = %v, want %v", seen, want)
+	}
+	if errs != 1 {
+		t.Errorf("error callbacks = %d, want 1", errs)
+	}
+}
+
+func TestTCPStateMachine_CallbackOrder(t *testing.T) {
+	const ping, pong TCPState = 200, 201
+	const flip TCPEvent = 200
+	table := NewTransitionTable("flip", ping).Add(
+		Transition{From: ping, Event: flip, To: pong},
+		Transition{From: pong, Event: flip, To: ping},
+	)
+	sm := NewTCPStateMachineFromTable(table)
+
+	var mu sync.Mutex
+	var got []StateTransition
+	sm.AddObserver(func(tr StateTransition) {
+		mu.Lock()
+		got = append(got, tr)
+		mu.Unlock()
+	})
+
+	const workers, events = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < events; i++ {
+				sm.ProcessEvent(flip)
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != workers*events {
+		t.Fatalf("observed %d transitions, want %d", len(got), workers*events)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].FromState != got[i-1].ToState {
+			t.Fatalf("transition %d from %d, previous ended in %d", i, got[i].FromState, got[i-1].ToState)
+		}
+	}
+}
+
+func TestTCPStateMachine_ProcessEventCtx(t *testing.T) {
+	sm := NewTCPStateMachine()
+
+	state, err := sm.ProcessEventCtx(context.Background(), PASSIVE_OPEN)
+	if err != nil || state != LISTEN {
+		t.Errorf("ProcessEventCtx() = %s, %v; want LISTEN", state, err)
+	}
+
+	state, err = sm.ProcessEventCtx(context.Background(), ACK)
+	if !errors.Is(err, ErrInvalidTransition) || state != LISTEN {
+		t.Errorf("ProcessEventCtx(invalid) = %s, %v; want LISTEN, ErrInvalidTransition", state, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	state, err = sm.ProcessEventCtx(ctx, SYN)
+	if !errors.Is(err, context.Canceled) || state != LISTEN {
+		t.Errorf("ProcessEventCtx(canceled) = %s, %v; want LISTEN, context.Canceled", state, err)
+	}
+	if len(sm.GetHistory()) != 1 {
+		t.Errorf("canceled event reached the machine: %v", sm.GetHistory())
+	}
+}
+
+func TestTCPStateMachine_CallbackPanic(t *testing.T) {
+	sm := NewTCPStateMachine()
+	calls := 0
+	sm.SetStateChangeCallback(func(oldState, newState TCPState, event TCPEvent) {
+		calls++
+		if newState == SYN_SENT {
+			panic("boom")
+		}
+	})
+
+	func() {
+		defer func() { recover() }()
+		sm.ProcessEvent(ACTIVE_OPEN)
+	}()
+	sm.ProcessEvent(SYN_ACK)
+
+	if calls != 2 {
+		t.Errorf("callbacks = %d, want 2 (delivery must survive a panic)", calls)
+	}
+}
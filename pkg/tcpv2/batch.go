@@ -0,0 +1,225 @@
+package tcpv2
+
+import (
+	"errors"
+	"net"
+
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	// DefaultBatchSize is the number of datagrams moved per recvmmsg/sendmmsg call
+	DefaultBatchSize = 32
+
+	maxDatagramSize = 65535
+	// Ядро принимает не больше 64 сегментов в одном GSO-вызове
+	maxGSOSegments = 64
+)
+
+// datagramReader delivers received datagrams to fn, one or many per system call.
+// data is only valid until fn returns.
+type datagramReader interface {
+	ReadDatagrams(fn func(data []byte, addr net.Addr)) error
+}
+
+// newDatagramReader picks the batched reader when enabled and supported by conn
+func newDatagramReader(conn net.PacketConn, opts Options) datagramReader {
+	if opts.BatchIO {
+		if udp, ok := conn.(*net.UDPConn); ok {
+			return newBatchReader(udp, opts.batchSize())
+		}
+	}
+	return &singleReader{conn: conn, buf: make([]byte, maxDatagramSize)}
+}
+
+// singleReader reads one datagram per ReadFrom call
+type singleReader struct {
+	conn net.PacketConn
+	buf  []byte
+}
+
+func (r *singleReader) ReadDatagrams(fn func(data []byte, addr net.Addr)) error {
+	n, addr, err := r.conn.ReadFrom(r.buf)
+	if err != nil {
+		return err
+	}
+	fn(r.buf[:n], addr)
+	return nil
+}
+
+// batchReader reads up to len(msgs) datagrams per recvmmsg call and splits
+// GRO-coalesced datagrams back into segments
+type batchReader struct {
+	pc   *ipv4.PacketConn
+	msgs []ipv4.Message
+	gro  bool
+}
+
+func newBatchReader(conn *net.UDPConn, size int) *batchReader {
+	r := &batchReader{
+		pc:   ipv4.NewPacketConn(conn),
+		msgs: make([]ipv4.Message, size),
+		gro:  enableGRO(conn),
+	}
+	for i := range r.msgs {
+		r.msgs[i].Buffers = [][]byte{make([]byte, maxDatagramSize)}
+		if r.gro {
+			r.msgs[i].OOB = make([]byte, groControlSize)
+		}
+	}
+	return r
+}
+
+func (r *batchReader) ReadDatagrams(fn func(data []byte, addr net.Addr)) error {
+	n, err := r.pc.ReadBatch(r.msgs, 0)
+	if err != nil {
+		return err
+	}
+
+	for i := range r.msgs[:n] {
+		msg := &r.msgs[i]
+		data := msg.Buffers[0][:msg.N]
+
+		segSize := 0
+		if r.gro {
+			segSize = groSegmentSize(msg.OOB[:msg.NN])
+		}
+		if segSize <= 0 || segSize >= len(data) {
+			fn(data, msg.Addr)
+			continue
+		}
+
+		for len(data) > 0 {
+			seg := min(segSize, len(data))
+			fn(data[:seg], msg.Addr)
+			data = data[seg:]
+		}
+	}
+
+	return nil
+}
+
+// batchWriter sends the segments of one Conn.Write with sendmmsg or a
+// single UDP GSO send
+type batchWriter struct {
+	pc   *ipv4.PacketConn
+	addr net.Addr
+	gso  bool
+	size int
+
+	msgs []ipv4.Message
+	bufs [][]byte
+
+	gsoMsgs []ipv4.Message
+	gsoBuf  []byte
+}
+
+// newBatchWriter returns nil when batching is disabled or conn is not UDP
+func newBatchWriter(conn net.PacketConn, addr net.Addr, opts Options) *batchWriter {
+	if !opts.BatchIO {
+		return nil
+	}
+	udp, ok := conn.(*net.UDPConn)
+	if !ok {
+		return nil
+	}
+	return &batchWriter{
+		pc:   ipv4.NewPacketConn(udp),
+		addr: addr,
+		gso:  gsoSupported(udp),
+		size: opts.batchSize(),
+	}
+}
+
+// maxSegments returns how many MSS sized segments one send can carry
+func (w *batchWriter) maxSegments() int {
+	if w.gso {
+		return min(maxGSOSegments, (maxDatagramSize-28)/(tcpHeaderLen+MSS))
+	}
+	return w.size
+}
+
+// send encodes pkts and writes them to the peer, returning how many were sent
+func (w *batchWriter) send(pseudo uint64, pkts []*Packet) (int, error) {
+	if w.gso && len(pkts) > 1 && uniformSegments(pkts) {
+		err := w.sendGSO(pseudo, pkts)
+		if err == nil {
+			return len(pkts), nil
+		}
+		if !errors.Is(err, errGSOUnavailable) {
+			return 0, err
+		}
+		// Сетевое устройство не поддерживает GSO, переходим на sendmmsg
+		w.gso = false
+	}
+	return w.sendMmsg(pseudo, pkts)
+}
+
+func (w *batchWriter) sendGSO(pseudo uint64, pkts []*Packet) error {
+	if w.gsoBuf == nil {
+		w.gsoBuf = make([]byte, maxDatagramSize)
+		w.gsoMsgs = []ipv4.Message{{
+			Buffers: make([][]byte, 1),
+			OOB:     gsoControl(tcpHeaderLen + MSS),
+			Addr:    w.addr,
+		}}
+	}
+
+	total := 0
+	for _, p := range pkts {
+		n, err := p.encodeTo(w.gsoBuf[total:], pseudo)
+		if err != nil {
+			return err
+		}
+		total += n
+	}
+
+	w.gsoMsgs[0].Buffers[0] = w.gsoBuf[:total]
+	_, err := w.pc.WriteBatch(w.gsoMsgs, 0)
+	return classifyGSOError(err)
+}
+
+// uniformSegments reports whether every segment but the last carries a full
+// MSS, which UDP GSO requires
+func uniformSegments(pkts []*Packet) bool {
+	for _, p := range pkts[:len(pkts)-1] {
+		if len(p.Payload) != MSS || len(p.TCP.Options) > 0 {
+			return false
+		}
+	}
+	return len(pkts[len(pkts)-1].TCP.Options) == 0
+}
+
+func (w *batchWriter) sendMmsg(pseudo uint64, pkts []*Packet) (int, error) {
+	if len(w.msgs) < len(pkts) {
+		w.msgs = make([]ipv4.Message, len(pkts))
+		w.bufs = make([][]byte, len(pkts))
+		for i := range w.bufs {
+			w.bufs[i] = make([]byte, MTU)
+			w.msgs[i] = ipv4.Message{Buffers: make([][]byte, 1), Addr: w.addr}
+		}
+	}
+
+	msgs := w.msgs[:len(pkts)]
+	for i, p := range pkts {
+		buf := w.bufs[i]
+		if need := tcpMaxHeaderLen + len(p.Payload); need > len(buf) {
+			buf = make([]byte, need)
+		}
+		n, err := p.encodeTo(buf, pseudo)
+		if err != nil {
+			return 0, err
+		}
+		msgs[i].Buffers[0] = buf[:n]
+	}
+
+	sent := 0
+	for sent < len(msgs) {
+		n, err := w.pc.WriteBatch(msgs[sent:], 0)
+		if err != nil {
+			return sent, err
+		}
+		sent += n
+	}
+	return sent, nil
+}
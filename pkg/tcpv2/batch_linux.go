@@ -0,0 +1,87 @@
+//go:build linux
+
+package tcpv2
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+var groControlSize = unix.CmsgSpace(4)
+
+// errGSOUnavailable signals that the segments must be resent without UDP GSO
+var errGSOUnavailable = errors.New("UDP GSO unavailable")
+
+// enableGRO turns on UDP_GRO so the kernel may coalesce received segments
+func enableGRO(conn *net.UDPConn) bool {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.IPPROTO_UDP, unix.UDP_GRO, 1)
+	}); err != nil {
+		return false
+	}
+	return serr == nil
+}
+
+// gsoSupported reports whether the kernel accepts UDP_SEGMENT on conn
+func gsoSupported(conn *net.UDPConn) bool {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		_, serr = unix.GetsockoptInt(int(fd), unix.IPPROTO_UDP, unix.UDP_SEGMENT)
+	}); err != nil {
+		return false
+	}
+	return serr == nil
+}
+
+// gsoControl builds the UDP_SEGMENT control message for segSize sized segments
+func gsoControl(segSize int) []byte {
+	oob := make([]byte, unix.CmsgSpace(2))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level = unix.IPPROTO_UDP
+	h.Type = unix.UDP_SEGMENT
+	h.SetLen(unix.CmsgLen(2))
+	binary.NativeEndian.PutUint16(oob[unix.CmsgLen(0):], uint16(segSize))
+	return oob
+}
+
+// groSegmentSize extracts the segment size from a UDP_GRO control message,
+// or returns 0 when the datagram was not coalesced
+func groSegmentSize(oob []byte) int {
+	for len(oob) >= unix.CmsgLen(0) {
+		h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		hdrLen := int(h.Len)
+		if hdrLen < unix.CmsgLen(0) || hdrLen > len(oob) {
+			return 0
+		}
+		if h.Level == unix.IPPROTO_UDP && h.Type == unix.UDP_GRO && hdrLen >= unix.CmsgLen(4) {
+			return int(binary.NativeEndian.Uint32(oob[unix.CmsgLen(0):]))
+		}
+		next := unix.CmsgSpace(hdrLen - unix.CmsgLen(0))
+		if next > len(oob) {
+			return 0
+		}
+		oob = oob[next:]
+	}
+	return 0
+}
+
+// classifyGSOError maps errors caused by missing GSO offload to errGSOUnavailable
+func classifyGSOError(err error) error {
+	if errors.Is(err, unix.EIO) || errors.Is(err, unix.EINVAL) {
+		return errGSOUnavailable
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+//go:build linux
+
+package tcpv2
+
+import (
+	"encoding/binary"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestGROSegmentSize(t *testing.T) {
+	oob := make([]byte, groControlSize)
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level = unix.IPPROTO_UDP
+	h.Type = unix.UDP_GRO
+	h.SetLen(unix.CmsgLen(4))
+	binary.NativeEndian.PutUint32(oob[unix.CmsgLen(0):], 1472)
+
+	require.Equal(t, 1472, groSegmentSize(oob))
+	require.Zero(t, groSegmentSize(nil))
+	require.Zero(t, groSegmentSize(gsoControl(1472)), "UDP_SEGMENT is not a GRO message")
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package tcpv2
+
+import (
+	"errors"
+	"net"
+)
+
+const groControlSize = 0
+
+var errGSOUnavailable = errors.New("UDP GSO unavailable")
+
+func enableGRO(conn *net.UDPConn) bool    { return false }
+func gsoSupported(conn *net.UDPConn) bool { return false }
+func gsoControl(segSize int) []byte       { return nil }
+func groSegmentSize(oob []byte) int       { return 0 }
+func classifyGSOError(err error) error    { return err }
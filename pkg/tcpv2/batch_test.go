@@ -0,0 +1,92 @@
+package tcpv2
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// dialPair establishes a connection over loopback using opts on both ends
+func dialPair(tb testing.TB, opts Options) (*Listener, net.Conn, *Conn) {
+	l, err := ListenWithOptions("127.0.0.1:0", opts)
+	require.NoError(tb, err)
+
+	accepted := make(chan *Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	client, err := DialWithOptions(l.Addr().String(), opts)
+	require.NoError(tb, err)
+
+	return l, client, <-accepted
+}
+
+func TestBatchIO_Transfer(t *testing.T) {
+	l, client, server := dialPair(t, Options{BatchIO: true, BatchSize: 8})
+	defer l.Close()
+	defer client.Close()
+
+	require.NotNil(t, server.batch)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 2500) // 40000 bytes, 28 segments
+	n, err := client.Write(data)
+	require.NoError(t, err)
+	require.Equal(t, len(data), n)
+
+	buf := make([]byte, len(data))
+	_, err = io.ReadFull(server, buf)
+	require.NoError(t, err)
+	require.Equal(t, data, buf)
+}
+
+func TestBatchIO_DisabledByDefault(t *testing.T) {
+	mockConn := NewMockPacketConn()
+	remoteAddr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1").To4(), Port: 12345}
+
+	c := newConn(mockConn, remoteAddr, Options{BatchIO: true})
+	defer c.Close()
+
+	// Mock is not a *net.UDPConn, so batching falls back to the plain path
+	require.Nil(t, c.batch)
+	require.IsType(t, &singleReader{}, newDatagramReader(mockConn, Options{BatchIO: true}))
+}
+
+func BenchmarkThroughput_Loopback(b *testing.B) {
+	modes := []struct {
+		name string
+		opts Options
+	}{
+		{"Default", Options{}},
+		{"BatchIO", Options{BatchIO: true}},
+	}
+
+	const chunk = 32 * 1024
+	data := bytes.Repeat([]byte{0xAB}, chunk)
+
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			l, client, server := dialPair(b, mode.opts)
+			defer l.Close()
+			defer client.Close()
+
+			buf := make([]byte, chunk)
+			b.SetBytes(chunk)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.Write(data); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.ReadFull(server, buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
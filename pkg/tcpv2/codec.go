@@ -0,0 +1,240 @@
+package tcpv2
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Hand-rolled segment codec used on the hot path. It writes into caller or
+// pooled buffers and never allocates; Packet.Encode and DecodePacket stay on
+// gopacket as the compatibility/debug codec.
+
+const (
+	flagFIN = 1 << 0
+	flagSYN = 1 << 1
+	flagRST = 1 << 2
+	flagPSH = 1 << 3
+	flagACK = 1 << 4
+	flagURG = 1 << 5
+	flagECE = 1 << 6
+	flagCWR = 1 << 7
+)
+
+// segmentPool holds MTU sized buffers for outgoing segments
+var segmentPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, MTU)
+		return &b
+	},
+}
+
+func getSegmentBuffer() *[]byte  { return segmentPool.Get().(*[]byte) }
+func putSegmentBuffer(b *[]byte) { segmentPool.Put(b) }
+
+// EncodeTo writes the segment into buf without allocating and returns the
+// number of bytes written. buf must fit the header, options and payload.
+func (p *Packet) EncodeTo(buf []byte, srcIP, dstIP net.IP) (int, error) {
+	srcIPv4 := srcIP.To4()
+	dstIPv4 := dstIP.To4()
+	if srcIPv4 == nil || dstIPv4 == nil {
+		return 0, ErrIPv4Only
+	}
+	return p.encodeTo(buf, pseudoHeaderSum(srcIPv4, dstIPv4))
+}
+
+// encodeTo writes the segment using a precomputed pseudo-header sum
+func (p *Packet) encodeTo(buf []byte, pseudo uint64) (int, error) {
+	tcp := p.TCP
+
+	optLen := 0
+	for _, opt := range tcp.Options {
+		optLen += optionWireLen(opt)
+	}
+	hdrLen := tcpHeaderLen + (optLen+3)&^3
+	if hdrLen > tcpMaxHeaderLen {
+		return 0, ErrBadOptions
+	}
+
+	total := hdrLen + len(p.Payload)
+	if len(buf) < total {
+		return 0, io.ErrShortBuffer
+	}
+
+	binary.BigEndian.PutUint16(buf[0:2], uint16(tcp.SrcPort))
+	binary.BigEndian.PutUint16(buf[2:4], uint16(tcp.DstPort))
+	binary.BigEndian.PutUint32(buf[4:8], tcp.Seq)
+	binary.BigEndian.PutUint32(buf[8:12], tcp.Ack)
+	buf[12] = byte(hdrLen/4) << 4
+	if tcp.NS {
+		buf[12] |= 1
+	}
+	buf[13] = encodeFlags(tcp)
+	binary.BigEndian.PutUint16(buf[14:16], tcp.Window)
+	buf[16], buf[17] = 0, 0
+	binary.BigEndian.PutUint16(buf[18:20], tcp.Urgent)
+
+	off := tcpHeaderLen
+	for _, opt := range tcp.Options {
+		off += putOption(buf[off:], opt)
+	}
+	for ; off < hdrLen; off++ {
+		buf[off] = 0
+	}
+
+	copy(buf[hdrLen:], p.Payload)
+
+	sum := checksumAdd(pseudo+uint64(total), buf[:total])
+	binary.BigEndian.PutUint16(buf[16:18], checksumFold(sum))
+
+	return total, nil
+}
+
+// DecodeInto decodes data into p without allocating. p.TCP is reused when
+// set and p.Payload aliases data, so the caller must copy it before data is
+// reused. Options are not materialized; DecodePacketFrom validates and
+// returns them.
+func DecodeInto(data []byte, p *Packet) error {
+	if len(data) < tcpHeaderLen {
+		return ErrTruncated
+	}
+	hdrLen := int(data[12]>>4) * 4
+	if hdrLen < tcpHeaderLen {
+		return ErrBadHeader
+	}
+	if hdrLen > len(data) {
+		return ErrTruncated
+	}
+
+	if p.TCP == nil {
+		p.TCP = &layers.TCP{}
+	}
+	tcp := p.TCP
+	flags := data[13]
+
+	tcp.SrcPort = layers.TCPPort(binary.BigEndian.Uint16(data[0:2]))
+	tcp.DstPort = layers.TCPPort(binary.BigEndian.Uint16(data[2:4]))
+	tcp.Seq = binary.BigEndian.Uint32(data[4:8])
+	tcp.Ack = binary.BigEndian.Uint32(data[8:12])
+	tcp.DataOffset = data[12] >> 4
+	tcp.NS = data[12]&1 != 0
+	tcp.FIN = flags&flagFIN != 0
+	tcp.SYN = flags&flagSYN != 0
+	tcp.RST = flags&flagRST != 0
+	tcp.PSH = flags&flagPSH != 0
+	tcp.ACK = flags&flagACK != 0
+	tcp.URG = flags&flagURG != 0
+	tcp.ECE = flags&flagECE != 0
+	tcp.CWR = flags&flagCWR != 0
+	tcp.Window = binary.BigEndian.Uint16(data[14:16])
+	tcp.Checksum = binary.BigEndian.Uint16(data[16:18])
+	tcp.Urgent = binary.BigEndian.Uint16(data[18:20])
+	tcp.Options = tcp.Options[:0]
+	tcp.Contents = data[:hdrLen]
+	tcp.Payload = data[hdrLen:]
+
+	p.Payload = tcp.Payload
+	return nil
+}
+
+func encodeFlags(tcp *layers.TCP) byte {
+	var f byte
+	if tcp.FIN {
+		f |= flagFIN
+	}
+	if tcp.SYN {
+		f |= flagSYN
+	}
+	if tcp.RST {
+		f |= flagRST
+	}
+	if tcp.PSH {
+		f |= flagPSH
+	}
+	if tcp.ACK {
+		f |= flagACK
+	}
+	if tcp.URG {
+		f |= flagURG
+	}
+	if tcp.ECE {
+		f |= flagECE
+	}
+	if tcp.CWR {
+		f |= flagCWR
+	}
+	return f
+}
+
+func optionWireLen(opt layers.TCPOption) int {
+	switch opt.OptionType {
+	case layers.TCPOptionKindEndList, layers.TCPOptionKindNop:
+		return 1
+	}
+	return 2 + len(opt.OptionData)
+}
+
+func putOption(buf []byte, opt layers.TCPOption) int {
+	buf[0] = byte(opt.OptionType)
+	switch opt.OptionType {
+	case layers.TCPOptionKindEndList, layers.TCPOptionKindNop:
+		return 1
+	}
+	buf[1] = byte(2 + len(opt.OptionData))
+	copy(buf[2:], opt.OptionData)
+	return 2 + len(opt.OptionData)
+}
+
+// clone returns a copy of p that does not alias a receive buffer.
+// Options are not copied.
+func (p *Packet) clone() *Packet {
+	tcp := *p.TCP
+	tcp.Options = nil
+	tcp.Contents = nil
+	tcp.Payload = append([]byte(nil), p.Payload...)
+	return &Packet{TCP: &tcp, Payload: tcp.Payload}
+}
+
+// pseudoHeaderSum returns the partial checksum of the IPv4 pseudo-header
+// without the segment length, so it can be computed once per connection.
+func pseudoHeaderSum(srcIP, dstIP net.IP) uint64 {
+	var sum uint64
+	sum += uint64(binary.BigEndian.Uint32(srcIP))
+	sum += uint64(binary.BigEndian.Uint32(dstIP))
+	sum += uint64(layers.IPProtocolTCP)
+	return sum
+}
+
+// checksumAdd adds b to a running ones' complement sum, four bytes at a time
+func checksumAdd(sum uint64, b []byte) uint64 {
+	for len(b) >= 4 {
+		sum += uint64(binary.BigEndian.Uint32(b))
+		b = b[4:]
+	}
+	if len(b) >= 2 {
+		sum += uint64(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		sum += uint64(b[0]) << 8
+	}
+	return sum
+}
+
+// checksumFold folds a running sum into the final 16-bit checksum
+func checksumFold(sum uint64) uint16 {
+	for sum > 0xFFFF {
+		sum = (sum >> 16) + (sum & 0xFFFF)
+	}
+	return ^uint16(sum)
+}
+
+// tcpChecksum computes the Internet checksum of the segment with the IPv4
+// pseudo-header. For a segment with a correct checksum field the result is zero.
+func tcpChecksum(segment []byte, srcIP, dstIP net.IP) uint16 {
+	sum := pseudoHeaderSum(srcIP, dstIP) + uint64(len(segment))
+	return checksumFold(checksumAdd(sum, segment))
+}
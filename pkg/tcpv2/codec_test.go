@@ -0,0 +1,231 @@
+package tcpv2
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeTo_MatchesGopacket(t *testing.T) {
+	srcIP := net.ParseIP("192.168.1.1").To4()
+	dstIP := net.ParseIP("192.168.1.2").To4()
+
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"empty", nil},
+		{"even payload", []byte("Hello World!")},
+		{"odd payload", []byte("Hello World")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkt := NewPacket(12345, 80, 1000, 2000, true, true, false, false, 4096, tt.payload)
+
+			want, err := pkt.Encode(srcIP, dstIP)
+			require.NoError(t, err)
+
+			buf := make([]byte, MTU)
+			n, err := pkt.EncodeTo(buf, srcIP, dstIP)
+			require.NoError(t, err)
+			require.Equal(t, want, buf[:n])
+		})
+	}
+}
+
+func TestEncodeTo_Options(t *testing.T) {
+	srcIP := net.ParseIP("10.0.0.1").To4()
+	dstIP := net.ParseIP("10.0.0.2").To4()
+
+	pkt := NewPacket(1234, 5678, 1, 0, true, false, false, false, 1024, nil)
+	pkt.TCP.Options = []layers.TCPOption{
+		{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xAC}},
+		{OptionType: layers.TCPOptionKindWindowScale, OptionLength: 3, OptionData: []byte{7}},
+	}
+
+	buf := make([]byte, MTU)
+	n, err := pkt.EncodeTo(buf, srcIP, dstIP)
+	require.NoError(t, err)
+	require.Equal(t, tcpHeaderLen+8, n)
+
+	decoded, err := DecodePacket(buf[:n])
+	require.NoError(t, err)
+	// Padding byte is reported by gopacket as an EndList option
+	require.Len(t, decoded.TCP.Options, 3)
+	require.Equal(t, []byte{0x05, 0xAC}, decoded.TCP.Options[0].OptionData)
+	require.Equal(t, []byte{7}, decoded.TCP.Options[1].OptionData)
+
+	_, err = DecodePacketFrom(buf[:n], srcIP, dstIP)
+	require.NoError(t, err)
+}
+
+func TestEncodeTo_ShortBuffer(t *testing.T) {
+	pkt := NewPacket(1234, 5678, 1, 0, false, true, false, false, 1024, []byte("payload"))
+
+	_, err := pkt.EncodeTo(make([]byte, tcpHeaderLen), net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2))
+	require.Error(t, err)
+}
+
+func TestDecodeInto_AllFields(t *testing.T) {
+	srcIP := net.ParseIP("10.0.0.1").To4()
+	dstIP := net.ParseIP("10.0.0.2").To4()
+
+	pkt := NewPacket(5555, 8080, 123456, 654321, false, true, true, false, 8192, []byte("Test Payload"))
+	pkt.TCP.PSH = true
+	pkt.TCP.URG = true
+	pkt.TCP.Urgent = 7
+
+	raw, err := pkt.Encode(srcIP, dstIP)
+	require.NoError(t, err)
+
+	var decoded Packet
+	require.NoError(t, DecodeInto(raw, &decoded))
+
+	want, err := DecodePacket(raw)
+	require.NoError(t, err)
+
+	require.Equal(t, want.TCP.SrcPort, decoded.TCP.SrcPort)
+	require.Equal(t, want.TCP.DstPort, decoded.TCP.DstPort)
+	require.Equal(t, want.TCP.Seq, decoded.TCP.Seq)
+	require.Equal(t, want.TCP.Ack, decoded.TCP.Ack)
+	require.Equal(t, want.TCP.DataOffset, decoded.TCP.DataOffset)
+	require.Equal(t, want.TCP.ACK, decoded.TCP.ACK)
+	require.Equal(t, want.TCP.FIN, decoded.TCP.FIN)
+	require.Equal(t, want.TCP.PSH, decoded.TCP.PSH)
+	require.Equal(t, want.TCP.URG, decoded.TCP.URG)
+	require.Equal(t, want.TCP.Window, decoded.TCP.Window)
+	require.Equal(t, want.TCP.Checksum, decoded.TCP.Checksum)
+	require.Equal(t, want.TCP.Urgent, decoded.TCP.Urgent)
+	require.Equal(t, want.Payload, decoded.Payload)
+}
+
+func TestCodec_ZeroAllocs(t *testing.T) {
+	srcIP := net.ParseIP("10.0.0.1").To4()
+	dstIP := net.ParseIP("10.0.0.2").To4()
+
+	pkt := NewPacket(1234, 5678, 100, 200, false, true, false, false, 1024, make([]byte, MSS))
+	buf := make([]byte, MTU)
+	var decoded Packet
+
+	allocs := testing.AllocsPerRun(100, func() {
+		n, err := pkt.EncodeTo(buf, srcIP, dstIP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := decodeFrom(buf[:n], srcIP, dstIP, &decoded); err != nil {
+			t.Fatal(err)
+		}
+	})
+	require.Zero(t, allocs)
+}
+
+func TestPacketClone(t *testing.T) {
+	raw, err := NewPacket(1, 2, 3, 4, false, true, false, false, 5, []byte("data")).
+		Encode(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2))
+	require.NoError(t, err)
+
+	var p Packet
+	require.NoError(t, DecodeInto(raw, &p))
+	c := p.clone()
+
+	raw[len(raw)-1] = 'X'
+	require.Equal(t, "datX", string(p.Payload))
+	require.Equal(t, "data", string(c.Payload))
+	require.Equal(t, uint32(3), c.TCP.Seq)
+}
+
+func BenchmarkEncode_Gopacket(b *testing.B) {
+	srcIP := net.ParseIP("10.0.0.1").To4()
+	dstIP := net.ParseIP("10.0.0.2").To4()
+	pkt := NewPacket(1234, 5678, 100, 200, false, true, false, false, 1024, make([]byte, MSS))
+
+	b.ReportAllocs()
+	b.SetBytes(int64(MSS))
+	for i := 0; i < b.N; i++ {
+		if _, err := pkt.Encode(srcIP, dstIP); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncode_EncodeTo(b *testing.B) {
+	srcIP := net.ParseIP("10.0.0.1").To4()
+	dstIP := net.ParseIP("10.0.0.2").To4()
+	pkt := NewPacket(1234, 5678, 100, 200, false, true, false, false, 1024, make([]byte, MSS))
+
+	b.ReportAllocs()
+	b.SetBytes(int64(MSS))
+	for i := 0; i < b.N; i++ {
+		bp := getSegmentBuffer()
+		if _, err := pkt.EncodeTo(*bp, srcIP, dstIP); err != nil {
+			b.Fatal(err)
+		}
+		putSegmentBuffer(bp)
+	}
+}
+
+func BenchmarkDecode_Gopacket(b *testing.B) {
+	srcIP := net.ParseIP("10.0.0.1").To4()
+	dstIP := net.ParseIP("10.0.0.2").To4()
+	raw, err := NewPacket(1234, 5678, 100, 200, false, true, false, false, 1024, make([]byte, MSS)).Encode(srcIP, dstIP)
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(MSS))
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodePacket(raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode_DecodeInto(b *testing.B) {
+	srcIP := net.ParseIP("10.0.0.1").To4()
+	dstIP := net.ParseIP("10.0.0.2").To4()
+	raw, err := NewPacket(1234, 5678, 100, 200, false, true, false, false, 1024, make([]byte, MSS)).Encode(srcIP, dstIP)
+	require.NoError(b, err)
+
+	var p Packet
+	b.ReportAllocs()
+	b.SetBytes(int64(MSS))
+	for i := 0; i < b.N; i++ {
+		if err := DecodeInto(raw, &p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode_ValidatedInto(b *testing.B) {
+	srcIP := net.ParseIP("10.0.0.1").To4()
+	dstIP := net.ParseIP("10.0.0.2").To4()
+	raw, err := NewPacket(1234, 5678, 100, 200, false, true, false, false, 1024, make([]byte, MSS)).Encode(srcIP, dstIP)
+	require.NoError(b, err)
+
+	var p Packet
+	b.ReportAllocs()
+	b.SetBytes(int64(MSS))
+	for i := 0; i < b.N; i++ {
+		if err := decodeFrom(raw, srcIP, dstIP, &p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestIPv6_ErrIPv4Only(t *testing.T) {
+	srcIP, dstIP := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	pkt := NewPacket(1234, 5678, 1, 0, true, false, false, false, 1024, nil)
+
+	_, err := pkt.Encode(srcIP, dstIP)
+	require.ErrorIs(t, err, ErrIPv4Only)
+
+	_, err = pkt.EncodeTo(make([]byte, MTU), srcIP, dstIP)
+	require.ErrorIs(t, err, ErrIPv4Only)
+
+	raw, err := pkt.Encode(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2))
+	require.NoError(t, err)
+	_, err = DecodePacketFrom(raw, srcIP, dstIP)
+	require.ErrorIs(t, err, ErrIPv4Only)
+}
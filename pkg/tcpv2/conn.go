@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"tcpconn"
 	"time"
 
@@ -20,6 +21,9 @@ const (
 
 	MTU = 1500
 	MSS = MTU - 20 - 8 - 20 // mtu - ip_header - udp_header - tcp_header
+
+	// DefaultInboundQueue is the number of segments a listener queues per connection
+	DefaultInboundQueue = 128
 )
 
 // Conn implements net.Conn over UDP with TCP-like reliability
@@ -29,77 +33,154 @@ type Conn struct {
 	conn       net.PacketConn
 
 	state *tcpconn.TCPStateMachine
+	stats *tcpconn.Statistics
 
-	readBuffer  *tcpconn.RingBuffer
+	// readBuffer пишет только HandlePacket под mu, читает только Read под readMu
+	readBuffer  *tcpconn.SPSCRingBuffer
 	writeBuffer *tcpconn.RingBuffer
+	readMu      sync.Mutex
 
 	seqNum    uint32
 	ackNum    uint32
 	remoteWin uint16
 
+	// Частичная сумма псевдо-заголовка для контрольной суммы сегментов
+	pseudoSum uint64
+	ipv4      bool
+
+	// batch отправляет сегменты пачками, nil если пакетный ввод-вывод выключен
+	batch *batchWriter
+
+	// Входящая очередь, через которую Listener передает сегменты без блокировки
+	inbound      chan inboundSegment
+	inboundDrops atomic.Uint64
+
 	// RFC 6298 Retransmission Timer
 	srtt      time.Duration        // Smoothed RTT
 	rttvar    time.Duration        // RTT Variance
 	rto       time.Duration        // Retransmission Timeout
 	sentTimes map[uint32]time.Time // Время отправки пакетов для измерения RTT
 
+	// alerter проверяет Options.Alerts, nil если правил нет
+	alerter *tcpconn.Alerter
+
+	retransmits uint64 // Всего ретрансмиссий этого соединения
+	backoff     int    // Число удвоений RTO подряд без нового измерения RTT
+
 	sendQueue    map[uint32]*Packet
 	receiveQueue map[uint32]*Packet
 	mu           sync.Mutex
 	cond         *sync.Cond
 
 	closeChan chan struct{}
+	closeOnce sync.Once
 	closed    bool
 
-	connected chan struct{}
-	reset     chan struct{}
+	// finished закрывается, когда машина состояний доходит до CLOSED:
+	// после Close соединение еще обменивается FIN/ACK с собеседником
+	finished   chan struct{}
+	finishOnce sync.Once
+	timers     *tcpconn.TimerDriver
+
+	connected     chan struct{}
+	connectedOnce sync.Once
+	reset         chan struct{}
 }
 
 func NewConn(conn net.PacketConn, remoteAddr net.Addr) *Conn {
+	return newConn(conn, remoteAddr, Options{})
+}
+
+// NewConnWithStats is like NewConn but records into stats, which may be
+// shared between connections. A nil stats gives the connection its own.
+func NewConnWithStats(conn net.PacketConn, remoteAddr net.Addr, stats *tcpconn.Statistics) *Conn {
+	return newConn(conn, remoteAddr, Options{Stats: stats})
+}
+
+func newConn(conn net.PacketConn, remoteAddr net.Addr, opts Options) *Conn {
+	return newConnFrom(conn, resolveLocalAddr(conn.LocalAddr(), remoteAddr), remoteAddr, opts)
+}
+
+// newConnFrom is like newConn but takes an already resolved local address
+func newConnFrom(conn net.PacketConn, localAddr, remoteAddr net.Addr, opts Options) *Conn {
 	c := &Conn{
 		conn:         conn,
 		remoteAddr:   remoteAddr,
-		localAddr:    conn.LocalAddr(),
+		localAddr:    localAddr,
 		state:        tcpconn.NewTCPStateMachine(),
+		stats:        opts.Stats,
 		sendQueue:    make(map[uint32]*Packet),
 		receiveQueue: make(map[uint32]*Packet),
 		closeChan:    make(chan struct{}),
+		finished:     make(chan struct{}),
 		remoteWin:    DefaultWindowSize,
 		rto:          InitialRTO,
 		sentTimes:    make(map[uint32]time.Time),
 		connected:    make(chan struct{}),
 		reset:        make(chan struct{}),
 	}
-	c.readBuffer, _ = tcpconn.NewRingBuffer(DefaultWindowSize)
+	if c.stats == nil {
+		c.stats = tcpconn.NewStatistics()
+	}
+	c.readBuffer, _ = tcpconn.NewSPSCRingBuffer(DefaultWindowSize)
 	c.writeBuffer, _ = tcpconn.NewRingBuffer(DefaultWindowSize)
 	c.cond = sync.NewCond(&c.mu)
+	c.pseudoSum, c.ipv4 = connPseudoSum(c.localAddr, c.remoteAddr)
+	c.batch = newBatchWriter(conn, remoteAddr, opts)
+	c.timers = c.state.StartTimers(opts.closeTimeouts())
 
 	c.state.SetStateChangeCallback(func(oldState, newState tcpconn.TCPState, event tcpconn.TCPEvent) {
 		if newState == tcpconn.ESTABLISHED {
-			close(c.connected)
+			c.connectedOnce.Do(func() { close(c.connected) })
 		}
 		if newState == tcpconn.CLOSED {
-			close(c.closeChan)
+			c.signalClosed()
+			c.finishOnce.Do(func() {
+				c.timers.Stop()
+				close(c.finished)
+			})
 		}
 	})
 
 	go c.retransmitLoop()
+	c.startAlerts(opts)
 
 	return c
 }
 
+// Read copies reassembled data without taking c.mu while data is buffered.
+// Concurrent readers are serialized so the buffer keeps a single consumer.
 func (c *Conn) Read(b []byte) (n int, err error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if len(b) == 0 {
+		return 0, nil
+	}
 
-	for c.readBuffer.IsEmpty() {
-		if c.closed || c.state.IsClosed() {
-			return 0, net.ErrClosed
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for {
+		if n, _ := c.readBuffer.Read(b); n > 0 {
+			return n, nil
 		}
-		c.cond.Wait()
+
+		// HandlePacket writes and broadcasts under c.mu, so checking for
+		// data under c.mu cannot miss a wakeup
+		c.mu.Lock()
+		for c.readBuffer.IsEmpty() {
+			if c.closed || c.state.IsClosed() {
+				c.mu.Unlock()
+				return 0, net.ErrClosed
+			}
+			c.cond.Wait()
+		}
+		c.mu.Unlock()
 	}
+}
 
-	return c.readBuffer.Read(b)
+// recvWindow returns the free read buffer space as a TCP window. The
+// buffer capacity is rounded up to a power of two, one above the maximum.
+func (c *Conn) recvWindow() uint16 {
+	return uint16(min(c.readBuffer.FreeSpace(), DefaultWindowSize))
 }
 
 func (c *Conn) Write(b []byte) (n int, err error) {
@@ -110,6 +191,10 @@ func (c *Conn) Write(b []byte) (n int, err error) {
 		return 0, net.ErrClosed
 	}
 
+	if c.batch != nil && c.ipv4 {
+		return c.writeBatchLocked(b)
+	}
+
 	totalSent := 0
 	for totalSent < len(b) {
 		chunkSize := MSS
@@ -125,7 +210,7 @@ func (c *Conn) Write(b []byte) (n int, err error) {
 			c.seqNum,
 			c.ackNum,
 			false, true, false, false, // SYN, ACK, FIN, RST
-			uint16(c.readBuffer.FreeSpace()),
+			c.recvWindow(),
 			chunk,
 		)
 
@@ -148,15 +233,26 @@ func (c *Conn) Close() error {
 		return nil
 	}
 
-	c.state.ProcessEvent(tcpconn.CLOSE)
+	c.state.ProcessEventWithMeta(tcpconn.CLOSE, tcpconn.TransitionMeta{Seq: c.seqNum, Ack: c.ackNum, Reason: "close"})
 	c.sendControlPacket(false, true, true, false) // SYN, ACK, FIN, RST
 	c.closed = true
 	c.cond.Broadcast()
-	close(c.closeChan)
+	c.signalClosed()
 
 	return nil
 }
 
+// signalClosed closes closeChan once. Both Close and the transition to CLOSED
+// signal it, and state callbacks run outside the state machine lock.
+func (c *Conn) signalClosed() {
+	c.closeOnce.Do(func() { close(c.closeChan) })
+}
+
+// Stats returns a snapshot of the connection statistics
+func (c *Conn) Stats() tcpconn.Snapshot {
+	return c.stats.GetSnapshot()
+}
+
 func (c *Conn) LocalAddr() net.Addr  { return c.localAddr }
 func (c *Conn) RemoteAddr() net.Addr { return c.remoteAddr }
 
@@ -165,32 +261,102 @@ func (c *Conn) SetReadDeadline(t time.Time) error  { return errors.New("not impl
 func (c *Conn) SetWriteDeadline(t time.Time) error { return errors.New("not implemented") }
 
 func (c *Conn) sendPacketLocked(p *Packet) error {
-	var srcIP, dstIP net.IP
-	if addr, ok := c.localAddr.(*net.UDPAddr); ok {
-		srcIP = addr.IP.To4()
-	}
-	if addr, ok := c.remoteAddr.(*net.UDPAddr); ok {
-		dstIP = addr.IP.To4()
-	}
-
-	data, err := p.Encode(srcIP, dstIP)
-	if err != nil {
-		return fmt.Errorf("failed to encode packet in sendPacketLocked: %w", err)
+	if err := c.writeSegment(p); err != nil {
+		c.stats.RecordError()
+		return err
 	}
 
-	if _, err := c.conn.WriteTo(data, c.remoteAddr); err != nil {
-		return fmt.Errorf("failed to write packet to %s: %w", c.remoteAddr, err)
-	}
+	c.stats.RecordPacketSent(uint64(len(p.Payload)))
+	c.trackSentLocked(p)
+	return nil
+}
 
+// trackSentLocked queues a sent segment for retransmission until it is acked
+func (c *Conn) trackSentLocked(p *Packet) {
 	if len(p.Payload) > 0 || p.TCP.SYN || p.TCP.FIN {
 		c.sendQueue[p.TCP.Seq] = p
 		// Запоминаем время отправки для измерения RTT
 		c.sentTimes[p.TCP.Seq] = time.Now()
 	}
+}
+
+// writeBatchLocked splits b into MSS sized segments and sends them with as
+// few system calls as the batch writer allows
+func (c *Conn) writeBatchLocked(b []byte) (int, error) {
+	pkts := make([]*Packet, 0, c.batch.maxSegments())
+
+	totalSent := 0
+	for totalSent < len(b) {
+		pkts = pkts[:0]
+		seq := c.seqNum
+		off := totalSent
+		for len(pkts) < cap(pkts) && off < len(b) {
+			chunk := b[off:min(off+MSS, len(b))]
+			pkts = append(pkts, NewPacket(
+				uint16(c.localAddr.(*net.UDPAddr).Port),
+				uint16(c.remoteAddr.(*net.UDPAddr).Port),
+				seq,
+				c.ackNum,
+				false, true, false, false, // SYN, ACK, FIN, RST
+				c.recvWindow(),
+				chunk,
+			))
+			seq += uint32(len(chunk))
+			off += len(chunk)
+		}
+
+		sent, err := c.batch.send(c.pseudoSum, pkts)
+		for _, p := range pkts[:sent] {
+			c.stats.RecordPacketSent(uint64(len(p.Payload)))
+			c.trackSentLocked(p)
+			c.seqNum += uint32(len(p.Payload))
+			totalSent += len(p.Payload)
+		}
+		if err != nil {
+			c.stats.RecordError()
+			return totalSent, fmt.Errorf("failed to write batch to %s: %w", c.remoteAddr, err)
+		}
+	}
+
+	return totalSent, nil
+}
+
+// writeSegment encodes p into a pooled buffer and sends it to the peer
+func (c *Conn) writeSegment(p *Packet) error {
+	if !c.ipv4 {
+		return fmt.Errorf("failed to encode packet in writeSegment: %w", ErrIPv4Only)
+	}
+
+	bp := getSegmentBuffer()
+	defer putSegmentBuffer(bp)
+
+	buf := *bp
+	if need := tcpMaxHeaderLen + len(p.Payload); need > len(buf) {
+		buf = make([]byte, need)
+	}
+
+	n, err := p.encodeTo(buf, c.pseudoSum)
+	if err != nil {
+		return fmt.Errorf("failed to encode packet in writeSegment: %w", err)
+	}
+
+	if _, err := c.conn.WriteTo(buf[:n], c.remoteAddr); err != nil {
+		return fmt.Errorf("failed to write packet to %s: %w", c.remoteAddr, err)
+	}
 
 	return nil
 }
 
+// connPseudoSum precomputes the pseudo-header sum for the connection addresses
+func connPseudoSum(local, remote net.Addr) (uint64, bool) {
+	srcIP := udpIP(local).To4()
+	dstIP := udpIP(remote).To4()
+	if srcIP == nil || dstIP == nil {
+		return 0, false
+	}
+	return pseudoHeaderSum(srcIP, dstIP), true
+}
+
 func (c *Conn) sendControlPacket(syn, ack, fin, rst bool) error {
 	p := NewPacket(
 		uint16(c.localAddr.(*net.UDPAddr).Port),
@@ -198,7 +364,7 @@ func (c *Conn) sendControlPacket(syn, ack, fin, rst bool) error {
 		c.seqNum,
 		c.ackNum,
 		syn, ack, fin, rst,
-		uint16(c.readBuffer.FreeSpace()),
+		c.recvWindow(),
 		nil,
 	)
 
@@ -209,12 +375,31 @@ func (c *Conn) sendControlPacket(syn, ack, fin, rst bool) error {
 	return c.sendPacketLocked(p)
 }
 
+// resetState moves the state machine to CLOSED after an RST. A passive open falls
+// back to LISTEN, where the table rejects RST, but a per-peer Conn has nothing
+// left to listen for, so it is closed explicitly. Caller holds c.mu.
+func (c *Conn) resetState(meta tcpconn.TransitionMeta) {
+	c.state.ProcessEventWithMeta(tcpconn.RST, meta)
+	if c.state.GetState() == tcpconn.LISTEN {
+		meta.Reason = "reset"
+		c.state.ProcessEventWithMeta(tcpconn.CLOSE, meta)
+	}
+}
+
+// packetMeta describes the segment that triggered a state transition
+func packetMeta(p *Packet) tcpconn.TransitionMeta {
+	return tcpconn.TransitionMeta{Seq: p.TCP.Seq, Ack: p.TCP.Ack, Packet: p.String()}
+}
+
 func (c *Conn) HandlePacket(p *Packet) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.stats.RecordPacketReceived(uint64(len(p.Payload)))
+
 	if p.TCP.RST {
-		c.state.ProcessEvent(tcpconn.RST)
+		c.stats.RecordReset()
+		c.resetState(packetMeta(p))
 		c.closed = true
 		c.cond.Broadcast()
 		return
@@ -222,11 +407,11 @@ func (c *Conn) HandlePacket(p *Packet) {
 
 	if p.TCP.SYN {
 		if c.state.GetState() == tcpconn.LISTEN {
-			c.state.ProcessEvent(tcpconn.SYN)
+			c.state.ProcessEventWithMeta(tcpconn.SYN, packetMeta(p))
 			c.ackNum = p.TCP.Seq + 1
 			c.sendControlPacket(true, true, false, false) // SYN-ACK
 		} else if c.state.GetState() == tcpconn.SYN_SENT {
-			c.state.ProcessEvent(tcpconn.SYN_ACK)
+			c.state.ProcessEventWithMeta(tcpconn.SYN_ACK, packetMeta(p))
 			c.ackNum = p.TCP.Seq + 1
 			c.sendControlPacket(false, true, false, false) // ACK
 		}
@@ -234,11 +419,11 @@ func (c *Conn) HandlePacket(p *Packet) {
 
 	if p.TCP.ACK {
 		if c.state.GetState() == tcpconn.SYN_RECEIVED {
-			c.state.ProcessEvent(tcpconn.ACK)
+			c.state.ProcessEventWithMeta(tcpconn.ACK, packetMeta(p))
 		} else if c.state.GetState() == tcpconn.FIN_WAIT_1 {
-			c.state.ProcessEvent(tcpconn.ACK)
+			c.state.ProcessEventWithMeta(tcpconn.ACK, packetMeta(p))
 		} else if c.state.GetState() == tcpconn.LAST_ACK {
-			c.state.ProcessEvent(tcpconn.ACK)
+			c.state.ProcessEventWithMeta(tcpconn.ACK, packetMeta(p))
 			c.closed = true
 			c.cond.Broadcast()
 		}
@@ -264,7 +449,7 @@ func (c *Conn) HandlePacket(p *Packet) {
 	}
 
 	if p.TCP.FIN {
-		c.state.ProcessEvent(tcpconn.FIN)
+		c.state.ProcessEventWithMeta(tcpconn.FIN, packetMeta(p))
 		c.ackNum++
 		c.sendControlPacket(false, true, false, false) // ACK
 		c.cond.Broadcast()
@@ -288,7 +473,8 @@ func (c *Conn) HandlePacket(p *Packet) {
 
 			c.sendControlPacket(false, true, false, false) // ACK
 		} else if p.TCP.Seq > c.ackNum {
-			c.receiveQueue[p.TCP.Seq] = p
+			// Пакет может ссылаться на буфер чтения, поэтому сохраняем копию
+			c.receiveQueue[p.TCP.Seq] = p.clone()
 			c.sendControlPacket(false, true, false, false) // ACK
 		}
 	}
@@ -296,8 +482,81 @@ func (c *Conn) HandlePacket(p *Packet) {
 	c.remoteWin = p.TCP.Window
 }
 
+// inboundSegment is a raw datagram copied out of the listener read buffer
+type inboundSegment struct {
+	buf *[]byte
+	n   int
+}
+
+// enqueueInbound copies data into the connection queue without blocking.
+// When the queue is full the segment is dropped and counted.
+func (c *Conn) enqueueInbound(data []byte) bool {
+	bp := getSegmentBuffer()
+	if len(data) > len(*bp) {
+		b := make([]byte, len(data))
+		bp = &b
+	}
+	n := copy(*bp, data)
+
+	select {
+	case c.inbound <- inboundSegment{buf: bp, n: n}:
+		return true
+	default:
+		putSegmentBuffer(bp)
+		c.inboundDrops.Add(1)
+		return false
+	}
+}
+
+// inboundLoop decodes queued segments and hands them to HandlePacket until
+// done or the state machine reaches CLOSED, then returns queued buffers to
+// the pool. A locally closed connection keeps receiving until the FIN
+// exchange completes or its TIME_WAIT expires.
+func (c *Conn) inboundLoop(done <-chan struct{}) {
+	defer c.drainInbound()
+
+	var packet Packet
+	for {
+		select {
+		case <-done:
+			return
+		case <-c.finished:
+			return
+		case seg := <-c.inbound:
+			data := (*seg.buf)[:seg.n]
+			if err := decodeFrom(data, udpIP(c.remoteAddr), udpIP(c.localAddr), &packet); err != nil {
+				c.stats.RecordError()
+			} else {
+				c.HandlePacket(&packet)
+			}
+			putSegmentBuffer(seg.buf)
+		}
+	}
+}
+
+// drainInbound returns the buffers of segments still queued to the pool
+func (c *Conn) drainInbound() {
+	for {
+		select {
+		case seg := <-c.inbound:
+			putSegmentBuffer(seg.buf)
+		default:
+			return
+		}
+	}
+}
+
+// InboundDrops returns how many segments were dropped because the
+// connection did not keep up with its listener queue
+func (c *Conn) InboundDrops() uint64 {
+	return c.inboundDrops.Load()
+}
+
 // updateRTO implements RFC 6298 RTO calculation
 func (c *Conn) updateRTO(rtt time.Duration) {
+	c.stats.RecordLatency(uint64(rtt.Microseconds()))
+	c.backoff = 0
+
 	if c.srtt == 0 {
 		// Первое измерение RTT (RFC 6298 2.2)
 		c.srtt = rtt
@@ -328,26 +587,32 @@ func (c *Conn) updateRTO(rtt time.Duration) {
 	}
 }
 
+func (c *Conn) currentRTO() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rto
+}
+
 func (c *Conn) retransmitLoop() {
 	for {
 		select {
 		case <-c.closeChan:
 			return
-		case <-time.After(c.rto):
+		case <-time.After(c.currentRTO()):
 			c.mu.Lock()
 			if len(c.sendQueue) > 0 {
 				log.Debug().Msgf("Retransmitting %d packets", len(c.sendQueue))
+				c.stats.RecordTimeout()
 				// Ретрансмиссия всех неподтвержденных пакетов
 				for seq, pkt := range c.sendQueue {
-					var srcIP, dstIP net.IP
-					if addr, ok := c.localAddr.(*net.UDPAddr); ok {
-						srcIP = addr.IP.To4()
-					}
-					if addr, ok := c.remoteAddr.(*net.UDPAddr); ok {
-						dstIP = addr.IP.To4()
+					// Неподтвержденный к истечению RTO пакет считаем потерянным
+					c.stats.RecordPacketLost()
+					if err := c.writeSegment(pkt); err != nil {
+						c.stats.RecordError()
+					} else {
+						c.stats.RecordPacketRetried()
+						c.retransmits++
 					}
-					data, _ := pkt.Encode(srcIP, dstIP)
-					c.conn.WriteTo(data, c.remoteAddr)
 					// Обновляем время отправки для повторной передачи
 					c.sentTimes[seq] = time.Now()
 				}
@@ -356,6 +621,7 @@ func (c *Conn) retransmitLoop() {
 				if c.rto > MaxRTO {
 					c.rto = MaxRTO
 				}
+				c.backoff++
 			}
 			c.mu.Unlock()
 		}
@@ -148,6 +148,56 @@ func TestConn_DataTransfer(t *testing.T) {
 	require.Equal(t, uint32(106), c.ackNum)
 }
 
+func TestConn_ConcurrentReaders(t *testing.T) {
+	mockConn := NewMockPacketConn()
+	remoteAddr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1").To4(), Port: 12345}
+	c := NewConn(mockConn, remoteAddr)
+	defer c.Close()
+
+	c.state.ProcessEvent(tcpconn.PASSIVE_OPEN) // LISTEN
+	c.state.ProcessEvent(tcpconn.SYN)          // SYN_RECEIVED
+	c.state.ProcessEvent(tcpconn.ACK)          // ESTABLISHED
+	c.ackNum = 1
+
+	// The buffer rounds up to 65536 bytes, the window stays within 16 bits
+	require.Equal(t, uint16(DefaultWindowSize), c.recvWindow())
+
+	// Two readers share the single-consumer read buffer
+	const segments, size = 200, 100
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	total := 0
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 64)
+			for {
+				n, err := c.Read(buf)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				total += n
+				mu.Unlock()
+			}
+		}()
+	}
+
+	payload := make([]byte, size)
+	for i := 0; i < segments; i++ {
+		c.HandlePacket(NewPacket(12345, 8080, uint32(1+i*size), 0, false, true, false, false, 4096, payload))
+	}
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return total == segments*size
+	}, time.Second, 10*time.Millisecond)
+
+	c.Close()
+	wg.Wait()
+}
+
 func TestConn_Write(t *testing.T) {
 	mockConn := NewMockPacketConn()
 	remoteAddr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1").To4(), Port: 12345}
@@ -249,3 +299,78 @@ func TestConn_OutOfOrderPackets(t *testing.T) {
 	n, _ := c.readBuffer.Read(buf)
 	require.Equal(t, "HelloWorld", string(buf[:n]))
 }
+
+func TestConn_StatsRecording(t *testing.T) {
+	mockConn := NewMockPacketConn()
+	remoteAddr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1").To4(), Port: 12345}
+	c := NewConn(mockConn, remoteAddr)
+	defer c.Close()
+
+	c.state.ProcessEvent(tcpconn.PASSIVE_OPEN)
+	c.state.ProcessEvent(tcpconn.SYN)
+	c.state.ProcessEvent(tcpconn.ACK)
+	c.seqNum = 100
+	c.ackNum = 200
+
+	_, err := c.Write([]byte("Hello"))
+	require.NoError(t, err)
+
+	// Peer acknowledges the data, producing an RTT sample
+	c.HandlePacket(NewPacket(12345, 8080, 200, 105, false, true, false, false, 4096, nil))
+	// Peer sends data
+	c.HandlePacket(NewPacket(12345, 8080, 200, 105, false, true, false, false, 4096, []byte("World!")))
+
+	snap := c.Stats()
+	require.Equal(t, uint64(5), snap.BytesSent)
+	require.Equal(t, uint64(6), snap.BytesReceived)
+	require.Equal(t, uint64(2), snap.PacketsReceived)
+	require.Equal(t, uint64(1), snap.LatencyCount)
+	require.Zero(t, snap.Resets)
+
+	c.HandlePacket(NewPacket(12345, 8080, 206, 105, false, false, false, true, 4096, nil))
+	require.Equal(t, uint64(1), c.Stats().Resets)
+}
+
+func TestConn_StatsRetransmission(t *testing.T) {
+	mockConn := NewMockPacketConn()
+	remoteAddr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1").To4(), Port: 12345}
+	c := NewConn(mockConn, remoteAddr)
+	defer c.Close()
+
+	c.state.ProcessEvent(tcpconn.PASSIVE_OPEN)
+	c.state.ProcessEvent(tcpconn.SYN)
+	c.state.ProcessEvent(tcpconn.ACK)
+
+	c.mu.Lock()
+	c.rto = MinRTO
+	c.mu.Unlock()
+
+	_, err := c.Write([]byte("never acked"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		snap := c.Stats()
+		return snap.PacketsRetried >= 1 && snap.PacketsLost >= 1 && snap.Timeouts >= 1
+	}, 3*time.Second, 20*time.Millisecond)
+}
+
+func TestNewConnWithStats_Shared(t *testing.T) {
+	shared := tcpconn.NewStatistics()
+	remoteAddr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1").To4(), Port: 12345}
+
+	a := NewConnWithStats(NewMockPacketConn(), remoteAddr, shared)
+	defer a.Close()
+	b := NewConnWithStats(NewMockPacketConn(), remoteAddr, shared)
+	defer b.Close()
+
+	a.HandlePacket(NewPacket(12345, 8080, 1, 0, false, true, false, false, 4096, nil))
+	b.HandlePacket(NewPacket(12345, 8080, 1, 0, false, true, false, false, 4096, nil))
+
+	require.Equal(t, uint64(2), shared.GetPacketsReceived())
+	require.Equal(t, a.Stats().PacketsReceived, b.Stats().PacketsReceived)
+
+	own := NewConnWithStats(NewMockPacketConn(), remoteAddr, nil)
+	defer own.Close()
+	require.NotNil(t, own.stats)
+	require.NotSame(t, shared, own.stats)
+}
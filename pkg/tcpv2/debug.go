@@ -0,0 +1,241 @@
+package tcpv2
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"tcpconn"
+	"time"
+)
+
+// DebugHandler returns an http.Handler that lists the listener's connections,
+// in the spirit of net/http/pprof and expvar. It serves HTML by default and
+// JSON for ?format=json or Accept: application/json. ?conn=<remote address>
+// selects a single connection and adds its state transition history.
+// The handler uses only query parameters, so it can be mounted at any path:
+//
+//	mux.Handle("/debug/tcpv2", l.DebugHandler())
+func (l *Listener) DebugHandler() http.Handler {
+	return debugHandler{l: l}
+}
+
+type debugHandler struct {
+	l *Listener
+}
+
+// debugConn is the JSON and HTML view of one connection
+type debugConn struct {
+	Remote  string            `json:"remote"`
+	Local   string            `json:"local"`
+	State   string            `json:"state"`
+	Info    debugInfo         `json:"info"`
+	Stats   tcpconn.Snapshot  `json:"stats"`
+	Alerts  []string          `json:"alerts,omitempty"`
+	History []debugTransition `json:"history,omitempty"`
+	Summary string            `json:"-"` // ConnInfo.String for the HTML detail view
+}
+
+// debugInfo mirrors ConnInfo with durations in milliseconds
+type debugInfo struct {
+	SRTTMs        float64 `json:"srtt_ms"`
+	RTTVarMs      float64 `json:"rttvar_ms"`
+	RTOMs         float64 `json:"rto_ms"`
+	Backoff       int     `json:"backoff"`
+	SndNxt        uint32  `json:"snd_nxt"`
+	RcvNxt        uint32  `json:"rcv_nxt"`
+	BytesInFlight int     `json:"bytes_in_flight"`
+	Unacked       int     `json:"unacked"`
+	OutOfOrder    int     `json:"out_of_order"`
+	ReadBuffered  int     `json:"read_buffered"`
+	PeerWindow    uint16  `json:"peer_window"`
+	LocalWindow   int     `json:"local_window"`
+	Retransmits   uint64  `json:"retransmits"`
+	InboundDrops  uint64  `json:"inbound_drops"`
+}
+
+type debugTransition struct {
+	Time   time.Time `json:"time"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Event  string    `json:"event"`
+	Seq    uint32    `json:"seq,omitempty"`
+	Ack    uint32    `json:"ack,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Packet string    `json:"packet,omitempty"`
+}
+
+// debugListener is the top-level document
+type debugListener struct {
+	Addr        string           `json:"addr"`
+	Shards      int              `json:"shards"`
+	Stats       tcpconn.Snapshot `json:"stats"`
+	Connections []debugConn      `json:"connections"`
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func newDebugConn(remote string, c *Conn, withHistory bool) debugConn {
+	info := c.Info()
+	dc := debugConn{
+		Remote: remote,
+		Local:  c.LocalAddr().String(),
+		State:  info.State.String(),
+		Info: debugInfo{
+			SRTTMs:        durationMs(info.SRTT),
+			RTTVarMs:      durationMs(info.RTTVar),
+			RTOMs:         durationMs(info.RTO),
+			Backoff:       info.Backoff,
+			SndNxt:        info.SndNxt,
+			RcvNxt:        info.RcvNxt,
+			BytesInFlight: info.BytesInFlight,
+			Unacked:       info.Unacked,
+			OutOfOrder:    info.OutOfOrder,
+			ReadBuffered:  info.ReadBuffered,
+			PeerWindow:    info.PeerWindow,
+			LocalWindow:   info.LocalWindow,
+			Retransmits:   info.Retransmits,
+			InboundDrops:  info.InboundDrops,
+		},
+		Stats:   c.Stats(),
+		Alerts:  c.Alerts(),
+		Summary: info.String(),
+	}
+	if withHistory {
+		for _, t := range c.state.GetHistory() {
+			dc.History = append(dc.History, debugTransition{
+				Time:   t.Time,
+				From:   t.FromState.String(),
+				To:     t.ToState.String(),
+				Event:  t.Event.String(),
+				Seq:    t.Meta.Seq,
+				Ack:    t.Meta.Ack,
+				Reason: t.Meta.Reason,
+				Packet: t.Meta.Packet,
+			})
+		}
+	}
+	return dc
+}
+
+// connections returns the listener's connections sorted by remote address
+func (l *Listener) connections() ([]string, map[string]*Conn) {
+	conns := make(map[string]*Conn)
+	for _, sh := range l.shards {
+		sh.mu.Lock()
+		for remote, c := range sh.conns {
+			conns[remote] = c
+		}
+		sh.mu.Unlock()
+	}
+
+	remotes := make([]string, 0, len(conns))
+	for remote := range conns {
+		remotes = append(remotes, remote)
+	}
+	sort.Strings(remotes)
+	return remotes, conns
+}
+
+func (h debugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	remotes, conns := h.l.connections()
+	doc := debugListener{
+		Addr:   h.l.Addr().String(),
+		Shards: len(h.l.shards),
+		Stats:  h.l.Stats(),
+	}
+
+	selected := r.URL.Query().Get("conn")
+	if selected != "" {
+		c, ok := conns[selected]
+		if !ok {
+			http.Error(w, "connection not found", http.StatusNotFound)
+			return
+		}
+		doc.Connections = []debugConn{newDebugConn(selected, c, true)}
+	} else {
+		doc.Connections = make([]debugConn, 0, len(remotes))
+		for _, remote := range remotes {
+			doc.Connections = append(doc.Connections, newDebugConn(remote, conns[remote], false))
+		}
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(doc)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	debugTemplate.Execute(w, struct {
+		debugListener
+		Selected string
+	}{doc, selected})
+}
+
+func wantsJSON(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+var debugTemplate = template.Must(template.New("debug").Funcs(template.FuncMap{
+	"bytes": tcpconn.FormatBytes,
+	"rate":  tcpconn.FormatRate,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>tcpv2 {{.Addr}}</title>
+<style>
+body { font-family: monospace; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: right; }
+th { background: #eee; }
+td.l { text-align: left; }
+</style>
+</head>
+<body>
+<h1>tcpv2 listener {{.Addr}}</h1>
+<p>{{.Shards}} shard(s), {{len .Connections}} connection(s) shown. <a href="?format=json{{if .Selected}}&amp;conn={{.Selected}}{{end}}">JSON</a>{{if .Selected}} | <a href="?">all connections</a>{{end}}</p>
+<p>Totals: {{.Stats.Compact}}</p>
+<table>
+<tr><th>remote</th><th>state</th><th>srtt</th><th>rto</th><th>in flight</th><th>retrans</th><th>sent</th><th>recv</th><th>loss %</th><th>p99 μs</th><th>alerts</th></tr>
+{{range .Connections}}<tr>
+<td class="l"><a href="?conn={{.Remote}}">{{.Remote}}</a></td>
+<td class="l">{{.State}}</td>
+<td>{{printf "%.1fms" .Info.SRTTMs}}</td>
+<td>{{printf "%.0fms" .Info.RTOMs}}</td>
+<td>{{.Info.BytesInFlight}}</td>
+<td>{{.Info.Retransmits}}</td>
+<td>{{bytes .Stats.BytesSent}}</td>
+<td>{{bytes .Stats.BytesReceived}}</td>
+<td>{{printf "%.2f" .Stats.PacketLossRate}}</td>
+<td>{{.Stats.P99LatencyUs}}</td>
+<td class="l">{{range .Alerts}}{{.}} {{end}}</td>
+</tr>
+{{end}}</table>
+{{if .Selected}}{{range .Connections}}
+<h2>{{.Remote}}</h2>
+<pre>{{.Summary}}</pre>
+<pre>{{.Stats}}</pre>
+<h3>State transitions</h3>
+<table>
+<tr><th>#</th><th>time</th><th>from</th><th>event</th><th>to</th><th>details</th></tr>
+{{range $i, $t := .History}}<tr><td>{{$i}}</td><td class="l">{{$t.Time.Format "15:04:05.000000"}}</td><td class="l">{{$t.From}}</td><td class="l">{{$t.Event}}</td><td class="l">{{$t.To}}</td><td class="l">{{$t.Reason}}{{if $t.Packet}} {{$t.Packet}}{{end}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}
+</body>
+</html>
+`))
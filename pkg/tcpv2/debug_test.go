@@ -0,0 +1,106 @@
+package tcpv2
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func debugGet(t *testing.T, srv *httptest.Server, query string, accept string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/debug/tcpv2"+query, nil)
+	require.NoError(t, err)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestListener_DebugHandler(t *testing.T) {
+	l, client, server := dialPair(t, Options{})
+	defer l.Close()
+	defer client.Close()
+
+	_, err := client.Write([]byte("debug"))
+	require.NoError(t, err)
+	buf := make([]byte, 8)
+	_, err = server.Read(buf)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/tcpv2", l.DebugHandler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	remote := server.RemoteAddr().String()
+
+	// JSON list via Accept header
+	resp, body := debugGet(t, srv, "", "application/json")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var doc struct {
+		Addr        string `json:"addr"`
+		Connections []struct {
+			Remote string `json:"remote"`
+			State  string `json:"state"`
+			Info   struct {
+				RTOMs float64 `json:"rto_ms"`
+			} `json:"info"`
+			Stats struct {
+				BytesReceived uint64 `json:"bytes_received"`
+			} `json:"stats"`
+			History []struct {
+				Time   time.Time `json:"time"`
+				Event  string    `json:"event"`
+				Packet string    `json:"packet"`
+			} `json:"history"`
+		} `json:"connections"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &doc))
+	require.Equal(t, l.Addr().String(), doc.Addr)
+	require.Len(t, doc.Connections, 1)
+	require.Equal(t, remote, doc.Connections[0].Remote)
+	require.Equal(t, "ESTABLISHED", doc.Connections[0].State)
+	require.Positive(t, doc.Connections[0].Info.RTOMs)
+	require.GreaterOrEqual(t, doc.Connections[0].Stats.BytesReceived, uint64(len("debug")))
+	require.Empty(t, doc.Connections[0].History)
+
+	// A selected connection includes its transitions
+	_, body = debugGet(t, srv, "?format=json&conn="+url.QueryEscape(remote), "")
+	require.NoError(t, json.Unmarshal([]byte(body), &doc))
+	require.Len(t, doc.Connections, 1)
+	require.NotEmpty(t, doc.Connections[0].History)
+	require.Equal(t, "PASSIVE_OPEN", doc.Connections[0].History[0].Event)
+	require.False(t, doc.Connections[0].History[0].Time.IsZero())
+	require.Equal(t, "SYN", doc.Connections[0].History[1].Event)
+	require.Contains(t, doc.Connections[0].History[1].Packet, "Flags=[SYN]")
+
+	// HTML by default
+	resp, body = debugGet(t, srv, "?conn="+url.QueryEscape(remote), "")
+	require.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	require.Contains(t, body, remote)
+	require.Contains(t, body, "State transitions")
+	require.Contains(t, body, "PASSIVE_OPEN")
+
+	resp, _ = debugGet(t, srv, "?conn=10.0.0.1:1", "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	postResp, err := http.Post(srv.URL+"/debug/tcpv2", "text/plain", nil)
+	require.NoError(t, err)
+	postResp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, postResp.StatusCode)
+}
@@ -0,0 +1,158 @@
+package tcpv2
+
+import (
+	"errors"
+	"sync"
+	"tcpconn"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultAlertInterval is how often connection alert rules are evaluated
+const DefaultAlertInterval = time.Second
+
+// ErrSharedStatsShed is returned when ShedUnhealthy is combined with a shared
+// Options.Stats: one unhealthy period would reset every connection sharing it
+var ErrSharedStatsShed = errors.New("ShedUnhealthy requires per-connection statistics; use Options.Parent instead of Options.Stats")
+
+func (o Options) alertInterval() time.Duration {
+	if o.AlertInterval > 0 {
+		return o.AlertInterval
+	}
+	return DefaultAlertInterval
+}
+
+// validateAlerts checks Options.Alerts up front so Listen and Dial fail early
+func (o Options) validateAlerts() error {
+	if o.Stats != nil && o.ShedUnhealthy {
+		return ErrSharedStatsShed
+	}
+	for _, r := range o.Alerts {
+		if err := r.ValidateInterval(o.alertInterval()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startAlerts evaluates opts.Alerts against the connection statistics until
+// the connection closes. Firing alerts are logged and, with ShedUnhealthy,
+// reset the connection. Statistics shared through Options.Stats are
+// evaluated once for all connections recording into them.
+func (c *Conn) startAlerts(opts Options) {
+	if len(opts.Alerts) == 0 {
+		return
+	}
+	if opts.Stats != nil && !opts.ownStats {
+		c.startSharedAlerts(opts)
+		return
+	}
+
+	a, err := c.stats.StartAlerter(opts.alertInterval(), opts.Alerts...)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to start connection alerts")
+		return
+	}
+	c.alerter = a
+
+	a.OnAlert(func(ev tcpconn.AlertEvent) {
+		if !ev.Firing {
+			log.Info().Str("remote", c.remoteAddr.String()).Str("rule", ev.Rule).
+				Float64("value", ev.Value).Msg("Connection recovered")
+			return
+		}
+
+		log.Warn().Str("remote", c.remoteAddr.String()).Str("rule", ev.Rule).
+			Float64("value", ev.Value).Float64("threshold", ev.Threshold).
+			Bool("shed", opts.ShedUnhealthy).Msg("Connection unhealthy")
+		if opts.ShedUnhealthy {
+			c.abort("unhealthy: " + ev.Rule)
+		}
+	})
+
+	go func() {
+		<-c.closeChan
+		a.Stop()
+	}()
+}
+
+// sharedAlerters holds one Alerter per Statistics shared through Options.Stats
+var sharedAlerters = struct {
+	sync.Mutex
+	m map[*tcpconn.Statistics]*sharedAlerter
+}{m: make(map[*tcpconn.Statistics]*sharedAlerter)}
+
+// sharedAlerter is an Alerter with the number of open connections using it
+type sharedAlerter struct {
+	a    *tcpconn.Alerter
+	refs int
+}
+
+// startSharedAlerts attaches the connection to the Alerter of its shared
+// statistics, starting it with opts for the first connection. The Alerter
+// stops when the last connection using it closes.
+func (c *Conn) startSharedAlerts(opts Options) {
+	stats := c.stats
+
+	sharedAlerters.Lock()
+	sa, ok := sharedAlerters.m[stats]
+	if !ok {
+		a, err := stats.StartAlerter(opts.alertInterval(), opts.Alerts...)
+		if err != nil {
+			sharedAlerters.Unlock()
+			log.Error().Err(err).Msg("Failed to start shared statistics alerts")
+			return
+		}
+		a.OnAlert(func(ev tcpconn.AlertEvent) {
+			if !ev.Firing {
+				log.Info().Str("rule", ev.Rule).Float64("value", ev.Value).Msg("Shared statistics recovered")
+				return
+			}
+			log.Warn().Str("rule", ev.Rule).Float64("value", ev.Value).
+				Float64("threshold", ev.Threshold).Msg("Shared statistics unhealthy")
+		})
+		sa = &sharedAlerter{a: a}
+		sharedAlerters.m[stats] = sa
+	}
+	sa.refs++
+	sharedAlerters.Unlock()
+	c.alerter = sa.a
+
+	go func() {
+		<-c.closeChan
+
+		sharedAlerters.Lock()
+		defer sharedAlerters.Unlock()
+		sa.refs--
+		if sa.refs == 0 {
+			sa.a.Stop()
+			delete(sharedAlerters.m, stats)
+		}
+	}()
+}
+
+// Alerts returns the names of the connection's alert rules that are firing
+func (c *Conn) Alerts() []string {
+	if c.alerter == nil {
+		return nil
+	}
+	return c.alerter.Firing()
+}
+
+// abort resets the connection: it sends RST and closes without a FIN exchange.
+// reason is recorded in the state transition history.
+func (c *Conn) abort(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || c.state.GetState() == tcpconn.CLOSED {
+		return
+	}
+
+	c.sendControlPacket(false, false, false, true) // RST
+	c.stats.RecordReset()
+	c.resetState(tcpconn.TransitionMeta{Seq: c.seqNum, Ack: c.ackNum, Reason: reason}) // CLOSED closes closeChan
+	c.closed = true
+	c.cond.Broadcast()
+}
@@ -0,0 +1,132 @@
+package tcpv2
+
+import (
+	"net"
+	"tcpconn"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConn_ShedUnhealthy(t *testing.T) {
+	opts := Options{
+		Alerts: []tcpconn.AlertRule{{
+			Name:   "errors",
+			Metric: tcpconn.AlertErrors,
+			Window: time.Second,
+		}},
+		AlertInterval: 10 * time.Millisecond,
+		ShedUnhealthy: true,
+	}
+	l, client, server := dialPair(t, opts)
+	defer l.Close()
+	defer client.Close()
+
+	require.Empty(t, server.Alerts())
+	server.stats.RecordError()
+
+	require.Eventually(t, func() bool {
+		return server.state.GetState() == tcpconn.CLOSED
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"errors"}, server.Alerts())
+
+	// The peer receives the RST
+	require.Eventually(t, func() bool {
+		return client.(*Conn).state.GetState() == tcpconn.CLOSED
+	}, 2*time.Second, 10*time.Millisecond)
+	require.NotZero(t, server.Stats().Resets)
+}
+
+func TestConn_SharedStatsAlertOnce(t *testing.T) {
+	shared := tcpconn.NewStatistics()
+	opts := Options{
+		Stats: shared,
+		Alerts: []tcpconn.AlertRule{{
+			Name:   "errors",
+			Metric: tcpconn.AlertErrors,
+			Window: time.Second,
+		}},
+		AlertInterval: 10 * time.Millisecond,
+	}
+	l, client, server := dialPair(t, opts)
+	defer l.Close()
+
+	accepted := make(chan *Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	client2, err := DialWithOptions(l.Addr().String(), opts)
+	require.NoError(t, err)
+	server2 := <-accepted
+
+	// Every connection recording into shared uses the same Alerter
+	require.NotNil(t, server.alerter)
+	require.Same(t, server.alerter, server2.alerter)
+	require.Same(t, server.alerter, client.(*Conn).alerter)
+	require.Same(t, server.alerter, client2.(*Conn).alerter)
+
+	events := server.alerter.Subscribe(8)
+	shared.RecordError()
+	select {
+	case ev := <-events:
+		require.True(t, ev.Firing)
+	case <-time.After(2 * time.Second):
+		t.Fatal("alert did not fire")
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("duplicate alert %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Equal(t, []string{"errors"}, server2.Alerts())
+
+	// The Alerter stops with the last connection sharing it
+	for _, c := range []net.Conn{client, client2, server, server2} {
+		c.Close()
+	}
+	require.Eventually(t, func() bool {
+		sharedAlerters.Lock()
+		defer sharedAlerters.Unlock()
+		_, ok := sharedAlerters.m[shared]
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOptions_SharedStatsShed(t *testing.T) {
+	opts := Options{Stats: tcpconn.NewStatistics(), ShedUnhealthy: true}
+
+	_, err := ListenWithOptions("127.0.0.1:0", opts)
+	require.ErrorIs(t, err, ErrSharedStatsShed)
+
+	_, err = DialWithOptions("127.0.0.1:9", opts)
+	require.ErrorIs(t, err, ErrSharedStatsShed)
+}
+
+func TestOptions_InvalidAlertRule(t *testing.T) {
+	opts := Options{Alerts: []tcpconn.AlertRule{{Name: "broken"}}}
+
+	_, err := ListenWithOptions("127.0.0.1:0", opts)
+	require.ErrorIs(t, err, tcpconn.ErrInvalidAlertRule)
+
+	_, err = DialWithOptions("127.0.0.1:9", opts)
+	require.ErrorIs(t, err, tcpconn.ErrInvalidAlertRule)
+}
+
+func TestOptions_AlertWindowShorterThanInterval(t *testing.T) {
+	opts := Options{Alerts: []tcpconn.AlertRule{{
+		Name:   "errors",
+		Metric: tcpconn.AlertErrors,
+		Window: 500 * time.Millisecond,
+	}}}
+
+	// DefaultAlertInterval is longer than the window
+	_, err := ListenWithOptions("127.0.0.1:0", opts)
+	require.ErrorIs(t, err, tcpconn.ErrInvalidAlertRule)
+
+	_, err = DialWithOptions("127.0.0.1:9", opts)
+	require.ErrorIs(t, err, tcpconn.ErrInvalidAlertRule)
+}
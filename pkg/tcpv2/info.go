@@ -0,0 +1,71 @@
+package tcpv2
+
+import (
+	"fmt"
+	"tcpconn"
+	"time"
+)
+
+// ConnInfo is a point-in-time view of connection internals, modelled on
+// Linux struct tcp_info
+type ConnInfo struct {
+	State tcpconn.TCPState
+
+	// RFC 6298 timer state
+	SRTT    time.Duration
+	RTTVar  time.Duration
+	RTO     time.Duration
+	Backoff int // consecutive RTO doublings since the last RTT sample
+
+	SndNxt uint32 // next sequence number to send
+	RcvNxt uint32 // next sequence number expected from the peer
+
+	BytesInFlight int // payload bytes sent but not yet acknowledged
+	Unacked       int // segments in the send queue
+	OutOfOrder    int // segments held in the receive queue
+	ReadBuffered  int // bytes waiting in the read buffer
+
+	PeerWindow  uint16 // last window advertised by the peer
+	LocalWindow int    // free space in the local read buffer
+
+	Retransmits  uint64
+	InboundDrops uint64
+}
+
+// Info returns a consistent snapshot of the connection internals.
+// It is safe to call concurrently with Read, Write and packet handling.
+func (c *Conn) Info() ConnInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info := ConnInfo{
+		State:        c.state.GetState(),
+		SRTT:         c.srtt,
+		RTTVar:       c.rttvar,
+		RTO:          c.rto,
+		Backoff:      c.backoff,
+		SndNxt:       c.seqNum,
+		RcvNxt:       c.ackNum,
+		Unacked:      len(c.sendQueue),
+		OutOfOrder:   len(c.receiveQueue),
+		ReadBuffered: c.readBuffer.Available(),
+		PeerWindow:   c.remoteWin,
+		LocalWindow:  int(c.recvWindow()),
+		Retransmits:  c.retransmits,
+		InboundDrops: c.inboundDrops.Load(),
+	}
+	for _, p := range c.sendQueue {
+		info.BytesInFlight += len(p.Payload)
+	}
+
+	return info
+}
+
+// String formats the info as a single line suitable for logs
+func (i ConnInfo) String() string {
+	return fmt.Sprintf("state=%s srtt=%v rttvar=%v rto=%v backoff=%d snd_nxt=%d rcv_nxt=%d "+
+		"inflight=%dB unacked=%d ooo=%d rbuf=%dB peer_wnd=%d local_wnd=%d retrans=%d drops=%d",
+		i.State, i.SRTT, i.RTTVar, i.RTO, i.Backoff, i.SndNxt, i.RcvNxt,
+		i.BytesInFlight, i.Unacked, i.OutOfOrder, i.ReadBuffered,
+		i.PeerWindow, i.LocalWindow, i.Retransmits, i.InboundDrops)
+}
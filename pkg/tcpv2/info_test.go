@@ -0,0 +1,108 @@
+package tcpv2
+
+import (
+	"net"
+	"sync"
+	"tcpconn"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConn_Info(t *testing.T) {
+	mockConn := NewMockPacketConn()
+	remoteAddr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1").To4(), Port: 12345}
+	c := NewConn(mockConn, remoteAddr)
+	defer c.Close()
+
+	c.state.ProcessEvent(tcpconn.PASSIVE_OPEN)
+	c.state.ProcessEvent(tcpconn.SYN)
+	c.state.ProcessEvent(tcpconn.ACK)
+	c.seqNum = 100
+	c.ackNum = 200
+
+	info := c.Info()
+	require.Equal(t, tcpconn.ESTABLISHED, info.State)
+	require.Equal(t, InitialRTO, info.RTO)
+	require.Zero(t, info.BytesInFlight)
+	require.Equal(t, DefaultWindowSize, info.LocalWindow)
+
+	_, err := c.Write([]byte("in flight"))
+	require.NoError(t, err)
+
+	// Out-of-order data from the peer and a smaller advertised window
+	c.HandlePacket(NewPacket(12345, 8080, 210, 100, false, true, false, false, 1000, []byte("later")))
+
+	info = c.Info()
+	require.Equal(t, uint32(109), info.SndNxt)
+	require.Equal(t, uint32(200), info.RcvNxt)
+	require.Equal(t, 9, info.BytesInFlight)
+	require.Equal(t, 1, info.Unacked)
+	require.Equal(t, 1, info.OutOfOrder)
+	require.Equal(t, uint16(1000), info.PeerWindow)
+
+	str := info.String()
+	require.Contains(t, str, "state=ESTABLISHED")
+	require.Contains(t, str, "inflight=9B")
+	require.Contains(t, str, "ooo=1")
+	require.Contains(t, str, "peer_wnd=1000")
+}
+
+func TestConn_InfoBackoff(t *testing.T) {
+	mockConn := NewMockPacketConn()
+	remoteAddr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1").To4(), Port: 12345}
+	c := NewConn(mockConn, remoteAddr)
+	defer c.Close()
+
+	c.state.ProcessEvent(tcpconn.PASSIVE_OPEN)
+	c.state.ProcessEvent(tcpconn.SYN)
+	c.state.ProcessEvent(tcpconn.ACK)
+
+	c.mu.Lock()
+	c.rto = MinRTO
+	c.mu.Unlock()
+
+	_, err := c.Write([]byte("lost"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		info := c.Info()
+		return info.Backoff >= 1 && info.Retransmits >= 1 && info.RTO >= 2*MinRTO
+	}, 3*time.Second, 20*time.Millisecond)
+
+	// A fresh RTT sample resets the backoff
+	c.mu.Lock()
+	c.updateRTO(10 * time.Millisecond)
+	c.mu.Unlock()
+	require.Zero(t, c.Info().Backoff)
+}
+
+func TestConn_InfoConcurrent(t *testing.T) {
+	mockConn := NewMockPacketConn()
+	remoteAddr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1").To4(), Port: 12345}
+	c := NewConn(mockConn, remoteAddr)
+	defer c.Close()
+
+	c.state.ProcessEvent(tcpconn.PASSIVE_OPEN)
+	c.state.ProcessEvent(tcpconn.SYN)
+	c.state.ProcessEvent(tcpconn.ACK)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = c.Info().String()
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.HandlePacket(NewPacket(12345, 8080, uint32(1000+i*100+j), 0, false, true, false, false, 4096, []byte("x")))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,84 @@
+package tcpv2
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tcpconn"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListener_MetricsScrape(t *testing.T) {
+	l, client, server := dialPair(t, Options{})
+	defer l.Close()
+	defer client.Close()
+
+	_, err := client.Write([]byte("metrics"))
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	_, err = server.Read(buf)
+	require.NoError(t, err)
+
+	exporter := tcpconn.NewMetricsExporter("tcpv2")
+	exporter.Register("listener", l)
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	text := string(body)
+
+	require.Equal(t, tcpconn.OpenMetricsContentType, resp.Header.Get("Content-Type"))
+	require.Contains(t, text, "# TYPE tcpv2_packets_retried counter\n")
+
+	connLine := fmt.Sprintf(`tcpv2_received_bytes_total{conn="%s",listener="%s"} %d`,
+		server.RemoteAddr(), l.Addr(), server.Stats().BytesReceived)
+	require.Contains(t, text, connLine)
+	require.Contains(t, text, fmt.Sprintf(`tcpv2_errors_total{conn="listener",listener="%s"} 0`, l.Addr()))
+	require.True(t, strings.HasSuffix(text, "# EOF\n"))
+}
+
+func TestListener_MetricsScrapeAfterClose(t *testing.T) {
+	l, client, server := dialPair(t, Options{})
+	defer l.Close()
+
+	_, err := client.Write([]byte("metrics"))
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	_, err = server.Read(buf)
+	require.NoError(t, err)
+
+	// The client closes first, so the server reaches CLOSED and is forgotten
+	require.NoError(t, client.Close())
+	require.Eventually(t, func() bool {
+		return server.state.GetState() == tcpconn.CLOSE_WAIT
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, server.Close())
+	require.Eventually(t, func() bool {
+		return len(l.ConnectionStats()) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	var listener tcpconn.Snapshot
+	series := 0
+	l.CollectSnapshots(func(labels tcpconn.Labels, snap tcpconn.Snapshot) {
+		series++
+		if labels["conn"] == "listener" {
+			listener = snap
+		}
+	})
+
+	// The closed connection's counters stay in the listener series
+	require.Equal(t, 1, series)
+	require.Equal(t, server.Stats().BytesReceived, listener.BytesReceived)
+	require.Equal(t, l.Stats().PacketsReceived, listener.PacketsReceived)
+	require.Zero(t, listener.RecvRateBytesPerSec)
+}
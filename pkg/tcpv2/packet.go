@@ -1,6 +1,8 @@
 package tcpv2
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
 
@@ -9,6 +11,24 @@ import (
 	"github.com/rs/zerolog"
 )
 
+var (
+	// ErrTruncated is returned when a segment is shorter than its header claims
+	ErrTruncated = errors.New("truncated TCP segment")
+	// ErrBadHeader is returned when the data offset is below the minimal header size
+	ErrBadHeader = errors.New("malformed TCP header")
+	// ErrBadOptions is returned when the TCP options area cannot be parsed
+	ErrBadOptions = errors.New("malformed TCP options")
+	// ErrBadChecksum is returned when the checksum does not match the pseudo-header and segment
+	ErrBadChecksum = errors.New("bad TCP checksum")
+	// ErrIPv4Only is returned when a segment is encoded or checked for non-IPv4 addresses
+	ErrIPv4Only = errors.New("only IPv4 addresses are supported")
+)
+
+const (
+	tcpHeaderLen    = 20
+	tcpMaxHeaderLen = 60
+)
+
 func init() {
 	zerolog.SetGlobalLevel(zerolog.ErrorLevel)
 }
@@ -40,13 +60,14 @@ func NewPacket(srcPort, dstPort uint16, seq, ack uint32, syn, ack_flag, fin, rst
 	}
 }
 
-// Encode serializes the packet to bytes (IPv4 only)
+// Encode serializes the packet to bytes (IPv4 only) using gopacket.
+// The connection hot path uses EncodeTo instead.
 func (p *Packet) Encode(srcIP, dstIP net.IP) ([]byte, error) {
 	// Convert to IPv4
 	srcIPv4 := srcIP.To4()
 	dstIPv4 := dstIP.To4()
 	if srcIPv4 == nil || dstIPv4 == nil {
-		return nil, fmt.Errorf("only IPv4 addresses are supported")
+		return nil, fmt.Errorf("failed to encode packet: %w", ErrIPv4Only)
 	}
 
 	// Set network layer for checksum calculation
@@ -79,7 +100,8 @@ func (p *Packet) Encode(srcIP, dstIP net.IP) ([]byte, error) {
 	return buffer.Bytes(), nil
 }
 
-// DecodePacket decodes a byte slice into a Packet
+// DecodePacket decodes a byte slice into a Packet using gopacket, including
+// TCP options. It does not validate the checksum, see DecodePacketFrom.
 func DecodePacket(data []byte) (*Packet, error) {
 	packet := gopacket.NewPacket(data, layers.LayerTypeTCP, gopacket.Default)
 
@@ -96,6 +118,101 @@ func DecodePacket(data []byte) (*Packet, error) {
 	}, nil
 }
 
+// DecodePacketFrom validates and decodes a segment received from srcIP and
+// addressed to dstIP. Unlike DecodePacket it verifies the header length, the
+// options area and the checksum over the IPv4 pseudo-header. Like DecodePacket
+// it fills TCP.Options; the connection hot path uses decodeFrom instead.
+func DecodePacketFrom(data []byte, srcIP, dstIP net.IP) (*Packet, error) {
+	if err := validateSegment(data, srcIP, dstIP); err != nil {
+		return nil, err
+	}
+	return DecodePacket(data)
+}
+
+// decodeFrom validates data and decodes it into p without allocating.
+// Options are validated but not materialized, see DecodeInto.
+func decodeFrom(data []byte, srcIP, dstIP net.IP, p *Packet) error {
+	if err := validateSegment(data, srcIP, dstIP); err != nil {
+		return err
+	}
+	return DecodeInto(data, p)
+}
+
+// validateSegment checks the raw TCP segment before it is handed to the decoder
+func validateSegment(data []byte, srcIP, dstIP net.IP) error {
+	if len(data) < tcpHeaderLen {
+		return fmt.Errorf("%w: %d bytes, need at least %d", ErrTruncated, len(data), tcpHeaderLen)
+	}
+
+	hdrLen := int(data[12]>>4) * 4
+	if hdrLen < tcpHeaderLen {
+		return fmt.Errorf("%w: data offset %d bytes", ErrBadHeader, hdrLen)
+	}
+	if hdrLen > len(data) {
+		return fmt.Errorf("%w: header is %d bytes, segment is %d", ErrTruncated, hdrLen, len(data))
+	}
+
+	if err := validateOptions(data[tcpHeaderLen:hdrLen]); err != nil {
+		return err
+	}
+
+	srcIPv4 := srcIP.To4()
+	dstIPv4 := dstIP.To4()
+	if srcIPv4 == nil || dstIPv4 == nil {
+		return ErrIPv4Only
+	}
+	if tcpChecksum(data, srcIPv4, dstIPv4) != 0 {
+		return fmt.Errorf("%w: stored 0x%04x", ErrBadChecksum, binary.BigEndian.Uint16(data[16:18]))
+	}
+
+	return nil
+}
+
+// validateOptions walks the options area and checks every option length
+func validateOptions(opts []byte) error {
+	for i := 0; i < len(opts); {
+		kind := opts[i]
+		switch kind {
+		case 0: // End of option list
+			return nil
+		case 1: // NOP
+			i++
+			continue
+		}
+
+		if i+1 >= len(opts) {
+			return fmt.Errorf("%w: option %d has no length", ErrBadOptions, kind)
+		}
+		length := int(opts[i+1])
+		if length < 2 || i+length > len(opts) {
+			return fmt.Errorf("%w: option %d has length %d", ErrBadOptions, kind, length)
+		}
+
+		var valid bool
+		switch kind {
+		case 2: // MSS
+			valid = length == 4
+		case 3: // Window scale
+			valid = length == 3
+		case 4: // SACK permitted
+			valid = length == 2
+		case 5: // SACK blocks
+			valid = length > 2 && (length-2)%8 == 0
+		case 8: // Timestamps
+			valid = length == 10
+		default:
+			valid = true
+		}
+		if !valid {
+			return fmt.Errorf("%w: option %d has length %d", ErrBadOptions, kind, length)
+		}
+
+		i += length
+	}
+
+	return nil
+}
+
 // String returns a string representation of the packet
 func (p *Packet) String() string {
 	var flags []string
@@ -159,3 +159,117 @@ func TestPacketEncoding_AllFlags(t *testing.T) {
 		})
 	}
 }
+
+func TestDecodePacketFrom_Valid(t *testing.T) {
+	srcIP := net.ParseIP("10.0.0.1").To4()
+	dstIP := net.ParseIP("10.0.0.2").To4()
+
+	pkt := NewPacket(1234, 5678, 100, 200, false, true, false, false, 1024, []byte("payload"))
+	raw, err := pkt.Encode(srcIP, dstIP)
+	require.NoError(t, err)
+
+	decoded, err := DecodePacketFrom(raw, srcIP, dstIP)
+	require.NoError(t, err)
+	require.Equal(t, uint32(100), decoded.TCP.Seq)
+	require.Equal(t, []byte("payload"), decoded.Payload)
+}
+
+func TestDecodePacketFrom_Errors(t *testing.T) {
+	srcIP := net.ParseIP("10.0.0.1").To4()
+	dstIP := net.ParseIP("10.0.0.2").To4()
+
+	pkt := NewPacket(1234, 5678, 100, 200, false, true, false, false, 1024, []byte("payload"))
+	raw, err := pkt.Encode(srcIP, dstIP)
+	require.NoError(t, err)
+
+	withOptions := func(opts []byte) []byte {
+		tcp := &layers.TCP{
+			SrcPort: 1234, DstPort: 5678, Seq: 1, ACK: true, Window: 1024,
+		}
+		require.NoError(t, tcp.SetNetworkLayerForChecksum(&layers.IPv4{
+			SrcIP: srcIP, DstIP: dstIP, Protocol: layers.IPProtocolTCP,
+		}))
+		buffer := gopacket.NewSerializeBuffer()
+		serializeOpts := gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}
+		require.NoError(t, gopacket.SerializeLayers(buffer, serializeOpts, tcp))
+		data := buffer.Bytes()
+
+		// Splice raw options after the fixed header and fix up offset and checksum
+		seg := append(append([]byte{}, data[:tcpHeaderLen]...), opts...)
+		seg[12] = byte((len(seg)/4)<<4) | seg[12]&0x0F
+		seg[16], seg[17] = 0, 0
+		sum := tcpChecksum(seg, srcIP, dstIP)
+		seg[16], seg[17] = byte(sum>>8), byte(sum)
+		return seg
+	}
+
+	corrupt := append([]byte{}, raw...)
+	corrupt[len(corrupt)-1] ^= 0xFF
+
+	badOffset := append([]byte{}, raw...)
+	badOffset[12] = 4 << 4
+
+	longOffset := append([]byte{}, raw[:tcpHeaderLen]...)
+	longOffset[12] = 15 << 4
+
+	tests := []struct {
+		name    string
+		data    []byte
+		src     net.IP
+		wantErr error
+	}{
+		{"short header", raw[:10], srcIP, ErrTruncated},
+		{"offset beyond data", longOffset, srcIP, ErrTruncated},
+		{"offset below minimum", badOffset, srcIP, ErrBadHeader},
+		{"corrupted payload", corrupt, srcIP, ErrBadChecksum},
+		{"wrong source address", raw, net.ParseIP("10.0.0.3").To4(), ErrBadChecksum},
+		{"option without length", withOptions([]byte{1, 1, 1, 2}), srcIP, ErrBadOptions},
+		{"option overruns header", withOptions([]byte{2, 8, 0, 0}), srcIP, ErrBadOptions},
+		{"bad MSS length", withOptions([]byte{2, 3, 0, 1}), srcIP, ErrBadOptions},
+		{"zero option length", withOptions([]byte{9, 0, 1, 1}), srcIP, ErrBadOptions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodePacketFrom(tt.data, tt.src, dstIP)
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestDecodePacketFrom_ValidOptions(t *testing.T) {
+	srcIP := net.ParseIP("10.0.0.1").To4()
+	dstIP := net.ParseIP("10.0.0.2").To4()
+
+	tcp := &layers.TCP{
+		SrcPort: 1234,
+		DstPort: 5678,
+		Seq:     1,
+		SYN:     true,
+		Window:  1024,
+		Options: []layers.TCPOption{
+			{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xAC}},
+			{OptionType: layers.TCPOptionKindNop},
+			{OptionType: layers.TCPOptionKindWindowScale, OptionLength: 3, OptionData: []byte{7}},
+			{OptionType: layers.TCPOptionKindSACKPermitted, OptionLength: 2},
+		},
+	}
+	require.NoError(t, tcp.SetNetworkLayerForChecksum(&layers.IPv4{
+		SrcIP: srcIP, DstIP: dstIP, Protocol: layers.IPProtocolTCP,
+	}))
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}
+	require.NoError(t, gopacket.SerializeLayers(buffer, opts, tcp))
+
+	decoded, err := DecodePacketFrom(buffer.Bytes(), srcIP, dstIP)
+	require.NoError(t, err)
+	require.True(t, decoded.TCP.SYN)
+
+	// Options are returned to the caller, not only validated
+	require.GreaterOrEqual(t, len(decoded.TCP.Options), 4)
+	require.Equal(t, layers.TCPOptionKind(layers.TCPOptionKindMSS), decoded.TCP.Options[0].OptionType)
+	require.Equal(t, []byte{0x05, 0xAC}, decoded.TCP.Options[0].OptionData)
+	require.Equal(t, layers.TCPOptionKind(layers.TCPOptionKindWindowScale), decoded.TCP.Options[2].OptionType)
+	require.Equal(t, []byte{7}, decoded.TCP.Options[2].OptionData)
+	require.Equal(t, layers.TCPOptionKind(layers.TCPOptionKindSACKPermitted), decoded.TCP.Options[3].OptionType)
+}
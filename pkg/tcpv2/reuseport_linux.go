@@ -0,0 +1,23 @@
+//go:build linux
+
+package tcpv2
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePortSupported reports whether the kernel balances SO_REUSEPORT sockets by flow
+const reusePortSupported = true
+
+// reusePortControl sets SO_REUSEPORT before the socket is bound
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package tcpv2
+
+import "syscall"
+
+// reusePortSupported is false because SO_REUSEPORT does not hash flows across
+// sockets here, so a sharded Listener would not receive traffic evenly
+const reusePortSupported = false
+
+func reusePortControl(network, address string, c syscall.RawConn) error { return nil }
@@ -1,6 +1,7 @@
 package tcpv2
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"sync"
@@ -8,31 +9,174 @@ import (
 	"time"
 )
 
+// Options tunes the I/O paths of Listener and Dial
+type Options struct {
+	// BatchIO enables recvmmsg/sendmmsg and UDP GSO/GRO offload on Linux.
+	// Other platforms and non-UDP sockets fall back to one datagram per call.
+	BatchIO bool
+	// BatchSize is the number of datagrams per batch, DefaultBatchSize if zero
+	BatchSize int
+	// Shards is the number of SO_REUSEPORT sockets a Listener opens, each with
+	// its own reader and connection table. The kernel hashes flows by 4-tuple.
+	// Values below 2, and platforms without SO_REUSEPORT balancing, use one socket.
+	Shards int
+	// InboundQueue is the per-connection queue depth between the listener read
+	// loop and the connection, DefaultInboundQueue if zero. Segments arriving
+	// while the queue is full are dropped and counted in Conn.InboundDrops.
+	InboundQueue int
+	// Stats, if set, is shared by the listener and every connection created
+	// with these options instead of each one owning its own Statistics
+	Stats *tcpconn.Statistics
+	// Parent, if set and Stats is not, receives everything recorded by the
+	// listener and its connections, or by a dialed connection, as a child
+	// Statistics would. Use it to roll several listeners into one root.
+	Parent *tcpconn.Statistics
+	// Alerts are evaluated against each connection's Statistics every
+	// AlertInterval (DefaultAlertInterval if zero). Firing alerts are logged.
+	// Statistics shared through Stats are evaluated once, not per connection.
+	Alerts        []tcpconn.AlertRule
+	AlertInterval time.Duration
+	// ShedUnhealthy resets a connection with RST when one of its alerts fires.
+	// It needs per-connection statistics and cannot be combined with Stats.
+	ShedUnhealthy bool
+	// TimeWait is how long an actively closed connection stays in TIME_WAIT,
+	// acknowledging retransmitted FINs, before it is forgotten. 2*MSL if zero.
+	TimeWait time.Duration
+
+	// ownStats marks Stats as created for a single connection, not shared
+	ownStats bool
+}
+
+func (o Options) batchSize() int {
+	if o.BatchSize > 0 {
+		return o.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+func (o Options) inboundQueue() int {
+	if o.InboundQueue > 0 {
+		return o.InboundQueue
+	}
+	return DefaultInboundQueue
+}
+
+// closeTimeouts bounds the closing states in which a connection waits for
+// its peer, so a listener eventually forgets connections whose peer vanished
+func (o Options) closeTimeouts() map[tcpconn.TCPState]time.Duration {
+	defaults := tcpconn.DefaultStateTimeouts()
+	timeouts := map[tcpconn.TCPState]time.Duration{
+		tcpconn.FIN_WAIT_2: defaults[tcpconn.FIN_WAIT_2],
+		tcpconn.LAST_ACK:   defaults[tcpconn.LAST_ACK],
+		tcpconn.TIME_WAIT:  defaults[tcpconn.TIME_WAIT],
+	}
+	if o.TimeWait > 0 {
+		timeouts[tcpconn.TIME_WAIT] = o.TimeWait
+	}
+	return timeouts
+}
+
+func (o Options) shards() int {
+	if o.Shards > 1 && reusePortSupported {
+		return o.Shards
+	}
+	return 1
+}
+
+// Listener accepts connections on one or more UDP sockets bound to the same address
 type Listener struct {
-	conn   net.PacketConn
-	conns  map[string]*Conn
+	shards []*listenerShard
 	mu     sync.Mutex
 	accept chan *Conn
 	closed bool
+	done   chan struct{}
+	stats  *tcpconn.Statistics // totals; parent of own and of every connection
+	own    *tcpconn.Statistics // segments handled before a connection exists
+	opts   Options
+}
+
+// listenerShard owns one socket, its read loop and the connections hashed to it
+type listenerShard struct {
+	l      *Listener
+	conn   net.PacketConn
+	conns  map[string]*Conn
+	mu     sync.Mutex
+	routes *localRoutes
+
+	// retired accumulates the counters of forgotten connections, so the
+	// listener series keeps them after the connection series disappears
+	retired tcpconn.Snapshot
 }
 
 func Listen(address string) (*Listener, error) {
-	conn, err := net.ListenPacket("udp4", address)
+	return ListenWithOptions(address, Options{})
+}
+
+// ListenWithOptions is like Listen but configures the listener with opts
+func ListenWithOptions(address string, opts Options) (*Listener, error) {
+	if err := opts.validateAlerts(); err != nil {
+		return nil, err
+	}
+
+	conns, err := listenShards(address, opts.shards())
 	if err != nil {
 		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
 	}
 
 	l := &Listener{
-		conn:   conn,
-		conns:  make(map[string]*Conn),
 		accept: make(chan *Conn, 10),
+		done:   make(chan struct{}),
+		stats:  opts.Stats,
+		own:    opts.Stats,
+		opts:   opts,
+	}
+	if l.stats == nil {
+		l.stats = newStats(opts.Parent)
+		l.own = l.stats.NewChild()
+	}
+	for _, conn := range conns {
+		l.shards = append(l.shards, &listenerShard{
+			l:      l,
+			conn:   conn,
+			conns:  make(map[string]*Conn),
+			routes: newLocalRoutes(conn.LocalAddr()),
+		})
 	}
 
-	go l.readLoop()
+	for _, sh := range l.shards {
+		go sh.readLoop()
+	}
 
 	return l, nil
 }
 
+// listenShards opens n sockets on address. The first one resolves an
+// ephemeral port that the rest then bind to with SO_REUSEPORT.
+func listenShards(address string, n int) ([]net.PacketConn, error) {
+	if n == 1 {
+		conn, err := net.ListenPacket("udp4", address)
+		if err != nil {
+			return nil, err
+		}
+		return []net.PacketConn{conn}, nil
+	}
+
+	lc := net.ListenConfig{Control: reusePortControl}
+	conns := make([]net.PacketConn, 0, n)
+	for i := 0; i < n; i++ {
+		conn, err := lc.ListenPacket(context.Background(), "udp4", address)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+		address = conn.LocalAddr().String()
+	}
+	return conns, nil
+}
+
 func (l *Listener) Accept() (*Conn, error) {
 	c, ok := <-l.accept
 	if !ok {
@@ -51,48 +195,207 @@ func (l *Listener) Close() error {
 
 	l.closed = true
 	close(l.accept)
-	return l.conn.Close()
+	close(l.done)
+
+	var firstErr error
+	for _, sh := range l.shards {
+		if err := sh.conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 func (l *Listener) Addr() net.Addr {
-	return l.conn.LocalAddr()
+	return l.shards[0].conn.LocalAddr()
+}
+
+// Stats returns the listener totals: its own counters, such as segments
+// rejected before a connection existed, plus those of every accepted connection.
+func (l *Listener) Stats() tcpconn.Snapshot {
+	return l.stats.GetSnapshot()
+}
+
+// Statistics returns the live listener totals, e.g. for StartRecorder
+func (l *Listener) Statistics() *tcpconn.Statistics {
+	return l.stats
+}
+
+// ConnectionStats returns a snapshot per accepted connection named by remote address.
+// With Options.Stats every connection reports the shared totals.
+func (l *Listener) ConnectionStats() []tcpconn.NamedSnapshot {
+	var snaps []tcpconn.NamedSnapshot
+	for _, sh := range l.shards {
+		sh.mu.Lock()
+		for remote, c := range sh.conns {
+			snaps = append(snaps, tcpconn.NamedSnapshot{Name: remote, Snapshot: c.stats.GetSnapshot()})
+		}
+		sh.mu.Unlock()
+	}
+	return snaps
+}
+
+// WorstConnections returns at most n accepted connections ranked worst first
+func (l *Listener) WorstConnections(n int, ranking tcpconn.Ranking) []tcpconn.NamedSnapshot {
+	return tcpconn.TopN(l.ConnectionStats(), n, ranking)
 }
 
-func (l *Listener) readLoop() {
-	buf := make([]byte, 65535)
+// CollectSnapshots implements tcpconn.MetricsCollector. Every sample carries
+// a listener label; the listener's own counters use conn="listener" and each
+// connection is labelled with its remote address, so summing over conn gives
+// the listener total. Counters of closed connections move to the listener
+// series, so the sum never goes backwards. Statistics shared between
+// connections are emitted once.
+func (l *Listener) CollectSnapshots(emit func(labels tcpconn.Labels, snap tcpconn.Snapshot)) {
+	addr := l.Addr().String()
+	seen := map[*tcpconn.Statistics]bool{l.own: true}
+
+	snaps := []tcpconn.Snapshot{l.own.GetSnapshot()}
+	for _, sh := range l.shards {
+		sh.mu.Lock()
+		snaps = append(snaps, sh.retired)
+		sh.mu.Unlock()
+	}
+	emit(tcpconn.Labels{"listener": addr, "conn": "listener"}, tcpconn.MergeSnapshots(snaps...))
+
+	for _, sh := range l.shards {
+		sh.mu.Lock()
+		for remote, c := range sh.conns {
+			if !seen[c.stats] {
+				seen[c.stats] = true
+				emit(tcpconn.Labels{"listener": addr, "conn": remote}, c.stats.GetSnapshot())
+			}
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// connOptions returns the options for a new accepted connection, whose
+// Statistics is a child of the listener totals unless Options.Stats is shared
+func (l *Listener) connOptions() Options {
+	opts := l.opts
+	if opts.Stats == nil {
+		opts.Stats = l.stats.NewChild()
+		opts.ownStats = true
+	}
+	return opts
+}
+
+func (l *Listener) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+// enqueueAccept hands a new connection to Accept without blocking. It
+// returns false if the listener is closed or the accept backlog is full.
+func (l *Listener) enqueueAccept(c *Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	select {
+	case l.accept <- c:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sh *listenerShard) readLoop() {
+	reader := newDatagramReader(sh.conn, sh.l.opts)
+	var packet Packet
 	for {
-		n, addr, err := l.conn.ReadFrom(buf)
+		err := reader.ReadDatagrams(func(data []byte, addr net.Addr) {
+			sh.handleDatagram(data, addr, &packet)
+		})
 		if err != nil {
-			if !l.closed {
+			if !sh.l.isClosed() {
 				fmt.Printf("Listener read error: %v\n", err)
 			}
 			return
 		}
+	}
+}
 
-		packet, err := DecodePacket(buf[:n])
-		if err != nil {
-			continue
+// handleDatagram routes one datagram to its connection queue. It never
+// blocks on a connection; only unknown peers are decoded here to detect SYN.
+func (sh *listenerShard) handleDatagram(data []byte, addr net.Addr, packet *Packet) {
+	sh.mu.Lock()
+	c, exists := sh.conns[addr.String()]
+	sh.mu.Unlock()
+
+	if !exists {
+		// Only a SYN opens a connection; check the raw flags before any
+		// route lookup or checksum so junk from unknown peers stays cheap
+		if len(data) < tcpHeaderLen {
+			sh.l.own.RecordError()
+			return
+		}
+		if data[13]&flagSYN == 0 {
+			return
 		}
 
-		l.mu.Lock()
-		c, exists := l.conns[addr.String()]
-		if !exists {
-			if packet.TCP.SYN {
-				c = NewConn(l.conn, addr)
-				l.conns[addr.String()] = c
-				c.state.ProcessEvent(tcpconn.PASSIVE_OPEN)
-				l.accept <- c
-			}
+		local := sh.routes.resolve(addr)
+		if err := decodeFrom(data, udpIP(addr), udpIP(local), packet); err != nil {
+			sh.l.own.RecordError()
+			return
 		}
-		l.mu.Unlock()
 
-		if c != nil {
-			c.HandlePacket(packet)
+		c = newConnFrom(sh.conn, local, addr, sh.l.connOptions())
+		c.inbound = make(chan inboundSegment, sh.l.opts.inboundQueue())
+		c.state.ProcessEvent(tcpconn.PASSIVE_OPEN)
+
+		// Nobody is accepting fast enough: refuse the SYN instead of
+		// stalling the read loop of every connection on this shard
+		if !sh.l.enqueueAccept(c) {
+			c.abort("accept backlog full")
+			return
 		}
+
+		sh.mu.Lock()
+		sh.conns[addr.String()] = c
+		sh.mu.Unlock()
+		go func() {
+			c.inboundLoop(sh.l.done)
+			sh.remove(addr.String(), c)
+		}()
+	}
+
+	c.enqueueInbound(data)
+}
+
+// remove forgets a connection that reached CLOSED so a new SYN from the
+// same address opens a fresh one
+func (sh *listenerShard) remove(remote string, c *Conn) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.conns[remote] != c {
+		return
+	}
+	delete(sh.conns, remote)
+
+	if c.stats != sh.l.own {
+		snap := c.stats.GetSnapshot()
+		// Rates of a closed connection are no longer current
+		snap.SendRateBytesPerSec, snap.RecvRateBytesPerSec = 0, 0
+		snap.SendRatePacketsPerSec, snap.RecvRatePacketsPerSec = 0, 0
+		snap.Rates = nil
+		sh.retired = tcpconn.MergeSnapshots(sh.retired, snap)
 	}
 }
 
 func Dial(address string) (net.Conn, error) {
+	return DialWithOptions(address, Options{})
+}
+
+// DialWithOptions is like Dial but configures the connection with opts
+func DialWithOptions(address string, opts Options) (net.Conn, error) {
+	if err := opts.validateAlerts(); err != nil {
+		return nil, err
+	}
+
 	raddr, err := net.ResolveUDPAddr("udp", address)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resolve UDP address %s: %w", address, err)
@@ -103,26 +406,31 @@ func Dial(address string) (net.Conn, error) {
 		return nil, fmt.Errorf("failed to create UDP client socket: %w", err)
 	}
 
-	c := NewConn(conn, raddr)
+	if opts.Stats == nil && opts.Parent != nil {
+		opts.Stats = opts.Parent.NewChild()
+		opts.ownStats = true
+	}
+	c := newConn(conn, raddr, opts)
 
 	go func() {
-		buf := make([]byte, 65535)
+		reader := newDatagramReader(conn, opts)
+		var packet Packet
 		for {
-			n, addr, err := conn.ReadFrom(buf)
-			if err != nil {
-				return
-			}
+			err := reader.ReadDatagrams(func(data []byte, addr net.Addr) {
+				if addr.String() != raddr.String() {
+					return
+				}
 
-			if addr.String() != raddr.String() {
-				continue
-			}
+				if err := decodeFrom(data, udpIP(addr), udpIP(c.localAddr), &packet); err != nil {
+					c.stats.RecordError()
+					return
+				}
 
-			packet, err := DecodePacket(buf[:n])
+				c.HandlePacket(&packet)
+			})
 			if err != nil {
-				continue
+				return
 			}
-
-			c.HandlePacket(packet)
 		}
 	}()
 
@@ -130,8 +438,11 @@ func Dial(address string) (net.Conn, error) {
 		return nil, fmt.Errorf("failed to process ACTIVE_OPEN event: %w", err)
 	}
 
+	c.mu.Lock()
 	c.seqNum = 100
-	if err := c.sendControlPacket(true, false, false, false); err != nil { // SYN
+	err = c.sendControlPacket(true, false, false, false) // SYN
+	c.mu.Unlock()
+	if err != nil {
 		return nil, fmt.Errorf("failed to send SYN packet: %w", err)
 	}
 
@@ -143,6 +454,88 @@ func Dial(address string) (net.Conn, error) {
 		return nil, fmt.Errorf("connection reset by peer")
 
 	case <-time.After(5 * time.Second):
+		c.stats.RecordTimeout()
 		return nil, fmt.Errorf("handshake timeout")
 	}
 }
+
+// newStats returns a child of parent, or a root Statistics if parent is nil
+func newStats(parent *tcpconn.Statistics) *tcpconn.Statistics {
+	if parent != nil {
+		return parent.NewChild()
+	}
+	return tcpconn.NewStatistics()
+}
+
+// maxLocalRoutes bounds the per-shard route cache of a wildcard listener
+const maxLocalRoutes = 1024
+
+// localRoutes resolves the local address a shard uses towards each remote.
+// A socket bound to a specific IP resolves to itself; a wildcard socket
+// looks the route up once per remote IP. Only the shard read loop uses it.
+type localRoutes struct {
+	local    net.Addr
+	wildcard bool
+	cache    map[string]net.Addr
+}
+
+func newLocalRoutes(local net.Addr) *localRoutes {
+	laddr, ok := local.(*net.UDPAddr)
+	return &localRoutes{
+		local:    local,
+		wildcard: ok && (laddr.IP == nil || laddr.IP.IsUnspecified()),
+		cache:    make(map[string]net.Addr),
+	}
+}
+
+// resolve returns the local address towards remote
+func (r *localRoutes) resolve(remote net.Addr) net.Addr {
+	if !r.wildcard {
+		return r.local
+	}
+	ip := udpIP(remote)
+	if ip == nil {
+		return r.local
+	}
+
+	key := string(ip.To16())
+	if local, ok := r.cache[key]; ok {
+		return local
+	}
+	if len(r.cache) >= maxLocalRoutes {
+		clear(r.cache)
+	}
+	local := resolveLocalAddr(r.local, remote)
+	r.cache[key] = local
+	return local
+}
+
+// resolveLocalAddr replaces an unspecified local IP with the source address the
+// kernel routes towards remote, so both peers build the same checksum pseudo-header.
+func resolveLocalAddr(local, remote net.Addr) net.Addr {
+	laddr, ok := local.(*net.UDPAddr)
+	if !ok || (laddr.IP != nil && !laddr.IP.IsUnspecified()) {
+		return local
+	}
+	raddr, ok := remote.(*net.UDPAddr)
+	if !ok {
+		return local
+	}
+
+	// Connecting a UDP socket only performs a route lookup, nothing is sent
+	probe, err := net.DialUDP("udp4", nil, raddr)
+	if err != nil {
+		return local
+	}
+	defer probe.Close()
+
+	return &net.UDPAddr{IP: probe.LocalAddr().(*net.UDPAddr).IP, Port: laddr.Port}
+}
+
+// udpIP returns the IP of a UDP address or nil for other address types
+func udpIP(addr net.Addr) net.IP {
+	if a, ok := addr.(*net.UDPAddr); ok {
+		return a.IP
+	}
+	return nil
+}
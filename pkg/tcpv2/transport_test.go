@@ -1,7 +1,11 @@
 package tcpv2
 
 import (
+	"net"
+	"strconv"
+	"tcpconn"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -42,3 +46,380 @@ func TestListener_DoubleClose(t *testing.T) {
 	err = l.Close()
 	require.NoError(t, err)
 }
+
+func TestListener_DialAndTransfer(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	accepted := make(chan *Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	client, err := Dial(l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	server := <-accepted
+	_, err = client.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 16)
+	n, err := server.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buf[:n]))
+	require.Zero(t, l.stats.GetErrors())
+	require.Zero(t, server.stats.GetErrors())
+}
+
+func TestListener_RejectsCorruptSegment(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	conn, err := net.Dial("udp4", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	local := conn.LocalAddr().(*net.UDPAddr)
+	remote := l.Addr().(*net.UDPAddr)
+	raw, err := NewPacket(uint16(local.Port), uint16(remote.Port), 1, 0, true, false, false, false, 1024, nil).
+		Encode(local.IP, remote.IP)
+	require.NoError(t, err)
+	raw[16] ^= 0xFF
+
+	_, err = conn.Write(raw)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return l.stats.GetErrors() == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestListener_Shards(t *testing.T) {
+	l, err := ListenWithOptions("127.0.0.1:0", Options{Shards: 4})
+	require.NoError(t, err)
+	defer l.Close()
+
+	if !reusePortSupported {
+		require.Len(t, l.shards, 1)
+		return
+	}
+	require.Len(t, l.shards, 4)
+	for _, sh := range l.shards {
+		require.Equal(t, l.Addr().String(), sh.conn.LocalAddr().String())
+	}
+
+	const clients = 8
+	accepted := make(chan *Conn, clients)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	for i := 0; i < clients; i++ {
+		client, err := Dial(l.Addr().String())
+		require.NoError(t, err)
+		defer client.Close()
+
+		_, err = client.Write([]byte{byte(i)})
+		require.NoError(t, err)
+
+		server := <-accepted
+		buf := make([]byte, 1)
+		_, err = server.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, byte(i), buf[0])
+	}
+
+	total := 0
+	for _, sh := range l.shards {
+		sh.mu.Lock()
+		total += len(sh.conns)
+		sh.mu.Unlock()
+	}
+	require.Equal(t, clients, total)
+}
+
+func TestListener_ShardsCloseAll(t *testing.T) {
+	l, err := ListenWithOptions("127.0.0.1:0", Options{Shards: 3})
+	require.NoError(t, err)
+
+	require.NoError(t, l.Close())
+	for _, sh := range l.shards {
+		_, err := sh.conn.WriteTo([]byte{0}, l.Addr())
+		require.Error(t, err)
+	}
+
+	// The port is free again once every shard is closed
+	again, err := net.ListenPacket("udp4", l.Addr().String())
+	require.NoError(t, err)
+	again.Close()
+}
+
+func TestListener_SlowConnDoesNotBlockOthers(t *testing.T) {
+	l, err := ListenWithOptions("127.0.0.1:0", Options{InboundQueue: 2})
+	require.NoError(t, err)
+	defer l.Close()
+
+	accepted := make(chan *Conn, 2)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	slowClient, err := Dial(l.Addr().String())
+	require.NoError(t, err)
+	defer slowClient.Close()
+	slow := <-accepted
+
+	fastClient, err := Dial(l.Addr().String())
+	require.NoError(t, err)
+	defer fastClient.Close()
+	fast := <-accepted
+
+	// Stall the slow connection the way a long Write holding c.mu would
+	slow.mu.Lock()
+	defer slow.mu.Unlock()
+
+	_, err = slowClient.Write(make([]byte, 10*MSS))
+	require.NoError(t, err)
+
+	_, err = fastClient.Write([]byte("still flowing"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 64)
+	done := make(chan string, 1)
+	go func() {
+		n, _ := fast.Read(buf)
+		done <- string(buf[:n])
+	}()
+
+	select {
+	case got := <-done:
+		require.Equal(t, "still flowing", got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("fast connection blocked behind slow one")
+	}
+
+	require.Eventually(t, func() bool {
+		return slow.InboundDrops() > 0
+	}, time.Second, 10*time.Millisecond)
+	require.Zero(t, fast.InboundDrops())
+}
+
+func TestListener_StatsAggregate(t *testing.T) {
+	l, client, server := dialPair(t, Options{})
+	defer l.Close()
+	defer client.Close()
+
+	_, err := client.Write([]byte("aggregate"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 16)
+	_, err = server.Read(buf)
+	require.NoError(t, err)
+
+	snap := l.Stats()
+	require.Equal(t, server.Stats().PacketsReceived, snap.PacketsReceived)
+	require.GreaterOrEqual(t, snap.BytesReceived, uint64(len("aggregate")))
+	require.Equal(t, server.Stats().BytesSent, snap.BytesSent)
+}
+
+func TestListener_StatsHierarchy(t *testing.T) {
+	root := tcpconn.NewStatistics()
+	l, client, server := dialPair(t, Options{Parent: root})
+	defer l.Close()
+	defer client.Close()
+
+	_, err := client.Write([]byte("hierarchy"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 16)
+	_, err = server.Read(buf)
+	require.NoError(t, err)
+
+	// Client and listener both roll up into root
+	clientStats := client.(*Conn).Stats()
+	require.Equal(t, server.Stats().PacketsReceived, l.Stats().PacketsReceived)
+	require.GreaterOrEqual(t, root.GetPacketsSent(), l.Stats().PacketsSent+clientStats.PacketsSent)
+	require.NotZero(t, clientStats.PacketsSent)
+
+	conns := l.ConnectionStats()
+	require.Len(t, conns, 1)
+	require.Equal(t, server.RemoteAddr().String(), conns[0].Name)
+
+	worst := l.WorstConnections(5, tcpconn.ByRetransmits)
+	require.Len(t, worst, 1)
+	require.Equal(t, conns[0].Name, worst[0].Name)
+}
+
+func TestListener_RouteLookupOnlyForSYN(t *testing.T) {
+	l, err := Listen("0.0.0.0:0")
+	require.NoError(t, err)
+	defer l.Close()
+	sh := l.shards[0]
+	require.True(t, sh.routes.wildcard)
+
+	port := l.Addr().(*net.UDPAddr).Port
+	conn, err := net.Dial("udp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Junk and non-SYN segments from an unknown peer never reach the route lookup
+	local := conn.LocalAddr().(*net.UDPAddr)
+	ack, err := NewPacket(uint16(local.Port), uint16(port), 1, 1, false, true, false, false, 1024, nil).
+		Encode(local.IP, net.IPv4(127, 0, 0, 1))
+	require.NoError(t, err)
+	for _, datagram := range [][]byte{{1, 2, 3}, ack} {
+		_, err = conn.Write(datagram)
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool {
+		return l.stats.GetErrors() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Dialers share one cached route per remote IP
+	for i := 0; i < 2; i++ {
+		client, err := Dial(net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		require.NoError(t, err)
+		defer client.Close()
+	}
+	sh.mu.Lock()
+	require.Len(t, sh.conns, 2)
+	sh.mu.Unlock()
+	require.Len(t, sh.routes.cache, 1)
+	for _, addr := range sh.routes.cache {
+		require.True(t, udpIP(addr).Equal(net.IPv4(127, 0, 0, 1)))
+	}
+}
+
+func TestListener_ForgetsClosedConn(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	sh := l.shards[0]
+
+	conn, err := net.Dial("udp4", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	local := conn.LocalAddr().(*net.UDPAddr)
+	remote := l.Addr().(*net.UDPAddr)
+	syn, err := NewPacket(uint16(local.Port), uint16(remote.Port), 1, 0, true, false, false, false, 1024, nil).
+		Encode(local.IP, remote.IP)
+	require.NoError(t, err)
+
+	_, err = conn.Write(syn)
+	require.NoError(t, err)
+	first, err := l.Accept()
+	require.NoError(t, err)
+
+	// Close leaves the connection in FIN_WAIT_1 until the peer answers;
+	// the peer resets it instead, which moves it to CLOSED
+	require.NoError(t, first.Close())
+	rst, err := NewPacket(uint16(local.Port), uint16(remote.Port), 2, 0, false, false, false, true, 1024, nil).
+		Encode(local.IP, remote.IP)
+	require.NoError(t, err)
+	_, err = conn.Write(rst)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		sh.mu.Lock()
+		defer sh.mu.Unlock()
+		return len(sh.conns) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// A new SYN from the reused ip:port opens a fresh connection
+	_, err = conn.Write(syn)
+	require.NoError(t, err)
+	second, err := l.Accept()
+	require.NoError(t, err)
+	defer second.Close()
+	require.NotSame(t, first, second)
+	require.Eventually(t, func() bool {
+		return second.state.GetState() == tcpconn.SYN_RECEIVED
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestListener_CloseHandshake(t *testing.T) {
+	l, client, server := dialPair(t, Options{TimeWait: 200 * time.Millisecond})
+	defer l.Close()
+	sh := l.shards[0]
+	dialed := client.(*Conn)
+
+	// The server closes first and keeps handling the peer's ACK and FIN
+	require.NoError(t, server.Close())
+	require.Eventually(t, func() bool {
+		return server.state.GetState() == tcpconn.FIN_WAIT_2 && dialed.state.GetState() == tcpconn.CLOSE_WAIT
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, client.Close())
+	require.Eventually(t, func() bool {
+		return server.state.GetState() == tcpconn.TIME_WAIT && dialed.state.GetState() == tcpconn.CLOSED
+	}, time.Second, 10*time.Millisecond)
+
+	// TIME_WAIT expires, then the listener forgets the connection
+	require.Eventually(t, func() bool {
+		sh.mu.Lock()
+		defer sh.mu.Unlock()
+		return server.state.GetState() == tcpconn.CLOSED && len(sh.conns) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestListener_AcceptBacklogFull(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	remote := l.Addr().(*net.UDPAddr)
+
+	// Nobody calls Accept: SYNs beyond the backlog are refused with RST
+	// and the read loop keeps serving the rest
+	backlog := cap(l.accept)
+	var peers []net.Conn
+	for i := 0; i <= backlog; i++ {
+		conn, err := net.Dial("udp4", l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		peers = append(peers, conn)
+
+		local := conn.LocalAddr().(*net.UDPAddr)
+		syn, err := NewPacket(uint16(local.Port), uint16(remote.Port), 1, 0, true, false, false, false, 1024, nil).
+			Encode(local.IP, remote.IP)
+		require.NoError(t, err)
+		_, err = conn.Write(syn)
+		require.NoError(t, err)
+	}
+
+	last := peers[backlog]
+	require.NoError(t, last.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 1500)
+	n, err := last.Read(buf)
+	require.NoError(t, err)
+	reply, err := DecodePacket(buf[:n])
+	require.NoError(t, err)
+	require.True(t, reply.TCP.RST)
+
+	require.Eventually(t, func() bool { return len(l.accept) == backlog }, time.Second, 10*time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- l.Close() }()
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on a full accept backlog")
+	}
+}
@@ -0,0 +1,117 @@
+package tcpconn
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRateWindows - окна расчёта скорости по умолчанию. Первое окно
+// основное: по нему считаются GetSendRate, GetRecvRate и поля скорости Snapshot.
+var DefaultRateWindows = []time.Duration{10 * time.Second, time.Second, time.Minute}
+
+// minRateSpan ограничивает снизу интервал, на который делится объём в первые
+// мгновения после создания или сброса, чтобы единичный пакет не давал всплеск
+const minRateSpan = 100 * time.Millisecond
+
+// WindowRate - скорость передачи, усреднённая по окну
+type WindowRate struct {
+	Window            time.Duration
+	SendBytesPerSec   float64
+	RecvBytesPerSec   float64
+	SendPacketsPerSec float64
+	RecvPacketsPerSec float64
+}
+
+// rateBucket накапливает объём за одну секунду
+type rateBucket struct {
+	sec     atomic.Int64
+	bytes   atomic.Uint64
+	packets atomic.Uint64
+}
+
+// rateCounter - кольцо посекундных интервалов. Запись стоит O(1) атомарных
+// операций; блокировка берётся только раз в секунду при смене интервала.
+type rateCounter struct {
+	buckets []rateBucket
+	mu      sync.Mutex
+	start   atomic.Int64 // UnixNano создания или сброса
+}
+
+func newRateCounter(maxWindow time.Duration, now time.Time) *rateCounter {
+	c := &rateCounter{buckets: make([]rateBucket, windowSeconds(maxWindow)+1)}
+	c.start.Store(now.UnixNano())
+	return c
+}
+
+// windowSeconds округляет окно вверх до целых секунд, но не меньше одной
+func windowSeconds(window time.Duration) int64 {
+	sec := int64((window + time.Second - 1) / time.Second)
+	if sec < 1 {
+		return 1
+	}
+	return sec
+}
+
+func (c *rateCounter) record(now time.Time, bytes uint64) {
+	sec := now.Unix()
+	b := &c.buckets[sec%int64(len(c.buckets))]
+
+	if b.sec.Load() < sec {
+		c.mu.Lock()
+		if b.sec.Load() < sec {
+			b.bytes.Store(0)
+			b.packets.Store(0)
+			b.sec.Store(sec)
+		}
+		c.mu.Unlock()
+	}
+
+	b.bytes.Add(bytes)
+	b.packets.Add(1)
+}
+
+// rate возвращает байты и пакеты в секунду за окно, заканчивающееся в now.
+// Самый старый интервал учитывается частично, пропорционально доле окна,
+// которую он покрывает, поэтому скорость не скачет на границах секунд.
+func (c *rateCounter) rate(window time.Duration, now time.Time) (bytesPerSec, packetsPerSec float64) {
+	w := windowSeconds(window)
+	if maxW := int64(len(c.buckets)) - 1; w > maxW {
+		w = maxW
+	}
+
+	nowSec := now.Unix()
+	frac := float64(now.UnixNano()-nowSec*int64(time.Second)) / float64(time.Second)
+
+	var bytes, packets float64
+	for i := int64(0); i <= w; i++ {
+		sec := nowSec - i
+		b := &c.buckets[sec%int64(len(c.buckets))]
+		if b.sec.Load() != sec {
+			continue
+		}
+		weight := 1.0
+		if i == w {
+			weight = 1 - frac
+		}
+		bytes += weight * float64(b.bytes.Load())
+		packets += weight * float64(b.packets.Load())
+	}
+
+	span := time.Duration(w) * time.Second
+	if elapsed := now.Sub(time.Unix(0, c.start.Load())); elapsed < span {
+		span = max(elapsed, minRateSpan)
+	}
+	return bytes / span.Seconds(), packets / span.Seconds()
+}
+
+func (c *rateCounter) reset(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.buckets {
+		c.buckets[i].sec.Store(0)
+		c.buckets[i].bytes.Store(0)
+		c.buckets[i].packets.Store(0)
+	}
+	c.start.Store(now.UnixNano())
+}
@@ -0,0 +1,153 @@
+package tcpconn
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func approxEqual(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance*want
+}
+
+func TestRateCounter_Steady(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := newRateCounter(time.Minute, start)
+
+	// 100 пакетов по 1000 байт в секунду в течение 90 секунд
+	now := start
+	for i := 0; i < 9000; i++ {
+		c.record(now, 1000)
+		now = now.Add(10 * time.Millisecond)
+	}
+
+	for _, w := range []time.Duration{time.Second, 10 * time.Second, time.Minute} {
+		bytes, packets := c.rate(w, now.Add(-5*time.Millisecond))
+		if !approxEqual(bytes, 100000, 0.02) {
+			t.Errorf("rate(%v) bytes = %.0f, want ~100000", w, bytes)
+		}
+		if !approxEqual(packets, 100, 0.02) {
+			t.Errorf("rate(%v) packets = %.1f, want ~100", w, packets)
+		}
+	}
+}
+
+func TestRateCounter_Windows(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := newRateCounter(time.Minute, start)
+
+	// Всплеск 6000 байт в первую секунду, затем тишина
+	for i := 0; i < 6; i++ {
+		c.record(start.Add(time.Duration(i)*100*time.Millisecond), 1000)
+	}
+
+	now := start.Add(30 * time.Second)
+	if bytes, _ := c.rate(time.Second, now); bytes != 0 {
+		t.Errorf("1s rate = %.0f, want 0 after idle", bytes)
+	}
+	if bytes, _ := c.rate(10*time.Second, now); bytes != 0 {
+		t.Errorf("10s rate = %.0f, want 0 after idle", bytes)
+	}
+	// С момента создания прошло 30 секунд, окно 60 секунд делится на них
+	if bytes, _ := c.rate(time.Minute, now); !approxEqual(bytes, 200, 0.01) {
+		t.Errorf("60s rate = %.2f, want 200", bytes)
+	}
+
+	// Окна длиннее наибольшего укорачиваются до него
+	now = start.Add(50 * time.Second)
+	if bytes, _ := c.rate(time.Hour, now); !approxEqual(bytes, 120, 0.01) {
+		t.Errorf("1h rate = %.2f, want clamped to 60s rate 120", bytes)
+	}
+
+	// Через две минуты старые интервалы не учитываются
+	if bytes, _ := c.rate(time.Minute, start.Add(2*time.Minute)); bytes != 0 {
+		t.Errorf("60s rate after 2m = %.2f, want 0", bytes)
+	}
+}
+
+func TestRateCounter_ShortUptime(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := newRateCounter(10*time.Second, start)
+
+	c.record(start, 500)
+	c.record(start.Add(100*time.Millisecond), 500)
+
+	// Делим на прошедшее время, а не на всё окно
+	bytes, packets := c.rate(10*time.Second, start.Add(500*time.Millisecond))
+	if !approxEqual(bytes, 2000, 0.01) || !approxEqual(packets, 4, 0.01) {
+		t.Errorf("rate = %.0f B/s, %.1f pkt/s, want 2000 and 4", bytes, packets)
+	}
+
+	c.reset(start.Add(time.Second))
+	if bytes, _ := c.rate(10*time.Second, start.Add(2*time.Second)); bytes != 0 {
+		t.Errorf("rate after reset = %.0f, want 0", bytes)
+	}
+}
+
+func TestRateCounter_Concurrent(t *testing.T) {
+	c := newRateCounter(10*time.Second, time.Now())
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.record(time.Now(), 10)
+				if i%100 == 0 {
+					c.rate(time.Second, time.Now())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Все записи уложились в окно 10 секунд
+	_, packets := c.rate(10*time.Second, time.Now())
+	if packets <= 0 {
+		t.Errorf("packets rate = %.2f, want > 0", packets)
+	}
+}
+
+func TestStatistics_RateWindows(t *testing.T) {
+	stats := NewStatisticsWithWindows(2*time.Second, 500*time.Millisecond)
+
+	windows := stats.GetRateWindows()
+	if len(windows) != 2 || windows[0] != 2*time.Second {
+		t.Fatalf("GetRateWindows() = %v, want [2s 500ms]", windows)
+	}
+
+	stats.RecordPacketSent(1000)
+	stats.RecordPacketReceived(2000)
+
+	snap := stats.GetSnapshot()
+	if len(snap.Rates) != 2 {
+		t.Fatalf("len(Rates) = %d, want 2", len(snap.Rates))
+	}
+	if snap.Rates[0].SendBytesPerSec != snap.SendRateBytesPerSec {
+		t.Errorf("primary rate %.0f differs from SendRateBytesPerSec %.0f",
+			snap.Rates[0].SendBytesPerSec, snap.SendRateBytesPerSec)
+	}
+	if snap.RecvRateBytesPerSec <= snap.SendRateBytesPerSec {
+		t.Errorf("recv rate %.0f, want above send rate %.0f", snap.RecvRateBytesPerSec, snap.SendRateBytesPerSec)
+	}
+	if !strings.Contains(snap.String(), "Rates (send / recv)") {
+		t.Error("String() missing rates")
+	}
+
+	merged := MergeSnapshots(snap, snap)
+	if len(merged.Rates) != 2 || merged.Rates[1].RecvBytesPerSec != 2*snap.Rates[1].RecvBytesPerSec {
+		t.Errorf("merged rates = %+v, want doubled %+v", merged.Rates, snap.Rates)
+	}
+}
+
+func BenchmarkStatistics_RecordPacketSentParallel(b *testing.B) {
+	stats := NewStatistics()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			stats.RecordPacketSent(1000)
+		}
+	})
+}
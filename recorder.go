@@ -0,0 +1,280 @@
+package tcpconn
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrInvalidInterval возвращается при запуске записи с неположительным интервалом
+var ErrInvalidInterval = errors.New("interval must be greater than zero")
+
+// Recorder периодически снимает статистику и хранит последние capacity
+// снимков в кольцевом буфере. Старые снимки вытесняются новыми.
+type Recorder struct {
+	stats    *Statistics
+	interval time.Duration
+
+	buffer   []Snapshot
+	capacity int
+	size     int
+	head     int // позиция для следующей записи
+	mu       sync.Mutex
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// StartRecorder запускает запись снимков каждые interval, храня не более capacity
+// последних. Первый снимок делается сразу. Запись останавливается методом Stop.
+func (s *Statistics) StartRecorder(interval time.Duration, capacity int) (*Recorder, error) {
+	if capacity <= 0 {
+		return nil, ErrInvalidCapacity
+	}
+	if interval <= 0 {
+		return nil, ErrInvalidInterval
+	}
+
+	r := newRecorder(s, interval, capacity)
+	r.record(s.GetSnapshot())
+
+	go r.run()
+	return r, nil
+}
+
+// newRecorder создаёт хранилище снимков без фоновой записи
+func newRecorder(s *Statistics, interval time.Duration, capacity int) *Recorder {
+	return &Recorder{
+		stats:    s,
+		interval: interval,
+		buffer:   make([]Snapshot, capacity),
+		capacity: capacity,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.record(r.stats.GetSnapshot())
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *Recorder) record(snap Snapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buffer[r.head] = snap
+	r.head = (r.head + 1) % r.capacity
+	if r.size < r.capacity {
+		r.size++
+	}
+}
+
+// Stop останавливает запись; накопленные снимки остаются доступны.
+// Повторные вызовы безопасны.
+func (r *Recorder) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+// Interval возвращает период записи
+func (r *Recorder) Interval() time.Duration {
+	return r.interval
+}
+
+// Len возвращает количество хранимых снимков
+func (r *Recorder) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.size
+}
+
+// Snapshots возвращает хранимые снимки от старых к новым
+func (r *Recorder) Snapshots() []Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]Snapshot, r.size)
+	tail := (r.head - r.size + r.capacity) % r.capacity
+	for i := range out {
+		out[i] = r.buffer[(tail+i)%r.capacity]
+	}
+	return out
+}
+
+// Latest возвращает самый новый снимок
+func (r *Recorder) Latest() (Snapshot, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size == 0 {
+		return Snapshot{}, false
+	}
+	return r.buffer[(r.head-1+r.capacity)%r.capacity], true
+}
+
+// Range возвращает снимки с отметкой времени в [from, to]
+func (r *Recorder) Range(from, to time.Time) []Snapshot {
+	var out []Snapshot
+	for _, snap := range r.Snapshots() {
+		if !snap.Timestamp.Before(from) && !snap.Timestamp.After(to) {
+			out = append(out, snap)
+		}
+	}
+	return out
+}
+
+// Deltas возвращает изменения между соседними хранимыми снимками
+func (r *Recorder) Deltas() []Delta {
+	snaps := r.Snapshots()
+	if len(snaps) < 2 {
+		return nil
+	}
+
+	deltas := make([]Delta, len(snaps)-1)
+	for i := 1; i < len(snaps); i++ {
+		deltas[i-1] = snaps[i].Sub(snaps[i-1])
+	}
+	return deltas
+}
+
+// DeltaOver возвращает изменение за последние d: от самого старого снимка,
+// попадающего в окно, до самого нового. false, если в окне меньше двух снимков.
+func (r *Recorder) DeltaOver(d time.Duration) (Delta, bool) {
+	snaps := r.Snapshots()
+	if len(snaps) < 2 {
+		return Delta{}, false
+	}
+
+	latest := snaps[len(snaps)-1]
+	cutoff := latest.Timestamp.Add(-d)
+	for _, snap := range snaps[:len(snaps)-1] {
+		if !snap.Timestamp.Before(cutoff) {
+			return latest.Sub(snap), true
+		}
+	}
+	return Delta{}, false
+}
+
+// csvHeader - столбцы WriteCSV
+var csvHeader = []string{
+	"start", "end", "interval_ms",
+	"packets_sent", "packets_received", "packets_lost", "packets_retried",
+	"bytes_sent", "bytes_received", "errors", "timeouts", "resets",
+	"send_bytes_per_sec", "recv_bytes_per_sec", "send_packets_per_sec", "recv_packets_per_sec",
+	"retried_packets_per_sec", "packet_loss_rate",
+	"latency_count", "avg_latency_us", "p50_latency_us", "p99_latency_us", "p999_latency_us",
+}
+
+// WriteCSV пишет изменения между соседними снимками в CSV с заголовком
+func (r *Recorder) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+	for _, d := range r.Deltas() {
+		err := cw.Write([]string{
+			d.Start.Format(time.RFC3339Nano), d.End.Format(time.RFC3339Nano), f(durationMs(d.Interval)),
+			u(d.PacketsSent), u(d.PacketsReceived), u(d.PacketsLost), u(d.PacketsRetried),
+			u(d.BytesSent), u(d.BytesReceived), u(d.Errors), u(d.Timeouts), u(d.Resets),
+			f(d.SendBytesPerSec), f(d.RecvBytesPerSec), f(d.SendPacketsPerSec), f(d.RecvPacketsPerSec),
+			f(d.RetriedPacketsPerSec), f(d.PacketLossRate),
+			u(d.LatencyCount), u(d.AvgLatencyUs), u(d.P50LatencyUs), u(d.P99LatencyUs), u(d.P999LatencyUs),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// deltaJSON - запись WriteJSON, имена полей совпадают со столбцами WriteCSV
+type deltaJSON struct {
+	Start                time.Time `json:"start"`
+	End                  time.Time `json:"end"`
+	IntervalMs           float64   `json:"interval_ms"`
+	PacketsSent          uint64    `json:"packets_sent"`
+	PacketsReceived      uint64    `json:"packets_received"`
+	PacketsLost          uint64    `json:"packets_lost"`
+	PacketsRetried       uint64    `json:"packets_retried"`
+	BytesSent            uint64    `json:"bytes_sent"`
+	BytesReceived        uint64    `json:"bytes_received"`
+	Errors               uint64    `json:"errors"`
+	Timeouts             uint64    `json:"timeouts"`
+	Resets               uint64    `json:"resets"`
+	SendBytesPerSec      float64   `json:"send_bytes_per_sec"`
+	RecvBytesPerSec      float64   `json:"recv_bytes_per_sec"`
+	SendPacketsPerSec    float64   `json:"send_packets_per_sec"`
+	RecvPacketsPerSec    float64   `json:"recv_packets_per_sec"`
+	RetriedPacketsPerSec float64   `json:"retried_packets_per_sec"`
+	PacketLossRate       float64   `json:"packet_loss_rate"`
+	LatencyCount         uint64    `json:"latency_count"`
+	AvgLatencyUs         uint64    `json:"avg_latency_us"`
+	P50LatencyUs         uint64    `json:"p50_latency_us"`
+	P99LatencyUs         uint64    `json:"p99_latency_us"`
+	P999LatencyUs        uint64    `json:"p999_latency_us"`
+}
+
+// WriteJSON пишет изменения между соседними снимками массивом JSON
+func (r *Recorder) WriteJSON(w io.Writer) error {
+	deltas := r.Deltas()
+	out := make([]deltaJSON, len(deltas))
+	for i, d := range deltas {
+		out[i] = deltaJSON{
+			Start:                d.Start,
+			End:                  d.End,
+			IntervalMs:           durationMs(d.Interval),
+			PacketsSent:          d.PacketsSent,
+			PacketsReceived:      d.PacketsReceived,
+			PacketsLost:          d.PacketsLost,
+			PacketsRetried:       d.PacketsRetried,
+			BytesSent:            d.BytesSent,
+			BytesReceived:        d.BytesReceived,
+			Errors:               d.Errors,
+			Timeouts:             d.Timeouts,
+			Resets:               d.Resets,
+			SendBytesPerSec:      d.SendBytesPerSec,
+			RecvBytesPerSec:      d.RecvBytesPerSec,
+			SendPacketsPerSec:    d.SendPacketsPerSec,
+			RecvPacketsPerSec:    d.RecvPacketsPerSec,
+			RetriedPacketsPerSec: d.RetriedPacketsPerSec,
+			PacketLossRate:       d.PacketLossRate,
+			LatencyCount:         d.LatencyCount,
+			AvgLatencyUs:         d.AvgLatencyUs,
+			P50LatencyUs:         d.P50LatencyUs,
+			P99LatencyUs:         d.P99LatencyUs,
+			P999LatencyUs:        d.P999LatencyUs,
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// durationMs переводит длительность в миллисекунды
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
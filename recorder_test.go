@@ -0,0 +1,189 @@
+package tcpconn
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshot_Sub(t *testing.T) {
+	stats := NewStatistics()
+	stats.RecordPacketSent(1000)
+	stats.RecordPacketRetried()
+	stats.RecordLatency(100)
+	prev := stats.GetSnapshot()
+
+	for i := 0; i < 4; i++ {
+		stats.RecordPacketSent(500)
+		stats.RecordLatency(5000)
+	}
+	stats.RecordPacketLost()
+	stats.RecordPacketRetried()
+	stats.RecordPacketRetried()
+	cur := stats.GetSnapshot()
+	cur.Timestamp = prev.Timestamp.Add(2 * time.Second)
+
+	d := cur.Sub(prev)
+	if d.Interval != 2*time.Second {
+		t.Errorf("Interval = %v, want 2s", d.Interval)
+	}
+	if d.PacketsSent != 4 || d.BytesSent != 2000 || d.PacketsRetried != 2 || d.PacketsLost != 1 {
+		t.Errorf("delta counters = %+v", d)
+	}
+	if d.SendBytesPerSec != 1000 || d.SendPacketsPerSec != 2 || d.RetriedPacketsPerSec != 1 {
+		t.Errorf("rates = %.0f B/s, %.0f pkt/s, %.0f retried/s, want 1000, 2, 1",
+			d.SendBytesPerSec, d.SendPacketsPerSec, d.RetriedPacketsPerSec)
+	}
+	if d.PacketLossRate != 25 {
+		t.Errorf("PacketLossRate = %.2f, want 25", d.PacketLossRate)
+	}
+
+	// Задержки только за интервал: ранний замер 100 мкс не учитывается
+	if d.LatencyCount != 4 || d.AvgLatencyUs != 5000 || !withinBucket(d.P50LatencyUs, 5000) {
+		t.Errorf("latency count/avg/p50 = %d/%d/%d, want 4/5000/~5000", d.LatencyCount, d.AvgLatencyUs, d.P50LatencyUs)
+	}
+
+	if !strings.Contains(d.String(), "retried=2") {
+		t.Errorf("String() = %q, want retried=2", d.String())
+	}
+}
+
+func TestSnapshot_SubAfterReset(t *testing.T) {
+	stats := NewStatistics()
+	for i := 0; i < 10; i++ {
+		stats.RecordPacketSent(100)
+	}
+	prev := stats.GetSnapshot()
+
+	stats.Reset()
+	stats.RecordPacketSent(100)
+	stats.RecordPacketSent(100)
+
+	if d := stats.GetSnapshot().Sub(prev); d.PacketsSent != 2 || d.BytesSent != 200 {
+		t.Errorf("after Reset delta sent = %d packets, %d bytes, want 2 and 200", d.PacketsSent, d.BytesSent)
+	}
+}
+
+func TestRecorder_Ring(t *testing.T) {
+	stats := NewStatistics()
+
+	if _, err := stats.StartRecorder(time.Second, 0); err != ErrInvalidCapacity {
+		t.Errorf("StartRecorder(capacity 0) error = %v, want ErrInvalidCapacity", err)
+	}
+	if _, err := stats.StartRecorder(0, 10); err != ErrInvalidInterval {
+		t.Errorf("StartRecorder(interval 0) error = %v, want ErrInvalidInterval", err)
+	}
+
+	r, err := stats.StartRecorder(time.Hour, 3)
+	if err != nil {
+		t.Fatalf("StartRecorder failed: %v", err)
+	}
+	defer r.Stop()
+
+	if r.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1 initial snapshot", r.Len())
+	}
+
+	for i := 0; i < 4; i++ {
+		stats.RecordPacketSent(100)
+		r.record(stats.GetSnapshot())
+	}
+
+	snaps := r.Snapshots()
+	if len(snaps) != 3 {
+		t.Fatalf("len(Snapshots()) = %d, want 3", len(snaps))
+	}
+	for i, want := range []uint64{2, 3, 4} {
+		if snaps[i].PacketsSent != want {
+			t.Errorf("Snapshots()[%d].PacketsSent = %d, want %d", i, snaps[i].PacketsSent, want)
+		}
+	}
+
+	latest, ok := r.Latest()
+	if !ok || latest.PacketsSent != 4 {
+		t.Errorf("Latest() = %d, %v, want 4, true", latest.PacketsSent, ok)
+	}
+
+	deltas := r.Deltas()
+	if len(deltas) != 2 || deltas[0].PacketsSent != 1 || deltas[1].PacketsSent != 1 {
+		t.Errorf("Deltas() = %+v, want two deltas of 1 packet", deltas)
+	}
+
+	if d, ok := r.DeltaOver(time.Hour); !ok || d.PacketsSent != 2 {
+		t.Errorf("DeltaOver(1h) = %d, %v, want 2, true", d.PacketsSent, ok)
+	}
+
+	if got := r.Range(snaps[1].Timestamp, snaps[2].Timestamp); len(got) != 2 {
+		t.Errorf("len(Range()) = %d, want 2", len(got))
+	}
+}
+
+func TestRecorder_Periodic(t *testing.T) {
+	stats := NewStatistics()
+	r, err := stats.StartRecorder(5*time.Millisecond, 100)
+	if err != nil {
+		t.Fatalf("StartRecorder failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for r.Len() < 4 && time.Now().Before(deadline) {
+		stats.RecordPacketSent(10)
+		time.Sleep(time.Millisecond)
+	}
+	r.Stop()
+	r.Stop()
+
+	n := r.Len()
+	if n < 4 {
+		t.Fatalf("Len() = %d, want at least 4", n)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if r.Len() != n {
+		t.Error("snapshots recorded after Stop")
+	}
+}
+
+func TestRecorder_Dump(t *testing.T) {
+	stats := NewStatistics()
+	r, err := stats.StartRecorder(time.Hour, 10)
+	if err != nil {
+		t.Fatalf("StartRecorder failed: %v", err)
+	}
+	defer r.Stop()
+
+	stats.RecordPacketSent(1500)
+	stats.RecordPacketRetried()
+	r.record(stats.GetSnapshot())
+	stats.RecordPacketSent(1500)
+	r.record(stats.GetSnapshot())
+
+	var csvBuf bytes.Buffer
+	if err := r.WriteCSV(&csvBuf); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	rows, err := csv.NewReader(&csvBuf).ReadAll()
+	if err != nil {
+		t.Fatalf("reading CSV failed: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("CSV has %d rows, want header and 2 deltas", len(rows))
+	}
+	if rows[0][6] != "packets_retried" || rows[1][6] != "1" || rows[2][6] != "0" {
+		t.Errorf("packets_retried column = %q, %q, %q", rows[0][6], rows[1][6], rows[2][6])
+	}
+
+	var jsonBuf bytes.Buffer
+	if err := r.WriteJSON(&jsonBuf); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var records []map[string]any
+	if err := json.Unmarshal(jsonBuf.Bytes(), &records); err != nil {
+		t.Fatalf("decoding JSON failed: %v", err)
+	}
+	if len(records) != 2 || records[0]["bytes_sent"] != float64(1500) || records[0]["packets_retried"] != float64(1) {
+		t.Errorf("JSON records = %v", records)
+	}
+}
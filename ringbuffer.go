@@ -2,6 +2,7 @@ package tcpconn
 
 import (
 	"errors"
+	"io"
 	"sync"
 )
 
@@ -16,7 +17,16 @@ var (
 	ErrInvalidSize = errors.New("invalid size")
 )
 
-// RingBuffer представляет потокобезопасный кольцевой буфер
+// RingBuffer представляет потокобезопасный кольцевой буфер.
+//
+// Write, Read, Peek и Skip атомарны и безопасны из любых горутин.
+// Методы без копирования (PeekSlices/Consume, Reserve/Commit) и построенные
+// на них WriteTo/ReadFrom снимают блокировку между шагами, поэтому требуют
+// одного читателя и одного писателя: PeekSlices, Consume и WriteTo нельзя
+// вызывать одновременно с другим чтением, Reserve, Commit и ReadFrom -
+// одновременно с другой записью. Reset нельзя вызывать между шагами.
+// Нарушение этих требований - неопределенное поведение: данные могут
+// потеряться или перезаписаться без ошибки.
 type RingBuffer struct {
 	buffer   []byte
 	capacity int
@@ -226,3 +236,135 @@ func (rb *RingBuffer) Reset() {
 	rb.head = 0
 	rb.tail = 0
 }
+
+// regions возвращает до двух непрерывных участков буфера длиной n от позиции start
+func (rb *RingBuffer) regions(start, n int) (a, b []byte) {
+	if n == 0 {
+		return nil, nil
+	}
+	end := start + n
+	if end <= rb.capacity {
+		return rb.buffer[start:end:end], nil
+	}
+	end -= rb.capacity
+	return rb.buffer[start:rb.capacity:rb.capacity], rb.buffer[:end:end]
+}
+
+// PeekSlices возвращает до n байт для чтения без копирования: один или два
+// непрерывных участка буфера (b пуст, если данные не переходят границу).
+// Участки действительны до Consume; изменять их нельзя.
+// Между PeekSlices и Consume читать из буфера может только вызывающий.
+func (rb *RingBuffer) PeekSlices(n int) (a, b []byte) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if n > rb.size {
+		n = rb.size
+	}
+	if n < 0 {
+		n = 0
+	}
+	return rb.regions(rb.tail, n)
+}
+
+// Consume удаляет n прочитанных через PeekSlices байт.
+// Возвращает ErrBufferEmpty, если данных меньше n.
+func (rb *RingBuffer) Consume(n int) error {
+	return rb.Skip(n)
+}
+
+// Reserve возвращает до n байт свободного места для записи без копирования:
+// один или два непрерывных участка. Данные становятся доступны читателю
+// после Commit. Между Reserve и Commit писать в буфер может только
+// вызывающий: Write, WriteAll или другой Reserve перезапишут участки.
+func (rb *RingBuffer) Reserve(n int) (a, b []byte) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if free := rb.capacity - rb.size; n > free {
+		n = free
+	}
+	if n < 0 {
+		n = 0
+	}
+	return rb.regions(rb.head, n)
+}
+
+// Commit делает доступными читателю n байт, записанных в участки Reserve.
+// Возвращает ErrInvalidSize, если свободного места меньше n.
+func (rb *RingBuffer) Commit(n int) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if n < 0 || n > rb.capacity-rb.size {
+		return ErrInvalidSize
+	}
+
+	rb.head = (rb.head + n) % rb.capacity
+	rb.size += n
+	return nil
+}
+
+// WriteTo записывает все доступные данные в w напрямую из буфера (io.WriterTo),
+// удаляя записанное. Блокировка буфера во время w.Write не удерживается,
+// поэтому одновременно с WriteTo читать из буфера нельзя: результат не определен.
+func (rb *RingBuffer) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for {
+		a, b := rb.PeekSlices(rb.capacity)
+		if len(a) == 0 {
+			return total, nil
+		}
+
+		for _, region := range [][]byte{a, b} {
+			if len(region) == 0 {
+				continue
+			}
+			n, err := w.Write(region)
+			total += int64(n)
+			if cerr := rb.Consume(n); cerr != nil {
+				return total, cerr
+			}
+			if err != nil {
+				return total, err
+			}
+			if n < len(region) {
+				return total, io.ErrShortWrite
+			}
+		}
+	}
+}
+
+// ReadFrom читает из r напрямую в буфер до io.EOF (io.ReaderFrom).
+// Если буфер заполнится раньше, возвращает прочитанное и ErrBufferFull.
+// Заполненный буфер проверяет r пустым чтением: источник, который сообщает
+// io.EOF и на нем (strings.Reader, bytes.Reader), считается дочитанным.
+// Блокировка во время r.Read не удерживается, поэтому одновременно с
+// ReadFrom писать в буфер нельзя: результат не определен.
+func (rb *RingBuffer) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	for {
+		a, _ := rb.Reserve(rb.capacity)
+		if len(a) == 0 {
+			// Буфер заполнился ровно к концу источника - это не ошибка
+			if _, err := r.Read(nil); err == io.EOF {
+				return total, nil
+			}
+			return total, ErrBufferFull
+		}
+
+		n, err := r.Read(a)
+		if n > 0 {
+			if cerr := rb.Commit(n); cerr != nil {
+				return total, cerr
+			}
+			total += int64(n)
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
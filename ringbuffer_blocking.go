@@ -0,0 +1,232 @@
+package tcpconn
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// BlockingRingBuffer - ограниченный канал байтов поверх RingBuffer с
+// семантикой io.Pipe: Read ждет данных, Write ждет свободного места.
+// Close и CloseWithError будят ожидающих: читатели дочитывают оставшиеся
+// данные и получают io.EOF (или ошибку CloseWithError), писатели получают
+// io.ErrClosedPipe.
+type BlockingRingBuffer struct {
+	rb *RingBuffer
+
+	mu            sync.Mutex
+	changed       chan struct{} // закрывается при каждом изменении буфера
+	closed        bool
+	err           error // ошибка читателей после закрытия
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// NewBlockingRingBuffer создает блокирующий буфер с заданной емкостью
+func NewBlockingRingBuffer(capacity int) (*BlockingRingBuffer, error) {
+	rb, err := NewRingBuffer(capacity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockingRingBuffer{
+		rb:      rb,
+		changed: make(chan struct{}),
+	}, nil
+}
+
+// broadcast будит всех ожидающих. Вызывается под b.mu.
+func (b *BlockingRingBuffer) broadcast() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// wait ждет изменения буфера, отмены ctx или deadline.
+// Вызывается под b.mu и возвращается под b.mu.
+func (b *BlockingRingBuffer) wait(ctx context.Context, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	changed := b.changed
+	b.mu.Unlock()
+	defer b.mu.Lock()
+
+	select {
+	case <-changed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// Read читает доступные данные, ожидая появления хотя бы одного байта
+func (b *BlockingRingBuffer) Read(data []byte) (int, error) {
+	return b.ReadContext(context.Background(), data)
+}
+
+// ReadContext - Read с отменой через ctx; при отмене возвращает ctx.Err()
+func (b *BlockingRingBuffer) ReadContext(ctx context.Context, data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for {
+		if n, _ := b.rb.Read(data); n > 0 {
+			b.broadcast()
+			return n, nil
+		}
+		if b.closed {
+			return 0, b.err
+		}
+		if err := b.wait(ctx, b.readDeadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write записывает все данные, ожидая свободного места.
+// Если буфер закрыт во время ожидания, возвращает записанную часть и io.ErrClosedPipe.
+func (b *BlockingRingBuffer) Write(data []byte) (int, error) {
+	return b.WriteContext(context.Background(), data)
+}
+
+// WriteContext - Write с отменой через ctx; при отмене возвращает
+// записанную часть и ctx.Err()
+func (b *BlockingRingBuffer) WriteContext(ctx context.Context, data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	written := 0
+	for {
+		if b.closed {
+			return written, io.ErrClosedPipe
+		}
+		if written == len(data) {
+			return written, nil
+		}
+		if n, _ := b.rb.Write(data[written:]); n > 0 {
+			written += n
+			b.broadcast()
+			continue
+		}
+		if err := b.wait(ctx, b.writeDeadline); err != nil {
+			return written, err
+		}
+	}
+}
+
+// TryRead читает без ожидания; ErrBufferEmpty, если данных нет,
+// или ошибку закрытия, если буфер закрыт и пуст
+func (b *BlockingRingBuffer) TryRead(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, err := b.rb.Read(data)
+	if n > 0 {
+		b.broadcast()
+	}
+	if err == ErrBufferEmpty && b.closed {
+		return 0, b.err
+	}
+	return n, err
+}
+
+// TryWrite записывает без ожидания столько, сколько помещается;
+// ErrBufferFull, если места нет
+func (b *BlockingRingBuffer) TryWrite(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+	n, err := b.rb.Write(data)
+	if n > 0 {
+		b.broadcast()
+	}
+	return n, err
+}
+
+// SetReadDeadline задает срок ожидания Read; нулевое время снимает ограничение.
+// Ожидающий Read по истечении срока возвращает os.ErrDeadlineExceeded.
+func (b *BlockingRingBuffer) SetReadDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.readDeadline = t
+	b.broadcast()
+}
+
+// SetWriteDeadline задает срок ожидания Write; нулевое время снимает ограничение
+func (b *BlockingRingBuffer) SetWriteDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writeDeadline = t
+	b.broadcast()
+}
+
+// SetDeadline задает срок ожидания Read и Write
+func (b *BlockingRingBuffer) SetDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.readDeadline = t
+	b.writeDeadline = t
+	b.broadcast()
+}
+
+// Close закрывает буфер: читатели получат io.EOF после оставшихся данных
+func (b *BlockingRingBuffer) Close() error {
+	return b.CloseWithError(nil)
+}
+
+// CloseWithError закрывает буфер: читатели получат err (io.EOF, если nil)
+// после оставшихся данных. Повторное закрытие не меняет ошибку.
+func (b *BlockingRingBuffer) CloseWithError(err error) error {
+	if err == nil {
+		err = io.EOF
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	b.err = err
+	b.broadcast()
+	return nil
+}
+
+// Available возвращает количество байт доступных для чтения
+func (b *BlockingRingBuffer) Available() int {
+	return b.rb.Available()
+}
+
+// FreeSpace возвращает количество свободного места в буфере
+func (b *BlockingRingBuffer) FreeSpace() int {
+	return b.rb.FreeSpace()
+}
+
+// Capacity возвращает емкость буфера
+func (b *BlockingRingBuffer) Capacity() int {
+	return b.rb.Capacity()
+}
+
+// IsEmpty проверяет, пуст ли буфер
+func (b *BlockingRingBuffer) IsEmpty() bool {
+	return b.rb.IsEmpty()
+}
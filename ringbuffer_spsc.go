@@ -0,0 +1,206 @@
+package tcpconn
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// cacheLineSize - размер строки кэша, по которому разнесены head и tail
+const cacheLineSize = 64
+
+// SPSCRingBuffer - кольцевой буфер без блокировок для одного писателя и
+// одного читателя (например, сборка сегментов -> Read соединения).
+//
+// Write, WriteAll вызываются только из горутины писателя, Read, ReadAll,
+// Peek и Skip - только из горутины читателя; Available, FreeSpace, IsEmpty
+// и IsFull безопасны из любой горутины. Емкость округляется вверх до
+// степени двойки, данные копируются не более чем двумя вызовами copy.
+type SPSCRingBuffer struct {
+	buffer []byte
+	mask   uint64
+	_      [cacheLineSize - 32]byte
+
+	// Счетчики записанных и прочитанных байт только растут;
+	// позиция в буфере - счетчик & mask, размер - head - tail
+	head      atomic.Uint64 // изменяет только писатель
+	tailCache uint64        // последний увиденный писателем tail
+	_         [cacheLineSize - 16]byte
+
+	tail      atomic.Uint64 // изменяет только читатель
+	headCache uint64        // последний увиденный читателем head
+	_         [cacheLineSize - 16]byte
+}
+
+// NewSPSCRingBuffer создает буфер емкостью не меньше capacity
+// (ближайшая степень двойки)
+func NewSPSCRingBuffer(capacity int) (*SPSCRingBuffer, error) {
+	if capacity <= 0 {
+		return nil, ErrInvalidCapacity
+	}
+	size := uint64(1) << bits.Len64(uint64(capacity-1))
+
+	return &SPSCRingBuffer{
+		buffer: make([]byte, size),
+		mask:   size - 1,
+	}, nil
+}
+
+// free возвращает свободное место для писателя, обновляя tailCache
+// только если закэшированного значения не хватает для n байт
+func (rb *SPSCRingBuffer) free(head uint64, n int) int {
+	capacity := uint64(len(rb.buffer))
+	free := capacity - (head - rb.tailCache)
+	if free < uint64(n) {
+		rb.tailCache = rb.tail.Load()
+		free = capacity - (head - rb.tailCache)
+	}
+	return int(free)
+}
+
+// used возвращает число байт для читателя, обновляя headCache
+// только если закэшированного значения не хватает для n байт
+func (rb *SPSCRingBuffer) used(tail uint64, n int) int {
+	used := rb.headCache - tail
+	if used < uint64(n) {
+		rb.headCache = rb.head.Load()
+		used = rb.headCache - tail
+	}
+	return int(used)
+}
+
+// copyIn копирует data в буфер с позиции pos
+func (rb *SPSCRingBuffer) copyIn(pos uint64, data []byte) {
+	n := copy(rb.buffer[pos&rb.mask:], data)
+	copy(rb.buffer, data[n:])
+}
+
+// copyOut копирует данные буфера с позиции pos в data
+func (rb *SPSCRingBuffer) copyOut(pos uint64, data []byte) {
+	n := copy(data, rb.buffer[pos&rb.mask:])
+	copy(data[n:], rb.buffer)
+}
+
+// Write записывает данные в буфер
+// Возвращает количество записанных байт
+func (rb *SPSCRingBuffer) Write(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	head := rb.head.Load()
+	toWrite := min(len(data), rb.free(head, len(data)))
+	if toWrite == 0 {
+		return 0, ErrBufferFull
+	}
+
+	rb.copyIn(head, data[:toWrite])
+	rb.head.Store(head + uint64(toWrite))
+	return toWrite, nil
+}
+
+// WriteAll записывает все данные в буфер или возвращает ошибку
+func (rb *SPSCRingBuffer) WriteAll(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	head := rb.head.Load()
+	if rb.free(head, len(data)) < len(data) {
+		return ErrBufferFull
+	}
+
+	rb.copyIn(head, data)
+	rb.head.Store(head + uint64(len(data)))
+	return nil
+}
+
+// Read читает данные из буфера
+// Возвращает количество прочитанных байт
+func (rb *SPSCRingBuffer) Read(data []byte) (int, error) {
+	n, err := rb.Peek(data)
+	if n > 0 {
+		rb.tail.Add(uint64(n))
+	}
+	return n, err
+}
+
+// ReadAll читает все доступные данные из буфера
+func (rb *SPSCRingBuffer) ReadAll() []byte {
+	tail := rb.tail.Load()
+	size := rb.used(tail, len(rb.buffer))
+	if size == 0 {
+		return nil
+	}
+
+	data := make([]byte, size)
+	rb.copyOut(tail, data)
+	rb.tail.Store(tail + uint64(size))
+	return data
+}
+
+// Peek читает данные без удаления их из буфера
+func (rb *SPSCRingBuffer) Peek(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	tail := rb.tail.Load()
+	toRead := min(len(data), rb.used(tail, len(data)))
+	if toRead == 0 {
+		return 0, ErrBufferEmpty
+	}
+
+	rb.copyOut(tail, data[:toRead])
+	return toRead, nil
+}
+
+// Skip пропускает n байт в буфере
+func (rb *SPSCRingBuffer) Skip(n int) error {
+	if n < 0 {
+		return ErrInvalidSize
+	}
+
+	tail := rb.tail.Load()
+	if rb.used(tail, n) < n {
+		return ErrBufferEmpty
+	}
+
+	rb.tail.Store(tail + uint64(n))
+	return nil
+}
+
+// Available возвращает количество байт доступных для чтения
+func (rb *SPSCRingBuffer) Available() int {
+	// tail читается первым: он не может обогнать head, прочитанный позже
+	tail := rb.tail.Load()
+	head := rb.head.Load()
+	return int(min(head-tail, uint64(len(rb.buffer))))
+}
+
+// FreeSpace возвращает количество свободного места в буфере
+func (rb *SPSCRingBuffer) FreeSpace() int {
+	return len(rb.buffer) - rb.Available()
+}
+
+// Capacity возвращает емкость буфера
+func (rb *SPSCRingBuffer) Capacity() int {
+	return len(rb.buffer)
+}
+
+// IsEmpty проверяет, пуст ли буфер
+func (rb *SPSCRingBuffer) IsEmpty() bool {
+	return rb.Available() == 0
+}
+
+// IsFull проверяет, заполнен ли буфер
+func (rb *SPSCRingBuffer) IsFull() bool {
+	return rb.Available() == len(rb.buffer)
+}
+
+// Reset очищает буфер. Нельзя вызывать одновременно с записью или чтением.
+func (rb *SPSCRingBuffer) Reset() {
+	rb.head.Store(0)
+	rb.tail.Store(0)
+	rb.tailCache = 0
+	rb.headCache = 0
+}
@@ -2,8 +2,16 @@ package tcpconn
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewRingBuffer(t *testing.T) {
@@ -413,3 +421,483 @@ func BenchmarkRingBuffer_Read(b *testing.B) {
 		}
 	}
 }
+
+func TestNewSPSCRingBuffer(t *testing.T) {
+	tests := []struct {
+		capacity int
+		want     int
+	}{
+		{1, 1},
+		{5, 8},
+		{8, 8},
+		{0xFFFF, 0x10000},
+	}
+	for _, tt := range tests {
+		rb, err := NewSPSCRingBuffer(tt.capacity)
+		if err != nil {
+			t.Fatalf("NewSPSCRingBuffer(%d) error = %v", tt.capacity, err)
+		}
+		if rb.Capacity() != tt.want || rb.FreeSpace() != tt.want {
+			t.Errorf("NewSPSCRingBuffer(%d): Capacity() = %d, FreeSpace() = %d, want %d",
+				tt.capacity, rb.Capacity(), rb.FreeSpace(), tt.want)
+		}
+	}
+	if _, err := NewSPSCRingBuffer(0); err != ErrInvalidCapacity {
+		t.Errorf("NewSPSCRingBuffer(0) error = %v, want ErrInvalidCapacity", err)
+	}
+}
+
+func TestSPSCRingBuffer_Operations(t *testing.T) {
+	rb, _ := NewSPSCRingBuffer(8)
+
+	if _, err := rb.Read(make([]byte, 1)); err != ErrBufferEmpty {
+		t.Errorf("Read() on empty error = %v, want ErrBufferEmpty", err)
+	}
+	if n, err := rb.Write([]byte("abcdef")); n != 6 || err != nil {
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+
+	buf := make([]byte, 4)
+	if n, _ := rb.Peek(buf); n != 4 || string(buf) != "abcd" {
+		t.Errorf("Peek() = %d %q, want 4 \"abcd\"", n, buf)
+	}
+	if err := rb.Skip(2); err != nil {
+		t.Fatalf("Skip() error = %v", err)
+	}
+	if err := rb.Skip(5); err != ErrBufferEmpty {
+		t.Errorf("Skip(5) error = %v, want ErrBufferEmpty", err)
+	}
+	if err := rb.Skip(-1); err != ErrInvalidSize {
+		t.Errorf("Skip(-1) error = %v, want ErrInvalidSize", err)
+	}
+
+	// Запись через границу буфера: частичная, затем полная
+	if n, err := rb.Write([]byte("ghijkl")); n != 4 || err != nil {
+		t.Errorf("Write() = %d, %v, want 4", n, err)
+	}
+	if !rb.IsFull() {
+		t.Error("IsFull() = false, want true")
+	}
+	if _, err := rb.Write([]byte("x")); err != ErrBufferFull {
+		t.Errorf("Write() on full error = %v, want ErrBufferFull", err)
+	}
+	if err := rb.WriteAll([]byte("x")); err != ErrBufferFull {
+		t.Errorf("WriteAll() on full error = %v, want ErrBufferFull", err)
+	}
+
+	if n, _ := rb.Read(buf); n != 4 || string(buf) != "cdef" {
+		t.Errorf("Read() = %d %q, want 4 \"cdef\"", n, buf)
+	}
+	if err := rb.WriteAll([]byte("mn")); err != nil {
+		t.Fatalf("WriteAll() error = %v", err)
+	}
+	if got := rb.ReadAll(); string(got) != "ghijmn" {
+		t.Errorf("ReadAll() = %q, want \"ghijmn\"", got)
+	}
+	if !rb.IsEmpty() || rb.ReadAll() != nil {
+		t.Error("buffer not empty after ReadAll()")
+	}
+
+	rb.WriteAll([]byte("abc"))
+	rb.Reset()
+	if rb.Available() != 0 || rb.FreeSpace() != 8 {
+		t.Errorf("after Reset: Available() = %d, FreeSpace() = %d", rb.Available(), rb.FreeSpace())
+	}
+}
+
+func TestSPSCRingBuffer_Concurrent(t *testing.T) {
+	rb, _ := NewSPSCRingBuffer(64)
+	const total = 1 << 20
+
+	go func() {
+		chunk := make([]byte, 37)
+		for written := 0; written < total; {
+			n := min(len(chunk), total-written)
+			for i := range chunk[:n] {
+				chunk[i] = byte(written + i)
+			}
+			for off := 0; off < n; {
+				w, err := rb.Write(chunk[off:n])
+				if errors.Is(err, ErrBufferFull) {
+					runtime.Gosched()
+					continue
+				}
+				off += w
+			}
+			written += n
+		}
+	}()
+
+	buf := make([]byte, 29)
+	for read := 0; read < total; {
+		n, err := rb.Read(buf)
+		if errors.Is(err, ErrBufferEmpty) {
+			runtime.Gosched()
+			continue
+		}
+		for i, b := range buf[:n] {
+			if b != byte(read+i) {
+				t.Fatalf("byte %d = %d, want %d", read+i, b, byte(read+i))
+			}
+		}
+		read += n
+	}
+}
+
+func BenchmarkSPSCRingBuffer_Write(b *testing.B) {
+	rb, _ := NewSPSCRingBuffer(1024)
+	data := []byte("hello world")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rb.Write(data)
+		if rb.IsFull() {
+			rb.Reset()
+		}
+	}
+}
+
+func BenchmarkSPSCRingBuffer_Read(b *testing.B) {
+	rb, _ := NewSPSCRingBuffer(1024)
+	data := []byte("hello world")
+	buf := make([]byte, 11)
+
+	// Заполняем буфер
+	for i := 0; i < 90; i++ {
+		rb.Write(data)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rb.Read(buf)
+		if rb.IsEmpty() {
+			for j := 0; j < 90; j++ {
+				rb.Write(data)
+			}
+		}
+	}
+}
+
+// byteRing - общие методы RingBuffer и SPSCRingBuffer для сравнения
+type byteRing interface {
+	Write(data []byte) (int, error)
+	Read(data []byte) (int, error)
+}
+
+// benchmarkPipe передает b.N блоков размера chunk от писателя к читателю
+func benchmarkPipe(b *testing.B, rb byteRing, chunk int) {
+	total := b.N * chunk
+	b.SetBytes(int64(chunk))
+	b.ResetTimer()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		data := make([]byte, chunk)
+		for written := 0; written < total; {
+			n, err := rb.Write(data[:min(chunk, total-written)])
+			if err != nil {
+				runtime.Gosched()
+			}
+			written += n
+		}
+	}()
+
+	buf := make([]byte, chunk)
+	for read := 0; read < total; {
+		n, err := rb.Read(buf)
+		if err != nil {
+			runtime.Gosched()
+		}
+		read += n
+	}
+	<-done
+}
+
+// BenchmarkRingBuffer_Pipe сравнивает RingBuffer и SPSCRingBuffer
+// на пути один писатель -> один читатель
+func BenchmarkRingBuffer_Pipe(b *testing.B) {
+	for _, chunk := range []int{64, 1460, 16384} {
+		b.Run(fmt.Sprintf("mutex/%d", chunk), func(b *testing.B) {
+			rb, _ := NewRingBuffer(65536)
+			benchmarkPipe(b, rb, chunk)
+		})
+		b.Run(fmt.Sprintf("spsc/%d", chunk), func(b *testing.B) {
+			rb, _ := NewSPSCRingBuffer(65536)
+			benchmarkPipe(b, rb, chunk)
+		})
+	}
+}
+
+func TestBlockingRingBuffer_Pipe(t *testing.T) {
+	b, err := NewBlockingRingBuffer(7)
+	if err != nil {
+		t.Fatalf("NewBlockingRingBuffer() error = %v", err)
+	}
+
+	// Данные больше емкости проходят через буфер частями
+	want := bytes.Repeat([]byte("0123456789"), 100)
+	go func() {
+		b.Write(want)
+		b.Close()
+	}()
+
+	got, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatalf("io.ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("io.ReadAll() = %d bytes, want %d", len(got), len(want))
+	}
+	if _, err := b.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("Write() after Close error = %v, want io.ErrClosedPipe", err)
+	}
+}
+
+func TestBlockingRingBuffer_CloseWakesWaiters(t *testing.T) {
+	b, _ := NewBlockingRingBuffer(4)
+	b.Write([]byte("ab"))
+
+	errClosed := errors.New("conn reset")
+	readErr := make(chan error)
+	go func() {
+		buf := make([]byte, 4)
+		n, err := b.Read(buf)
+		if n != 2 || err != nil {
+			readErr <- fmt.Errorf("first Read() = %d, %v", n, err)
+			return
+		}
+		_, err = b.Read(buf) // ждет до CloseWithError
+		readErr <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	b.CloseWithError(errClosed)
+	if err := <-readErr; err != errClosed {
+		t.Errorf("Read() after CloseWithError = %v, want %v", err, errClosed)
+	}
+
+	// Писатель, ждущий места, получает записанную часть и io.ErrClosedPipe
+	w, _ := NewBlockingRingBuffer(4)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		w.Close()
+	}()
+	if n, err := w.Write([]byte("abcdef")); n != 4 || err != io.ErrClosedPipe {
+		t.Errorf("Write() = %d, %v, want 4, io.ErrClosedPipe", n, err)
+	}
+}
+
+func TestBlockingRingBuffer_ContextAndDeadline(t *testing.T) {
+	b, _ := NewBlockingRingBuffer(4)
+	buf := make([]byte, 4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.ReadContext(ctx, buf); err != context.DeadlineExceeded {
+		t.Errorf("ReadContext() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	b.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := b.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read() error = %v, want os.ErrDeadlineExceeded", err)
+	}
+	b.SetReadDeadline(time.Time{})
+
+	b.Write([]byte("abcd"))
+	b.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+	if n, err := b.Write([]byte("e")); n != 0 || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write() = %d, %v, want os.ErrDeadlineExceeded", n, err)
+	}
+
+	// Без ожидания
+	if _, err := b.TryWrite([]byte("e")); err != ErrBufferFull {
+		t.Errorf("TryWrite() error = %v, want ErrBufferFull", err)
+	}
+	if n, err := b.TryRead(buf); n != 4 || err != nil {
+		t.Errorf("TryRead() = %d, %v", n, err)
+	}
+	if _, err := b.TryRead(buf); err != ErrBufferEmpty {
+		t.Errorf("TryRead() error = %v, want ErrBufferEmpty", err)
+	}
+	b.Close()
+	if _, err := b.TryRead(buf); err != io.EOF {
+		t.Errorf("TryRead() after Close error = %v, want io.EOF", err)
+	}
+}
+
+func TestRingBuffer_PeekSlicesConsume(t *testing.T) {
+	rb, _ := NewRingBuffer(8)
+	rb.Write([]byte("abcdef"))
+	rb.Skip(4)
+	rb.Write([]byte("ghijk")) // данные "efghijk" переходят границу
+
+	a, b := rb.PeekSlices(100)
+	if string(a) != "efgh" || string(b) != "ijk" {
+		t.Errorf("PeekSlices() = %q, %q, want \"efgh\", \"ijk\"", a, b)
+	}
+	if a, b := rb.PeekSlices(3); string(a) != "efg" || b != nil {
+		t.Errorf("PeekSlices(3) = %q, %q, want \"efg\", nil", a, b)
+	}
+	if rb.Available() != 7 {
+		t.Errorf("Available() after PeekSlices = %d, want 7", rb.Available())
+	}
+
+	if err := rb.Consume(5); err != nil {
+		t.Fatalf("Consume() error = %v", err)
+	}
+	if a, b := rb.PeekSlices(100); string(a) != "jk" || b != nil {
+		t.Errorf("PeekSlices() after Consume = %q, %q", a, b)
+	}
+	if err := rb.Consume(3); err != ErrBufferEmpty {
+		t.Errorf("Consume(3) error = %v, want ErrBufferEmpty", err)
+	}
+
+	// Участки не позволяют дописать в чужую часть буфера
+	if a, _ := rb.PeekSlices(2); cap(a) != 2 {
+		t.Errorf("cap(PeekSlices(2)) = %d, want 2", cap(a))
+	}
+}
+
+func TestRingBuffer_ReserveCommit(t *testing.T) {
+	rb, _ := NewRingBuffer(8)
+	rb.Write([]byte("abcde"))
+	rb.Skip(5) // запись начнется с позиции 5
+
+	a, b := rb.Reserve(6)
+	if len(a) != 3 || len(b) != 3 {
+		t.Fatalf("Reserve(6) = %d+%d bytes, want 3+3", len(a), len(b))
+	}
+	copy(a, "123")
+	copy(b, "456")
+	if rb.Available() != 0 {
+		t.Errorf("Available() before Commit = %d, want 0", rb.Available())
+	}
+	if err := rb.Commit(6); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if got := rb.ReadAll(); string(got) != "123456" {
+		t.Errorf("ReadAll() = %q, want \"123456\"", got)
+	}
+
+	rb.Write([]byte("1234567"))
+	if a, b := rb.Reserve(5); len(a)+len(b) != 1 {
+		t.Errorf("Reserve(5) with 1 free byte = %d+%d bytes", len(a), len(b))
+	}
+	if err := rb.Commit(2); err != ErrInvalidSize {
+		t.Errorf("Commit(2) error = %v, want ErrInvalidSize", err)
+	}
+	if err := rb.Commit(-1); err != ErrInvalidSize {
+		t.Errorf("Commit(-1) error = %v, want ErrInvalidSize", err)
+	}
+}
+
+// shortWriter принимает не больше limit байт за вызов
+type shortWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p[:min(len(p), w.limit)])
+}
+
+func TestRingBuffer_WriteToReadFrom(t *testing.T) {
+	rb, _ := NewRingBuffer(16)
+	rb.Write([]byte("0123456789"))
+	rb.Skip(10)
+
+	// ReadFrom пишет через границу буфера
+	n, err := rb.ReadFrom(strings.NewReader("hello, world"))
+	if n != 12 || err != nil {
+		t.Fatalf("ReadFrom() = %d, %v", n, err)
+	}
+
+	var out bytes.Buffer
+	if n, err := io.Copy(&out, rb); n != 12 || err != nil || out.String() != "hello, world" {
+		t.Errorf("io.Copy() = %d, %v, %q", n, err, out.String())
+	}
+	if !rb.IsEmpty() {
+		t.Errorf("Available() after WriteTo = %d, want 0", rb.Available())
+	}
+
+	// Буфер заполняется раньше конца источника; io.LimitReader скрывает
+	// WriteTo источника, поэтому io.Copy использует ReadFrom буфера
+	src := io.LimitReader(strings.NewReader(strings.Repeat("x", 20)), 20)
+	n, err = io.Copy(rb, src)
+	if n != 16 || err != ErrBufferFull {
+		t.Errorf("io.Copy() into buffer = %d, %v, want 16, ErrBufferFull", n, err)
+	}
+
+	// Буфер, заполненный ровно к концу источника, - не ошибка
+	exact, _ := NewRingBuffer(16)
+	if n, err := exact.ReadFrom(strings.NewReader(strings.Repeat("y", 16))); n != 16 || err != nil {
+		t.Errorf("ReadFrom(exact fit) = %d, %v, want 16, nil", n, err)
+	}
+
+	// Недописанное остается в буфере
+	sw := &shortWriter{limit: 5}
+	if n, err := rb.WriteTo(sw); n != 5 || err != io.ErrShortWrite {
+		t.Errorf("WriteTo(short) = %d, %v, want 5, io.ErrShortWrite", n, err)
+	}
+	if rb.Available() != 11 {
+		t.Errorf("Available() after short write = %d, want 11", rb.Available())
+	}
+
+	// Чтение во время WriteTo нарушает требование одного читателя
+	rb.Reset()
+	rb.Write([]byte("abcdef"))
+	steal := writerFunc(func(p []byte) (int, error) {
+		rb.Skip(1)
+		return len(p), nil
+	})
+	if _, err := rb.WriteTo(steal); err != ErrBufferEmpty {
+		t.Errorf("WriteTo(concurrent read) error = %v, want ErrBufferEmpty", err)
+	}
+
+	// Запись во время ReadFrom нарушает требование одного писателя
+	rb.Reset()
+	fill := readerFunc(func(p []byte) (int, error) {
+		rb.Write([]byte("z"))
+		return copy(p, "data"), nil
+	})
+	rb.Write(make([]byte, 13))
+	if n, err := rb.ReadFrom(fill); n != 0 || err != ErrInvalidSize {
+		t.Errorf("ReadFrom(concurrent write) = %d, %v, want 0, ErrInvalidSize", n, err)
+	}
+}
+
+// writerFunc и readerFunc превращают функцию в io.Writer и io.Reader
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+// BenchmarkRingBuffer_Copy сравнивает io.Copy через WriteTo/ReadFrom
+// с копированием через промежуточный буфер
+func BenchmarkRingBuffer_Copy(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 16384)
+	b.Run("zero-copy", func(b *testing.B) {
+		rb, _ := NewRingBuffer(len(data))
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			rb.ReadFrom(bytes.NewReader(data))
+			rb.WriteTo(io.Discard)
+		}
+	})
+	b.Run("read-write", func(b *testing.B) {
+		rb, _ := NewRingBuffer(len(data))
+		buf := make([]byte, 4096)
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			rb.Write(data)
+			for !rb.IsEmpty() {
+				n, _ := rb.Read(buf)
+				io.Discard.Write(buf[:n])
+			}
+		}
+	})
+}
@@ -23,17 +23,12 @@ type Statistics struct {
 	startTime     time.Time
 	lastResetTime time.Time
 
-	// Скорость передачи
-	mu                    sync.RWMutex
-	sendRateBytesPerSec   float64
-	recvRateBytesPerSec   float64
-	sendRatePacketsPerSec float64
-	recvRatePacketsPerSec float64
-
-	// История для расчёта скорости
-	sendHistory []dataPoint
-	recvHistory []dataPoint
-	historySize int
+	mu sync.RWMutex
+
+	// Скорость передачи: посекундные интервалы и окна усреднения
+	sendRate    *rateCounter
+	recvRate    *rateCounter
+	rateWindows []time.Duration
 
 	// Ошибки
 	errors   uint64
@@ -41,191 +36,116 @@ type Statistics struct {
 	resets   uint64
 
 	// Задержки (в микросекундах)
-	minLatency   uint64
-	maxLatency   uint64
-	avgLatency   uint64
-	totalLatency uint64
-	latencyCount uint64
-}
+	latency *LatencyHistogram
 
-type dataPoint struct {
-	timestamp time.Time
-	bytes     uint64
-	packets   uint64
+	// Родитель, в который дублируются все записи (nil для корня)
+	parent *Statistics
 }
 
-// NewStatistics создаёт новый экземпляр статистики
+// NewStatistics создаёт новый экземпляр статистики с окнами DefaultRateWindows
 func NewStatistics() *Statistics {
+	return NewStatisticsWithWindows(DefaultRateWindows...)
+}
+
+// NewStatisticsWithWindows создаёт статистику с заданными окнами расчёта
+// скорости (округляются вверх до секунды). Первое окно основное; без окон
+// используются DefaultRateWindows.
+func NewStatisticsWithWindows(windows ...time.Duration) *Statistics {
+	if len(windows) == 0 {
+		windows = DefaultRateWindows
+	}
+
+	var maxWindow time.Duration
+	for _, w := range windows {
+		maxWindow = max(maxWindow, w)
+	}
+
 	now := time.Now()
 	return &Statistics{
 		startTime:     now,
 		lastResetTime: now,
-		historySize:   60, // храним последние 60 секунд
-		sendHistory:   make([]dataPoint, 0, 60),
-		recvHistory:   make([]dataPoint, 0, 60),
-		minLatency:    ^uint64(0), // максимальное значение uint64
+		sendRate:      newRateCounter(maxWindow, now),
+		recvRate:      newRateCounter(maxWindow, now),
+		rateWindows:   append([]time.Duration(nil), windows...),
+		latency:       NewLatencyHistogram(),
 	}
 }
 
 // RecordPacketSent записывает отправленный пакет
 func (s *Statistics) RecordPacketSent(bytes uint64) {
-	atomic.AddUint64(&s.packetsSent, 1)
-	atomic.AddUint64(&s.bytesSent, bytes)
-
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.sendHistory = append(s.sendHistory, dataPoint{
-		timestamp: time.Now(),
-		bytes:     bytes,
-		packets:   1,
-	})
-
-	// Ограничиваем размер истории
-	if len(s.sendHistory) > s.historySize {
-		s.sendHistory = s.sendHistory[1:]
+	now := time.Now()
+	for st := s; st != nil; st = st.parent {
+		atomic.AddUint64(&st.packetsSent, 1)
+		atomic.AddUint64(&st.bytesSent, bytes)
+		st.sendRate.record(now, bytes)
 	}
-
-	s.updateSendRate()
 }
 
 // RecordPacketReceived записывает полученный пакет
 func (s *Statistics) RecordPacketReceived(bytes uint64) {
-	atomic.AddUint64(&s.packetsReceived, 1)
-	atomic.AddUint64(&s.bytesReceived, bytes)
-
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.recvHistory = append(s.recvHistory, dataPoint{
-		timestamp: time.Now(),
-		bytes:     bytes,
-		packets:   1,
-	})
-
-	if len(s.recvHistory) > s.historySize {
-		s.recvHistory = s.recvHistory[1:]
+	now := time.Now()
+	for st := s; st != nil; st = st.parent {
+		atomic.AddUint64(&st.packetsReceived, 1)
+		atomic.AddUint64(&st.bytesReceived, bytes)
+		st.recvRate.record(now, bytes)
 	}
-
-	s.updateRecvRate()
 }
 
 // RecordPacketLost записывает потерянный пакет
 func (s *Statistics) RecordPacketLost() {
-	atomic.AddUint64(&s.packetsLost, 1)
+	for st := s; st != nil; st = st.parent {
+		atomic.AddUint64(&st.packetsLost, 1)
+	}
 }
 
 // RecordPacketRetried записывает повторную отправку пакета
 func (s *Statistics) RecordPacketRetried() {
-	atomic.AddUint64(&s.packetsRetried, 1)
+	for st := s; st != nil; st = st.parent {
+		atomic.AddUint64(&st.packetsRetried, 1)
+	}
 }
 
 // RecordError записывает ошибку
 func (s *Statistics) RecordError() {
-	atomic.AddUint64(&s.errors, 1)
+	for st := s; st != nil; st = st.parent {
+		atomic.AddUint64(&st.errors, 1)
+	}
 }
 
 // RecordTimeout записывает таймаут
 func (s *Statistics) RecordTimeout() {
-	atomic.AddUint64(&s.timeouts, 1)
+	for st := s; st != nil; st = st.parent {
+		atomic.AddUint64(&st.timeouts, 1)
+	}
 }
 
 // RecordReset записывает сброс соединения
 func (s *Statistics) RecordReset() {
-	atomic.AddUint64(&s.resets, 1)
+	for st := s; st != nil; st = st.parent {
+		atomic.AddUint64(&st.resets, 1)
+	}
 }
 
 // RecordLatency записывает задержку в микросекундах
 func (s *Statistics) RecordLatency(latencyUs uint64) {
-	// Обновляем минимум
-	for {
-		old := atomic.LoadUint64(&s.minLatency)
-		if latencyUs >= old {
-			break
-		}
-		if atomic.CompareAndSwapUint64(&s.minLatency, old, latencyUs) {
-			break
-		}
+	for st := s; st != nil; st = st.parent {
+		st.latency.Record(latencyUs)
 	}
-
-	// Обновляем максимум
-	for {
-		old := atomic.LoadUint64(&s.maxLatency)
-		if latencyUs <= old {
-			break
-		}
-		if atomic.CompareAndSwapUint64(&s.maxLatency, old, latencyUs) {
-			break
-		}
-	}
-
-	// Обновляем среднее
-	atomic.AddUint64(&s.totalLatency, latencyUs)
-	count := atomic.AddUint64(&s.latencyCount, 1)
-	atomic.StoreUint64(&s.avgLatency, atomic.LoadUint64(&s.totalLatency)/count)
 }
 
-// updateSendRate обновляет скорость отправки (должна вызываться под lock)
-func (s *Statistics) updateSendRate() {
-	if len(s.sendHistory) < 2 {
-		return
-	}
-
-	// Берём данные за последние N секунд
-	now := time.Now()
-	cutoff := now.Add(-time.Second * 10) // последние 10 секунд
-
-	var totalBytes uint64
-	var totalPackets uint64
-	var count int
-
-	for i := len(s.sendHistory) - 1; i >= 0; i-- {
-		if s.sendHistory[i].timestamp.Before(cutoff) {
-			break
-		}
-		totalBytes += s.sendHistory[i].bytes
-		totalPackets += s.sendHistory[i].packets
-		count++
-	}
-
-	if count > 1 {
-		duration := now.Sub(s.sendHistory[len(s.sendHistory)-count].timestamp).Seconds()
-		if duration > 0 {
-			s.sendRateBytesPerSec = float64(totalBytes) / duration
-			s.sendRatePacketsPerSec = float64(totalPackets) / duration
-		}
-	}
+// NewChild создаёт дочернюю статистику с теми же окнами скорости. Записи в
+// дочернюю статистику учитываются и в ней, и во всех её предках, поэтому
+// родитель хранит итоги, а дети - показатели отдельных соединений.
+// Reset дочерней статистики не затрагивает родителя.
+func (s *Statistics) NewChild() *Statistics {
+	child := NewStatisticsWithWindows(s.rateWindows...)
+	child.parent = s
+	return child
 }
 
-// updateRecvRate обновляет скорость приёма (должна вызываться под lock)
-func (s *Statistics) updateRecvRate() {
-	if len(s.recvHistory) < 2 {
-		return
-	}
-
-	now := time.Now()
-	cutoff := now.Add(-time.Second * 10)
-
-	var totalBytes uint64
-	var totalPackets uint64
-	var count int
-
-	for i := len(s.recvHistory) - 1; i >= 0; i-- {
-		if s.recvHistory[i].timestamp.Before(cutoff) {
-			break
-		}
-		totalBytes += s.recvHistory[i].bytes
-		totalPackets += s.recvHistory[i].packets
-		count++
-	}
-
-	if count > 1 {
-		duration := now.Sub(s.recvHistory[len(s.recvHistory)-count].timestamp).Seconds()
-		if duration > 0 {
-			s.recvRateBytesPerSec = float64(totalBytes) / duration
-			s.recvRatePacketsPerSec = float64(totalPackets) / duration
-		}
-	}
+// Parent возвращает родительскую статистику или nil
+func (s *Statistics) Parent() *Statistics {
+	return s.parent
 }
 
 // GetPacketsSent возвращает количество отправленных пакетов
@@ -273,51 +193,85 @@ func (s *Statistics) GetResets() uint64 {
 	return atomic.LoadUint64(&s.resets)
 }
 
-// GetSendRate возвращает скорость отправки в байтах/сек
+// GetSendRate возвращает скорость отправки в байтах/сек за основное окно
 func (s *Statistics) GetSendRate() float64 {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.sendRateBytesPerSec
+	bytes, _ := s.GetSendRateOver(s.rateWindows[0])
+	return bytes
 }
 
-// GetRecvRate возвращает скорость приёма в байтах/сек
+// GetRecvRate возвращает скорость приёма в байтах/сек за основное окно
 func (s *Statistics) GetRecvRate() float64 {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.recvRateBytesPerSec
+	bytes, _ := s.GetRecvRateOver(s.rateWindows[0])
+	return bytes
 }
 
-// GetSendRatePackets возвращает скорость отправки в пакетах/сек
+// GetSendRatePackets возвращает скорость отправки в пакетах/сек за основное окно
 func (s *Statistics) GetSendRatePackets() float64 {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.sendRatePacketsPerSec
+	_, packets := s.GetSendRateOver(s.rateWindows[0])
+	return packets
 }
 
-// GetRecvRatePackets возвращает скорость приёма в пакетах/сек
+// GetRecvRatePackets возвращает скорость приёма в пакетах/сек за основное окно
 func (s *Statistics) GetRecvRatePackets() float64 {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.recvRatePacketsPerSec
+	_, packets := s.GetRecvRateOver(s.rateWindows[0])
+	return packets
+}
+
+// GetSendRateOver возвращает скорость отправки в байтах и пакетах в секунду
+// за окно window. Окна длиннее наибольшего настроенного укорачиваются до него.
+func (s *Statistics) GetSendRateOver(window time.Duration) (bytesPerSec, packetsPerSec float64) {
+	return s.sendRate.rate(window, time.Now())
+}
+
+// GetRecvRateOver возвращает скорость приёма в байтах и пакетах в секунду за окно window
+func (s *Statistics) GetRecvRateOver(window time.Duration) (bytesPerSec, packetsPerSec float64) {
+	return s.recvRate.rate(window, time.Now())
+}
+
+// GetRateWindows возвращает настроенные окна расчёта скорости, первое - основное
+func (s *Statistics) GetRateWindows() []time.Duration {
+	return append([]time.Duration(nil), s.rateWindows...)
+}
+
+// getRates возвращает скорости по всем окнам на момент now
+func (s *Statistics) getRates(now time.Time) []WindowRate {
+	rates := make([]WindowRate, len(s.rateWindows))
+	for i, w := range s.rateWindows {
+		rates[i].Window = w
+		rates[i].SendBytesPerSec, rates[i].SendPacketsPerSec = s.sendRate.rate(w, now)
+		rates[i].RecvBytesPerSec, rates[i].RecvPacketsPerSec = s.recvRate.rate(w, now)
+	}
+	return rates
 }
 
 // GetMinLatency возвращает минимальную задержку в микросекундах
 func (s *Statistics) GetMinLatency() uint64 {
-	lat := atomic.LoadUint64(&s.minLatency)
-	if lat == ^uint64(0) {
-		return 0
-	}
-	return lat
+	return s.latency.Min()
 }
 
 // GetMaxLatency возвращает максимальную задержку в микросекундах
 func (s *Statistics) GetMaxLatency() uint64 {
-	return atomic.LoadUint64(&s.maxLatency)
+	return s.latency.Max()
 }
 
 // GetAvgLatency возвращает среднюю задержку в микросекундах
 func (s *Statistics) GetAvgLatency() uint64 {
-	return atomic.LoadUint64(&s.avgLatency)
+	return s.latency.Mean()
+}
+
+// GetLatencyCount возвращает количество измерений задержки
+func (s *Statistics) GetLatencyCount() uint64 {
+	return s.latency.Count()
+}
+
+// GetLatencyPercentile возвращает p-й перцентиль задержки (p от 0 до 100) в микросекундах
+func (s *Statistics) GetLatencyPercentile(p float64) uint64 {
+	return s.latency.Snapshot().Percentile(p)
+}
+
+// GetLatencyHistogram возвращает снимок гистограммы задержек
+func (s *Statistics) GetLatencyHistogram() HistogramSnapshot {
+	return s.latency.Snapshot()
 }
 
 // GetPacketLossRate возвращает процент потерянных пакетов
@@ -355,22 +309,15 @@ func (s *Statistics) Reset() {
 	atomic.StoreUint64(&s.errors, 0)
 	atomic.StoreUint64(&s.timeouts, 0)
 	atomic.StoreUint64(&s.resets, 0)
-	atomic.StoreUint64(&s.minLatency, ^uint64(0))
-	atomic.StoreUint64(&s.maxLatency, 0)
-	atomic.StoreUint64(&s.avgLatency, 0)
-	atomic.StoreUint64(&s.totalLatency, 0)
-	atomic.StoreUint64(&s.latencyCount, 0)
+	s.latency.Reset()
+
+	now := time.Now()
+	s.sendRate.reset(now)
+	s.recvRate.reset(now)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
-
-	s.lastResetTime = time.Now()
-	s.sendHistory = make([]dataPoint, 0, s.historySize)
-	s.recvHistory = make([]dataPoint, 0, s.historySize)
-	s.sendRateBytesPerSec = 0
-	s.recvRateBytesPerSec = 0
-	s.sendRatePacketsPerSec = 0
-	s.recvRatePacketsPerSec = 0
+	s.lastResetTime = now
 }
 
 // Snapshot представляет снимок статистики в определённый момент времени
@@ -388,16 +335,29 @@ type Snapshot struct {
 	Timeouts        uint64
 	Resets          uint64
 
-	// Скорости
+	// Скорости за основное окно
 	SendRateBytesPerSec   float64
 	RecvRateBytesPerSec   float64
 	SendRatePacketsPerSec float64
 	RecvRatePacketsPerSec float64
 
+	// Скорости по всем настроенным окнам, первое - основное
+	Rates []WindowRate
+
 	// Задержки (микросекунды)
 	MinLatencyUs uint64
 	MaxLatencyUs uint64
 	AvgLatencyUs uint64
+	LatencyCount uint64
+
+	// Перцентили задержки (микросекунды)
+	P50LatencyUs  uint64
+	P90LatencyUs  uint64
+	P99LatencyUs  uint64
+	P999LatencyUs uint64
+
+	// Гистограмма задержек, по которой объединяются перцентили
+	LatencyHistogram HistogramSnapshot
 
 	// Производные метрики
 	PacketLossRate float64
@@ -407,8 +367,11 @@ type Snapshot struct {
 
 // GetSnapshot возвращает снимок текущей статистики
 func (s *Statistics) GetSnapshot() Snapshot {
-	return Snapshot{
-		Timestamp:             time.Now(),
+	now := time.Now()
+	hist := s.latency.Snapshot()
+	rates := s.getRates(now)
+	snap := Snapshot{
+		Timestamp:             now,
 		PacketsSent:           s.GetPacketsSent(),
 		PacketsReceived:       s.GetPacketsReceived(),
 		PacketsLost:           s.GetPacketsLost(),
@@ -418,17 +381,110 @@ func (s *Statistics) GetSnapshot() Snapshot {
 		Errors:                s.GetErrors(),
 		Timeouts:              s.GetTimeouts(),
 		Resets:                s.GetResets(),
-		SendRateBytesPerSec:   s.GetSendRate(),
-		RecvRateBytesPerSec:   s.GetRecvRate(),
-		SendRatePacketsPerSec: s.GetSendRatePackets(),
-		RecvRatePacketsPerSec: s.GetRecvRatePackets(),
-		MinLatencyUs:          s.GetMinLatency(),
-		MaxLatencyUs:          s.GetMaxLatency(),
-		AvgLatencyUs:          s.GetAvgLatency(),
+		SendRateBytesPerSec:   rates[0].SendBytesPerSec,
+		RecvRateBytesPerSec:   rates[0].RecvBytesPerSec,
+		SendRatePacketsPerSec: rates[0].SendPacketsPerSec,
+		RecvRatePacketsPerSec: rates[0].RecvPacketsPerSec,
+		Rates:                 rates,
+		MinLatencyUs:          hist.MinUs,
+		MaxLatencyUs:          hist.MaxUs,
+		AvgLatencyUs:          hist.Mean(),
+		LatencyCount:          hist.Count,
+		LatencyHistogram:      hist,
 		PacketLossRate:        s.GetPacketLossRate(),
 		Uptime:                s.GetUptime(),
 		TimeSinceReset:        s.GetTimeSinceReset(),
 	}
+	snap.setPercentiles()
+	return snap
+}
+
+// setPercentiles заполняет перцентили по гистограмме снимка
+func (snap *Snapshot) setPercentiles() {
+	snap.P50LatencyUs = snap.LatencyHistogram.Percentile(50)
+	snap.P90LatencyUs = snap.LatencyHistogram.Percentile(90)
+	snap.P99LatencyUs = snap.LatencyHistogram.Percentile(99)
+	snap.P999LatencyUs = snap.LatencyHistogram.Percentile(99.9)
+}
+
+// MergeSnapshots объединяет снимки нескольких источников в один.
+// Счётчики и скорости суммируются, средняя задержка взвешивается по числу измерений,
+// перцентили пересчитываются по объединённой гистограмме.
+func MergeSnapshots(snaps ...Snapshot) Snapshot {
+	var merged Snapshot
+	var totalLatency uint64
+
+	for _, snap := range snaps {
+		if snap.Timestamp.After(merged.Timestamp) {
+			merged.Timestamp = snap.Timestamp
+		}
+
+		merged.PacketsSent += snap.PacketsSent
+		merged.PacketsReceived += snap.PacketsReceived
+		merged.PacketsLost += snap.PacketsLost
+		merged.PacketsRetried += snap.PacketsRetried
+		merged.BytesSent += snap.BytesSent
+		merged.BytesReceived += snap.BytesReceived
+		merged.Errors += snap.Errors
+		merged.Timeouts += snap.Timeouts
+		merged.Resets += snap.Resets
+
+		merged.SendRateBytesPerSec += snap.SendRateBytesPerSec
+		merged.RecvRateBytesPerSec += snap.RecvRateBytesPerSec
+		merged.SendRatePacketsPerSec += snap.SendRatePacketsPerSec
+		merged.RecvRatePacketsPerSec += snap.RecvRatePacketsPerSec
+		merged.Rates = mergeRates(merged.Rates, snap.Rates)
+
+		if snap.LatencyCount > 0 {
+			if merged.LatencyCount == 0 || snap.MinLatencyUs < merged.MinLatencyUs {
+				merged.MinLatencyUs = snap.MinLatencyUs
+			}
+			if snap.MaxLatencyUs > merged.MaxLatencyUs {
+				merged.MaxLatencyUs = snap.MaxLatencyUs
+			}
+			merged.LatencyCount += snap.LatencyCount
+			totalLatency += snap.AvgLatencyUs * snap.LatencyCount
+		}
+		merged.LatencyHistogram = merged.LatencyHistogram.Merge(snap.LatencyHistogram)
+
+		if snap.Uptime > merged.Uptime {
+			merged.Uptime = snap.Uptime
+		}
+		if snap.TimeSinceReset > merged.TimeSinceReset {
+			merged.TimeSinceReset = snap.TimeSinceReset
+		}
+	}
+
+	if merged.LatencyCount > 0 {
+		merged.AvgLatencyUs = totalLatency / merged.LatencyCount
+	}
+	merged.setPercentiles()
+	if merged.PacketsSent > 0 {
+		merged.PacketLossRate = float64(merged.PacketsLost) / float64(merged.PacketsSent) * 100.0
+	}
+
+	return merged
+}
+
+// mergeRates суммирует скорости по окнам одинаковой длины, сохраняя порядок окон
+func mergeRates(into, rates []WindowRate) []WindowRate {
+	for _, r := range rates {
+		found := false
+		for i := range into {
+			if into[i].Window == r.Window {
+				into[i].SendBytesPerSec += r.SendBytesPerSec
+				into[i].RecvBytesPerSec += r.RecvBytesPerSec
+				into[i].SendPacketsPerSec += r.SendPacketsPerSec
+				into[i].RecvPacketsPerSec += r.RecvPacketsPerSec
+				found = true
+				break
+			}
+		}
+		if !found {
+			into = append(into, r)
+		}
+	}
+	return into
 }
 
 // FormatBytes форматирует байты в читаемый вид
@@ -452,7 +508,7 @@ func FormatRate(bytesPerSec float64) string {
 
 // String возвращает строковое представление статистики
 func (snap Snapshot) String() string {
-	return fmt.Sprintf(`Statistics Snapshot:
+	str := fmt.Sprintf(`Statistics Snapshot:
   Uptime: %v (since reset: %v)
 
   Packets:
@@ -473,7 +529,8 @@ func (snap Snapshot) String() string {
   Latency:
     Min: %d μs
     Avg: %d μs
-    Max: %d μs`,
+    Max: %d μs
+    P50: %d μs  P90: %d μs  P99: %d μs  P99.9: %d μs`,
 		snap.Uptime, snap.TimeSinceReset,
 		snap.PacketsSent, snap.SendRatePacketsPerSec,
 		snap.PacketsReceived, snap.RecvRatePacketsPerSec,
@@ -483,5 +540,16 @@ func (snap Snapshot) String() string {
 		FormatBytes(snap.BytesReceived), FormatRate(snap.RecvRateBytesPerSec),
 		snap.Errors, snap.Timeouts, snap.Resets,
 		snap.MinLatencyUs, snap.AvgLatencyUs, snap.MaxLatencyUs,
+		snap.P50LatencyUs, snap.P90LatencyUs, snap.P99LatencyUs, snap.P999LatencyUs,
 	)
+
+	if len(snap.Rates) > 0 {
+		str += "\n\n  Rates (send / recv):"
+		for _, r := range snap.Rates {
+			str += fmt.Sprintf("\n    %-4v %s / %s (%.2f / %.2f pkt/s)", r.Window.String()+":",
+				FormatRate(r.SendBytesPerSec), FormatRate(r.RecvBytesPerSec),
+				r.SendPacketsPerSec, r.RecvPacketsPerSec)
+		}
+	}
+	return str
 }
@@ -458,6 +458,57 @@ func TestSnapshot_String(t *testing.T) {
 	}
 }
 
+func TestMergeSnapshots(t *testing.T) {
+	a := NewStatistics()
+	a.RecordPacketSent(100)
+	a.RecordPacketSent(100)
+	a.RecordPacketLost()
+	a.RecordLatency(100)
+	a.RecordLatency(300)
+
+	b := NewStatistics()
+	b.RecordPacketSent(50)
+	b.RecordPacketReceived(70)
+	b.RecordReset()
+	b.RecordLatency(50)
+
+	empty := NewStatistics()
+
+	merged := MergeSnapshots(a.GetSnapshot(), b.GetSnapshot(), empty.GetSnapshot())
+
+	if merged.PacketsSent != 3 {
+		t.Errorf("PacketsSent = %v, want 3", merged.PacketsSent)
+	}
+	if merged.BytesSent != 250 {
+		t.Errorf("BytesSent = %v, want 250", merged.BytesSent)
+	}
+	if merged.BytesReceived != 70 {
+		t.Errorf("BytesReceived = %v, want 70", merged.BytesReceived)
+	}
+	if merged.Resets != 1 {
+		t.Errorf("Resets = %v, want 1", merged.Resets)
+	}
+	if merged.MinLatencyUs != 50 || merged.MaxLatencyUs != 300 {
+		t.Errorf("latency min/max = %v/%v, want 50/300", merged.MinLatencyUs, merged.MaxLatencyUs)
+	}
+	if merged.LatencyCount != 3 {
+		t.Errorf("LatencyCount = %v, want 3", merged.LatencyCount)
+	}
+	if merged.AvgLatencyUs != 150 {
+		t.Errorf("AvgLatencyUs = %v, want 150", merged.AvgLatencyUs)
+	}
+	if merged.PacketLossRate < 33.3 || merged.PacketLossRate > 33.4 {
+		t.Errorf("PacketLossRate = %v, want ~33.33", merged.PacketLossRate)
+	}
+}
+
+func TestMergeSnapshots_Empty(t *testing.T) {
+	merged := MergeSnapshots()
+	if merged.PacketsSent != 0 || merged.MinLatencyUs != 0 || merged.PacketLossRate != 0 {
+		t.Errorf("MergeSnapshots() = %+v, want zero snapshot", merged)
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && containsAt(s, substr, 0))
 }
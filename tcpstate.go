@@ -1,9 +1,11 @@
 package tcpconn
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 )
 
 var (
@@ -95,6 +97,8 @@ const (
 	TIMEOUT
 	// RST - сброс соединения
 	RST
+	// SEND - локальная отправка данных; из LISTEN превращает пассивное открытие в активное
+	SEND
 )
 
 // String возвращает строковое представление события
@@ -120,25 +124,63 @@ func (e TCPEvent) String() string {
 		return "TIMEOUT"
 	case RST:
 		return "RST"
+	case SEND:
+		return "SEND"
 	default:
 		return fmt.Sprintf("UNKNOWN(%d)", e)
 	}
 }
 
+// Origin описывает, как было открыто соединение (RFC 9293, 3.10.7.3)
+type Origin int
+
+const (
+	// OriginNone - соединение не открывалось
+	OriginNone Origin = iota
+	// OriginActive - активное открытие (ACTIVE_OPEN или SEND из LISTEN)
+	OriginActive
+	// OriginPassive - пассивное открытие (PASSIVE_OPEN)
+	OriginPassive
+)
+
+// String возвращает строковое представление происхождения
+func (o Origin) String() string {
+	switch o {
+	case OriginNone:
+		return "NONE"
+	case OriginActive:
+		return "ACTIVE"
+	case OriginPassive:
+		return "PASSIVE"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", o)
+	}
+}
+
 // StateChangeCallback вызывается при изменении состояния
 type StateChangeCallback func(oldState, newState TCPState, event TCPEvent)
 
 // ErrorCallback вызывается при ошибке перехода
 type ErrorCallback func(state TCPState, event TCPEvent, err error)
 
-// TCPStateMachine представляет машину состояний TCP
+// TCPStateMachine представляет машину состояний TCP.
+// Нулевое значение работает по таблице RFC 9293 без истории переходов;
+// UnmarshalJSON и UnmarshalBinary берут для него таблицу снимка из реестра.
 type TCPStateMachine struct {
-	currentState      TCPState
-	mu                sync.RWMutex
-	onStateChange     StateChangeCallback
-	onError           ErrorCallback
-	transitionHistory []StateTransition
-	maxHistorySize    int
+	currentState  TCPState
+	mu            sync.RWMutex
+	onStateChange StateChangeCallback
+	onError       ErrorCallback
+	history       historyRing
+	observers     []observer
+	nextObserver  int
+	clock         Clock
+	queue         []notification
+	queueHead     int
+	delivering    bool
+	table         *TransitionTable
+	value         any
+	origin        Origin
 }
 
 // StateTransition представляет запись о переходе состояния
@@ -146,25 +188,101 @@ type StateTransition struct {
 	FromState TCPState
 	ToState   TCPState
 	Event     TCPEvent
+	// Time - момент перехода
+	Time time.Time
+	// Meta - необязательные сведения, переданные в ProcessEventWithMeta
+	Meta TransitionMeta
 }
 
-// NewTCPStateMachine создает новую машину состояний TCP
+// NewTCPStateMachine создает новую машину состояний TCP по таблице RFC 9293
 func NewTCPStateMachine() *TCPStateMachine {
+	return NewTCPStateMachineFromTable(rfc9293Table)
+}
+
+// NewTCPStateMachineFromTable создает машину состояний по произвольной таблице переходов
+func NewTCPStateMachineFromTable(table *TransitionTable) *TCPStateMachine {
 	return &TCPStateMachine{
-		currentState:      CLOSED,
-		transitionHistory: make([]StateTransition, 0),
-		maxHistorySize:    100,
+		currentState: table.Initial(),
+		history:      historyRing{size: DefaultHistorySize},
+		table:        table,
+	}
+}
+
+// Table возвращает копию таблицы переходов машины, например для экспорта
+// диаграмм. Таблицу машины по умолчанию и зарегистрированные таблицы так
+// изменить нельзя; таблица из NewTCPStateMachineFromTable меняется напрямую.
+func (sm *TCPStateMachine) Table() *TransitionTable {
+	t := sm.rules()
+	return t.Clone(t.Name())
+}
+
+// rules возвращает таблицу переходов машины; нулевая машина работает
+// по таблице RFC 9293
+func (sm *TCPStateMachine) rules() *TransitionTable {
+	if sm.table == nil {
+		return rfc9293Table
 	}
+	return sm.table
 }
 
-// SetStateChangeCallback устанавливает callback для изменения состояния
+// SetValue задает пользовательские данные, передаваемые условиям и действиям таблицы
+func (sm *TCPStateMachine) SetValue(v any) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.value = v
+}
+
+// SetClock задает часы для отметок времени истории и таймеров StartTimers;
+// nil возвращает системные часы
+func (sm *TCPStateMachine) SetClock(c Clock) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.clock = c
+}
+
+// Clock возвращает часы машины
+func (sm *TCPStateMachine) Clock() Clock {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if sm.clock == nil {
+		return SystemClock()
+	}
+	return sm.clock
+}
+
+// now возвращает текущее время часов машины. Вызывается под sm.mu.
+func (sm *TCPStateMachine) now() time.Time {
+	if sm.clock == nil {
+		return time.Now()
+	}
+	return sm.clock.Now()
+}
+
+// Origin возвращает происхождение текущего соединения
+func (sm *TCPStateMachine) Origin() Origin {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.origin
+}
+
+// Value возвращает пользовательские данные машины
+func (sm *TCPStateMachine) Value() any {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.value
+}
+
+// SetStateChangeCallback устанавливает callback для изменения состояния.
+// Callback вызывается после снятия блокировки, строго в порядке переходов,
+// поэтому из него можно вызывать методы машины, в том числе ProcessEvent.
 func (sm *TCPStateMachine) SetStateChangeCallback(cb StateChangeCallback) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.onStateChange = cb
 }
 
-// SetErrorCallback устанавливает callback для ошибок
+// SetErrorCallback устанавливает callback для ошибок.
+// Вызывается, как и callback изменения состояния, после снятия блокировки.
 func (sm *TCPStateMachine) SetErrorCallback(cb ErrorCallback) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -180,142 +298,110 @@ func (sm *TCPStateMachine) GetState() TCPState {
 
 // ProcessEvent обрабатывает событие и изменяет состояние
 func (sm *TCPStateMachine) ProcessEvent(event TCPEvent) error {
+	return sm.ProcessEventWithMeta(event, TransitionMeta{})
+}
+
+// ProcessEventWithMeta обрабатывает событие и сохраняет meta в записи о переходе
+func (sm *TCPStateMachine) ProcessEventWithMeta(event TCPEvent, meta TransitionMeta) error {
+	_, err := sm.process(event, meta)
+	return err
+}
+
+// ProcessEventCtx обрабатывает событие, если ctx еще не отменен, и возвращает
+// состояние, в которое перешла машина именно этим событием. В отличие от
+// пары ProcessEvent + GetState результат не зависит от конкурентных событий.
+func (sm *TCPStateMachine) ProcessEventCtx(ctx context.Context, event TCPEvent) (TCPState, error) {
+	if err := ctx.Err(); err != nil {
+		return sm.GetState(), err
+	}
+	return sm.process(event, TransitionMeta{})
+}
+
+// processIf обрабатывает событие, только если машина все еще в состоянии state.
+// Нужен таймерам: переход мог произойти, пока таймер срабатывал.
+func (sm *TCPStateMachine) processIf(state TCPState, event TCPEvent, meta TransitionMeta) (bool, error) {
 	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	if sm.currentState != state {
+		sm.mu.Unlock()
+		return false, nil
+	}
+	_, err := sm.apply(event, meta)
+	deliver := sm.claimDelivery()
+	sm.mu.Unlock()
+
+	if deliver {
+		sm.deliver()
+	}
+	return err == nil, err
+}
 
+// process выполняет переход под блокировкой, а callback'и и наблюдателей
+// вызывает после ее снятия через очередь уведомлений
+func (sm *TCPStateMachine) process(event TCPEvent, meta TransitionMeta) (TCPState, error) {
+	sm.mu.Lock()
+	state, err := sm.apply(event, meta)
+	deliver := sm.claimDelivery()
+	sm.mu.Unlock()
+
+	if deliver {
+		sm.deliver()
+	}
+	return state, err
+}
+
+// apply выполняет переход и ставит уведомления в очередь. Вызывается под sm.mu.
+func (sm *TCPStateMachine) apply(event TCPEvent, meta TransitionMeta) (TCPState, error) {
 	oldState := sm.currentState
-	newState, err := sm.transition(sm.currentState, event)
+	step, err := sm.transition(sm.currentState, event)
 
 	if err != nil {
 		if sm.onError != nil {
-			sm.onError(sm.currentState, event, err)
+			sm.enqueue(notification{state: oldState, event: event, err: err, onError: sm.onError})
 		}
-		return err
+		return oldState, err
 	}
 
+	newState := step.row.To
+	ctx := TransitionContext{From: oldState, To: newState, Event: event, Origin: sm.origin, Value: sm.value}
+
+	// Выход из старого состояния, действие перехода, вход в новое
+	if step.exit != nil {
+		step.exit(ctx)
+	}
+	if step.row.Action != nil {
+		step.row.Action(ctx)
+	}
 	sm.currentState = newState
+	if step.row.Origin != OriginNone {
+		sm.origin = step.row.Origin
+	}
+	if newState == sm.rules().Initial() {
+		sm.origin = OriginNone
+	}
+	if step.enter != nil {
+		step.enter(ctx)
+	}
 
 	// Сохраняем историю переходов
-	sm.addToHistory(StateTransition{
+	record := StateTransition{
 		FromState: oldState,
 		ToState:   newState,
 		Event:     event,
-	})
-
-	if sm.onStateChange != nil {
-		sm.onStateChange(oldState, newState, event)
+		Time:      sm.now(),
+		Meta:      meta,
 	}
+	sm.history.push(record)
 
-	return nil
-}
-
-// transition определяет переходы между состояниями
-func (sm *TCPStateMachine) transition(state TCPState, event TCPEvent) (TCPState, error) {
-	// RST всегда переводит в CLOSED
-	if event == RST {
-		return CLOSED, nil
-	}
-
-	switch state {
-	case CLOSED:
-		switch event {
-		case PASSIVE_OPEN:
-			return LISTEN, nil
-		case ACTIVE_OPEN:
-			return SYN_SENT, nil
-		}
-
-	case LISTEN:
-		switch event {
-		case SYN:
-			return SYN_RECEIVED, nil
-		case CLOSE:
-			return CLOSED, nil
-		}
-
-	case SYN_SENT:
-		switch event {
-		case SYN_ACK:
-			return ESTABLISHED, nil
-		case SYN:
-			return SYN_RECEIVED, nil
-		case CLOSE:
-			return CLOSED, nil
-		case TIMEOUT:
-			return CLOSED, nil
-		}
-
-	case SYN_RECEIVED:
-		switch event {
-		case ACK:
-			return ESTABLISHED, nil
-		case CLOSE:
-			return FIN_WAIT_1, nil
-		case TIMEOUT:
-			return CLOSED, nil
-		}
-
-	case ESTABLISHED:
-		switch event {
-		case FIN:
-			return CLOSE_WAIT, nil
-		case CLOSE:
-			return FIN_WAIT_1, nil
-		}
-
-	case FIN_WAIT_1:
-		switch event {
-		case FIN:
-			return CLOSING, nil
-		case ACK:
-			return FIN_WAIT_2, nil
-		case FIN_ACK:
-			return TIME_WAIT, nil
-		}
-
-	case FIN_WAIT_2:
-		switch event {
-		case FIN:
-			return TIME_WAIT, nil
-		}
-
-	case CLOSE_WAIT:
-		switch event {
-		case CLOSE:
-			return LAST_ACK, nil
-		}
-
-	case CLOSING:
-		switch event {
-		case ACK:
-			return TIME_WAIT, nil
-		}
-
-	case LAST_ACK:
-		switch event {
-		case ACK:
-			return CLOSED, nil
-		}
-
-	case TIME_WAIT:
-		switch event {
-		case TIMEOUT:
-			return CLOSED, nil
-		}
+	if sm.onStateChange != nil || len(sm.observers) > 0 {
+		sm.enqueue(notification{transition: record, onChange: sm.onStateChange, observers: sm.observers})
 	}
 
-	return state, fmt.Errorf("%w: cannot transition from %s on event %s",
-		ErrInvalidTransition, state, event)
+	return newState, nil
 }
 
-// addToHistory добавляет переход в историю
-func (sm *TCPStateMachine) addToHistory(transition StateTransition) {
-	sm.transitionHistory = append(sm.transitionHistory, transition)
-
-	// Ограничиваем размер истории
-	if len(sm.transitionHistory) > sm.maxHistorySize {
-		sm.transitionHistory = sm.transitionHistory[1:]
-	}
+// transition находит строку таблицы для события в текущем состоянии
+func (sm *TCPStateMachine) transition(state TCPState, event TCPEvent) (transitionStep, error) {
+	return sm.rules().resolve(state, event, sm.origin, sm.value)
 }
 
 // GetHistory возвращает историю переходов
@@ -324,24 +410,23 @@ func (sm *TCPStateMachine) GetHistory() []StateTransition {
 	defer sm.mu.RUnlock()
 
 	// Возвращаем копию истории
-	history := make([]StateTransition, len(sm.transitionHistory))
-	copy(history, sm.transitionHistory)
-	return history
+	return sm.history.snapshot()
 }
 
 // ClearHistory очищает историю переходов
 func (sm *TCPStateMachine) ClearHistory() {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	sm.transitionHistory = make([]StateTransition, 0)
+	sm.history.clear()
 }
 
 // Reset сбрасывает машину состояний в начальное состояние
 func (sm *TCPStateMachine) Reset() {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	sm.currentState = CLOSED
-	sm.transitionHistory = make([]StateTransition, 0)
+	sm.currentState = sm.rules().Initial()
+	sm.origin = OriginNone
+	sm.history.clear()
 }
 
 // IsConnected проверяет, установлено ли соединение
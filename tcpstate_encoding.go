@@ -0,0 +1,401 @@
+package tcpconn
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrUnknownState возвращается при разборе неизвестного имени состояния
+	ErrUnknownState = errors.New("unknown TCP state")
+	// ErrUnknownEvent возвращается при разборе неизвестного имени события
+	ErrUnknownEvent = errors.New("unknown TCP event")
+	// ErrCorruptStateMachine возвращается при разборе поврежденного снимка машины
+	ErrCorruptStateMachine = errors.New("corrupt state machine encoding")
+)
+
+// stateNames и eventNames - обратные таблицы для разбора имен
+var (
+	stateNames = make(map[string]TCPState)
+	eventNames = make(map[string]TCPEvent)
+)
+
+func init() {
+	for s := CLOSED; s <= TIME_WAIT; s++ {
+		stateNames[s.String()] = s
+	}
+	for e := PASSIVE_OPEN; e <= SEND; e++ {
+		eventNames[e.String()] = e
+	}
+}
+
+// ParseTCPState разбирает имя состояния ("ESTABLISHED") или его номер
+func ParseTCPState(name string) (TCPState, error) {
+	if s, ok := stateNames[name]; ok {
+		return s, nil
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		return TCPState(n), nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownState, name)
+}
+
+// ParseTCPEvent разбирает имя события ("SYN_ACK") или его номер
+func ParseTCPEvent(name string) (TCPEvent, error) {
+	if e, ok := eventNames[name]; ok {
+		return e, nil
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		return TCPEvent(n), nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownEvent, name)
+}
+
+// MarshalText возвращает имя состояния; пользовательские состояния - номером
+func (s TCPState) MarshalText() ([]byte, error) {
+	if _, ok := stateNames[s.String()]; ok {
+		return []byte(s.String()), nil
+	}
+	return strconv.AppendInt(nil, int64(s), 10), nil
+}
+
+// UnmarshalText разбирает результат MarshalText
+func (s *TCPState) UnmarshalText(text []byte) error {
+	v, err := ParseTCPState(string(text))
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
+
+// MarshalText возвращает имя события; пользовательские события - номером
+func (e TCPEvent) MarshalText() ([]byte, error) {
+	if _, ok := eventNames[e.String()]; ok {
+		return []byte(e.String()), nil
+	}
+	return strconv.AppendInt(nil, int64(e), 10), nil
+}
+
+// UnmarshalText разбирает результат MarshalText
+func (e *TCPEvent) UnmarshalText(text []byte) error {
+	v, err := ParseTCPEvent(string(text))
+	if err != nil {
+		return err
+	}
+	*e = v
+	return nil
+}
+
+// MarshalText возвращает имя происхождения соединения
+func (o Origin) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText разбирает результат MarshalText
+func (o *Origin) UnmarshalText(text []byte) error {
+	for _, v := range []Origin{OriginNone, OriginActive, OriginPassive} {
+		if v.String() == string(text) {
+			*o = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown connection origin %q", text)
+}
+
+// stateMachineJSON - схема JSON машины состояний. Состояния и события
+// записываются именами таблицы, чтобы пользовательские машины тоже читались.
+type stateMachineJSON struct {
+	Machine     string           `json:"machine"`
+	State       string           `json:"state"`
+	Origin      Origin           `json:"origin"`
+	HistorySize int              `json:"history_size"`
+	History     []transitionJSON `json:"history"`
+}
+
+type transitionJSON struct {
+	Time   time.Time `json:"time"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Event  string    `json:"event"`
+	Seq    uint32    `json:"seq,omitempty"`
+	Ack    uint32    `json:"ack,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Packet string    `json:"packet,omitempty"`
+}
+
+// MarshalJSON сохраняет имя таблицы, текущее состояние, происхождение,
+// размер и содержимое истории. Callback'и, наблюдатели и Value не сохраняются.
+func (sm *TCPStateMachine) MarshalJSON() ([]byte, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	t := sm.rules()
+	doc := stateMachineJSON{
+		Machine:     t.Name(),
+		State:       t.StateName(sm.currentState),
+		Origin:      sm.origin,
+		HistorySize: sm.history.size,
+		History:     make([]transitionJSON, 0, len(sm.history.buf)),
+	}
+	for _, tr := range sm.history.snapshot() {
+		doc.History = append(doc.History, transitionJSON{
+			Time:   tr.Time,
+			From:   t.StateName(tr.FromState),
+			To:     t.StateName(tr.ToState),
+			Event:  t.EventName(tr.Event),
+			Seq:    tr.Meta.Seq,
+			Ack:    tr.Meta.Ack,
+			Reason: tr.Meta.Reason,
+			Packet: tr.Meta.Packet,
+		})
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON восстанавливает машину из MarshalJSON. Машина без таблицы
+// (нулевое значение) берет ее из реестра по имени; у машины с таблицей имя
+// должно совпадать. Callback'и не вызываются, таймеры StartTimers нужно
+// перезапустить.
+func (sm *TCPStateMachine) UnmarshalJSON(data []byte) error {
+	var doc stateMachineJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	table, err := sm.restoreTable(doc.Machine)
+	if err != nil {
+		return err
+	}
+	state, err := table.parseState(doc.State)
+	if err != nil {
+		return err
+	}
+	history := make([]StateTransition, 0, len(doc.History))
+	for _, tr := range doc.History {
+		from, err := table.parseState(tr.From)
+		if err != nil {
+			return err
+		}
+		to, err := table.parseState(tr.To)
+		if err != nil {
+			return err
+		}
+		event, err := table.parseEvent(tr.Event)
+		if err != nil {
+			return err
+		}
+		history = append(history, StateTransition{
+			FromState: from,
+			ToState:   to,
+			Event:     event,
+			Time:      tr.Time,
+			Meta:      TransitionMeta{Seq: tr.Seq, Ack: tr.Ack, Reason: tr.Reason, Packet: tr.Packet},
+		})
+	}
+
+	sm.restore(table, state, doc.Origin, doc.HistorySize, history)
+	return nil
+}
+
+// stateMachineBinaryVersion - версия двоичного формата MarshalBinary
+const stateMachineBinaryVersion = 1
+
+// stateMachineMagic начинает двоичный снимок машины
+var stateMachineMagic = []byte("TSM")
+
+// MarshalBinary сохраняет то же, что и MarshalJSON, в компактном двоичном виде.
+// Состояния и события записываются номерами.
+func (sm *TCPStateMachine) MarshalBinary() ([]byte, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	buf := append([]byte(nil), stateMachineMagic...)
+	buf = append(buf, stateMachineBinaryVersion)
+	buf = appendString(buf, sm.rules().Name())
+	buf = binary.AppendVarint(buf, int64(sm.currentState))
+	buf = binary.AppendUvarint(buf, uint64(sm.origin))
+	buf = binary.AppendUvarint(buf, uint64(sm.history.size))
+
+	history := sm.history.snapshot()
+	buf = binary.AppendUvarint(buf, uint64(len(history)))
+	for _, tr := range history {
+		buf = binary.AppendVarint(buf, int64(tr.FromState))
+		buf = binary.AppendVarint(buf, int64(tr.ToState))
+		buf = binary.AppendVarint(buf, int64(tr.Event))
+		var nanos int64
+		if !tr.Time.IsZero() {
+			nanos = tr.Time.UnixNano()
+		}
+		buf = binary.AppendVarint(buf, nanos)
+		buf = binary.AppendUvarint(buf, uint64(tr.Meta.Seq))
+		buf = binary.AppendUvarint(buf, uint64(tr.Meta.Ack))
+		buf = appendString(buf, tr.Meta.Reason)
+		buf = appendString(buf, tr.Meta.Packet)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary восстанавливает машину из MarshalBinary по тем же правилам,
+// что и UnmarshalJSON
+func (sm *TCPStateMachine) UnmarshalBinary(data []byte) error {
+	if len(data) < len(stateMachineMagic)+1 || string(data[:len(stateMachineMagic)]) != string(stateMachineMagic) {
+		return fmt.Errorf("%w: bad magic", ErrCorruptStateMachine)
+	}
+	if v := data[len(stateMachineMagic)]; v != stateMachineBinaryVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrCorruptStateMachine, v)
+	}
+	r := binaryReader{buf: data[len(stateMachineMagic)+1:]}
+
+	name := r.string()
+	state := TCPState(r.varint())
+	origin := Origin(r.uvarint())
+	size := int(r.uvarint())
+	n := r.uvarint()
+	if r.err == nil && n > uint64(len(r.buf)) {
+		r.err = errors.New("history length exceeds data")
+	}
+
+	var history []StateTransition
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		tr := StateTransition{
+			FromState: TCPState(r.varint()),
+			ToState:   TCPState(r.varint()),
+			Event:     TCPEvent(r.varint()),
+		}
+		if nanos := r.varint(); nanos != 0 {
+			tr.Time = time.Unix(0, nanos)
+		}
+		tr.Meta.Seq = uint32(r.uvarint())
+		tr.Meta.Ack = uint32(r.uvarint())
+		tr.Meta.Reason = r.string()
+		tr.Meta.Packet = r.string()
+		history = append(history, tr)
+	}
+	if r.err == nil && len(r.buf) > 0 {
+		r.err = errors.New("trailing data")
+	}
+	if r.err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptStateMachine, r.err)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	table, err := sm.restoreTable(name)
+	if err != nil {
+		return err
+	}
+	sm.restore(table, state, origin, size, history)
+	return nil
+}
+
+// restoreTable выбирает таблицу для восстановления. Вызывается под sm.mu.
+func (sm *TCPStateMachine) restoreTable(name string) (*TransitionTable, error) {
+	if sm.table == nil {
+		table, ok := lookupMachine(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownMachine, name)
+		}
+		return table, nil
+	}
+	if sm.table.Name() != name {
+		return nil, fmt.Errorf("snapshot of machine %q restored into %q", name, sm.table.Name())
+	}
+	return sm.table, nil
+}
+
+// restore заменяет состояние и историю машины. Вызывается под sm.mu.
+func (sm *TCPStateMachine) restore(table *TransitionTable, state TCPState, origin Origin, size int, history []StateTransition) {
+	sm.table = table
+	sm.currentState = state
+	sm.origin = origin
+	sm.history = historyRing{size: size}
+	for _, tr := range history {
+		sm.history.push(tr)
+	}
+}
+
+// parseState разбирает имя состояния с учетом NameState
+func (t *TransitionTable) parseState(name string) (TCPState, error) {
+	t.mu.RLock()
+	for s, n := range t.states {
+		if n == name {
+			t.mu.RUnlock()
+			return s, nil
+		}
+	}
+	t.mu.RUnlock()
+	return ParseTCPState(name)
+}
+
+// parseEvent разбирает имя события с учетом NameEvent
+func (t *TransitionTable) parseEvent(name string) (TCPEvent, error) {
+	t.mu.RLock()
+	for e, n := range t.events {
+		if n == name {
+			t.mu.RUnlock()
+			return e, nil
+		}
+	}
+	t.mu.RUnlock()
+	return ParseTCPEvent(name)
+}
+
+// appendString записывает строку с длиной в uvarint
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// binaryReader читает varint-поля, запоминая первую ошибку
+type binaryReader struct {
+	buf []byte
+	err error
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = errors.New("truncated uvarint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = errors.New("truncated varint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) string() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if n > uint64(len(r.buf)) {
+		r.err = errors.New("truncated string")
+		return ""
+	}
+	s := string(r.buf[:n])
+	r.buf = r.buf[n:]
+	return s
+}
@@ -0,0 +1,182 @@
+package tcpconn
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTCPState_TextMarshal(t *testing.T) {
+	for s := CLOSED; s <= TIME_WAIT; s++ {
+		text, err := s.MarshalText()
+		if err != nil || string(text) != s.String() {
+			t.Errorf("%d.MarshalText() = %q, %v; want %q", s, text, err, s.String())
+		}
+		var got TCPState
+		if err := got.UnmarshalText(text); err != nil || got != s {
+			t.Errorf("UnmarshalText(%q) = %v, %v; want %v", text, got, err, s)
+		}
+	}
+
+	// Пользовательские состояния записываются номером
+	custom := TCPState(100)
+	text, _ := custom.MarshalText()
+	if string(text) != "100" {
+		t.Errorf("TCPState(100).MarshalText() = %q, want \"100\"", text)
+	}
+
+	var s TCPState
+	if err := s.UnmarshalText([]byte("ESTABLISHED ")); !errors.Is(err, ErrUnknownState) {
+		t.Errorf("UnmarshalText(bad) error = %v, want ErrUnknownState", err)
+	}
+
+	// Имена в конфигурации вместо чисел
+	var cfg struct {
+		Timeouts map[TCPState]string `json:"timeouts"`
+		Events   []TCPEvent          `json:"events"`
+	}
+	data := `{"timeouts":{"TIME_WAIT":"1m","SYN_SENT":"75s"},"events":["ACTIVE_OPEN","SYN_ACK"]}`
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if cfg.Timeouts[TIME_WAIT] != "1m" || cfg.Timeouts[SYN_SENT] != "75s" {
+		t.Errorf("Timeouts = %v", cfg.Timeouts)
+	}
+	if !reflect.DeepEqual(cfg.Events, []TCPEvent{ACTIVE_OPEN, SYN_ACK}) {
+		t.Errorf("Events = %v", cfg.Events)
+	}
+	out, _ := json.Marshal(cfg)
+	if !strings.Contains(string(out), `"TIME_WAIT":"1m"`) || !strings.Contains(string(out), `"SYN_ACK"`) {
+		t.Errorf("json.Marshal() = %s, want names", out)
+	}
+}
+
+func TestTCPEvent_TextMarshal(t *testing.T) {
+	for e := PASSIVE_OPEN; e <= SEND; e++ {
+		text, _ := e.MarshalText()
+		var got TCPEvent
+		if err := got.UnmarshalText(text); err != nil || got != e {
+			t.Errorf("round trip %v = %v, %v", e, got, err)
+		}
+	}
+	if _, err := ParseTCPEvent("NOPE"); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("ParseTCPEvent(NOPE) error = %v, want ErrUnknownEvent", err)
+	}
+}
+
+// newEncodedMachine возвращает машину в ESTABLISHED с историей и метаданными
+func newEncodedMachine() *TCPStateMachine {
+	sm := NewTCPStateMachine()
+	sm.SetClock(NewManualClock(time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)))
+	sm.SetHistorySize(10)
+	sm.ProcessEventWithMeta(PASSIVE_OPEN, TransitionMeta{Reason: "listen"})
+	sm.ProcessEventWithMeta(SYN, TransitionMeta{Seq: 100, Packet: "SYN seq=100"})
+	sm.ProcessEventWithMeta(ACK, TransitionMeta{Seq: 101, Ack: 501})
+	return sm
+}
+
+func assertRestored(t *testing.T, got, want *TCPStateMachine) {
+	t.Helper()
+	if got.GetState() != want.GetState() {
+		t.Errorf("state = %v, want %v", got.GetState(), want.GetState())
+	}
+	if got.Origin() != want.Origin() {
+		t.Errorf("origin = %v, want %v", got.Origin(), want.Origin())
+	}
+	if got.HistorySize() != want.HistorySize() {
+		t.Errorf("HistorySize() = %d, want %d", got.HistorySize(), want.HistorySize())
+	}
+	gh, wh := got.GetHistory(), want.GetHistory()
+	if len(gh) != len(wh) {
+		t.Fatalf("len(history) = %d, want %d", len(gh), len(wh))
+	}
+	for i := range wh {
+		if gh[i].FromState != wh[i].FromState || gh[i].ToState != wh[i].ToState ||
+			gh[i].Event != wh[i].Event || gh[i].Meta != wh[i].Meta || !gh[i].Time.Equal(wh[i].Time) {
+			t.Errorf("history[%d] = %v, want %v", i, gh[i], wh[i])
+		}
+	}
+}
+
+func TestTCPStateMachine_JSON(t *testing.T) {
+	sm := newEncodedMachine()
+
+	data, err := json.Marshal(sm)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	for _, want := range []string{`"machine":"rfc9293"`, `"state":"ESTABLISHED"`, `"origin":"PASSIVE"`, `"event":"SYN"`, `"reason":"listen"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON %s missing %s", data, want)
+		}
+	}
+
+	// Нулевая машина берет таблицу из реестра
+	var restored TCPStateMachine
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	assertRestored(t, &restored, sm)
+
+	// Восстановленная машина продолжает работу по правилам таблицы
+	if err := restored.ProcessEvent(RST); err != nil || restored.GetState() != CLOSED {
+		t.Errorf("RST after restore = %v, %v", restored.GetState(), err)
+	}
+}
+
+func TestTCPStateMachine_JSONCustomMachine(t *testing.T) {
+	sm := NewTCPStateMachineFromTable(newQUICTable("quic-encoding"))
+	sm.ProcessEvent(quicStart)
+	sm.ProcessEvent(quicHandshakeDone)
+
+	data, err := json.Marshal(sm)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(data), `"state":"ACTIVE"`) || !strings.Contains(string(data), `"event":"HANDSHAKE_DONE"`) {
+		t.Errorf("JSON %s, want table names", data)
+	}
+
+	restored := NewTCPStateMachineFromTable(newQUICTable("quic-encoding"))
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	assertRestored(t, restored, sm)
+
+	// Незарегистрированная таблица не восстанавливается в нулевую машину
+	var zero TCPStateMachine
+	if err := json.Unmarshal(data, &zero); !errors.Is(err, ErrUnknownMachine) {
+		t.Errorf("json.Unmarshal() into zero machine error = %v, want ErrUnknownMachine", err)
+	}
+	// Снимок другой машины отклоняется
+	if err := json.Unmarshal(data, NewTCPStateMachine()); err == nil {
+		t.Error("json.Unmarshal() into rfc9293 machine succeeded")
+	}
+}
+
+func TestTCPStateMachine_Binary(t *testing.T) {
+	sm := newEncodedMachine()
+
+	data, err := sm.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	var restored TCPStateMachine
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	assertRestored(t, &restored, sm)
+
+	// Любое усечение обнаруживается
+	for i := 0; i < len(data); i++ {
+		if err := new(TCPStateMachine).UnmarshalBinary(data[:i]); !errors.Is(err, ErrCorruptStateMachine) {
+			t.Fatalf("UnmarshalBinary(data[:%d]) error = %v, want ErrCorruptStateMachine", i, err)
+		}
+	}
+	if err := restored.UnmarshalBinary(append(data, 0)); !errors.Is(err, ErrCorruptStateMachine) {
+		t.Errorf("UnmarshalBinary(trailing) error = %v, want ErrCorruptStateMachine", err)
+	}
+}
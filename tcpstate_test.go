@@ -1,7 +1,12 @@
 package tcpconn
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewTCPStateMachine(t *testing.T) {
@@ -59,6 +64,7 @@ func TestTCPEvent_String(t *testing.T) {
 		{CLOSE, "CLOSE"},
 		{TIMEOUT, "TIMEOUT"},
 		{RST, "RST"},
+		{SEND, "SEND"},
 	}
 
 	for _, tt := range tests {
@@ -275,6 +281,21 @@ func TestTCPStateMachine_InvalidTransition(t *testing.T) {
 	if sm.GetState() != CLOSED {
 		t.Errorf("GetState() = %v, want CLOSED after invalid transition", sm.GetState())
 	}
+
+	// RST в CLOSED и LISTEN отклоняется без смены состояния
+	for _, setup := range [][]TCPEvent{nil, {PASSIVE_OPEN}} {
+		sm := NewTCPStateMachine()
+		for _, e := range setup {
+			sm.ProcessEvent(e)
+		}
+		state := sm.GetState()
+		if err := sm.ProcessEvent(RST); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("ProcessEvent(RST) in %v error = %v, want ErrInvalidTransition", state, err)
+		}
+		if sm.GetState() != state {
+			t.Errorf("GetState() after RST = %v, want %v", sm.GetState(), state)
+		}
+	}
 }
 
 func TestTCPStateMachine_Callbacks(t *testing.T) {
@@ -487,6 +508,191 @@ func TestTCPStateMachine_FINandACK(t *testing.T) {
 	}
 }
 
+func TestTCPStateMachine_ZeroValue(t *testing.T) {
+	var sm TCPStateMachine
+
+	// Нулевая машина работает по таблице RFC 9293
+	if err := sm.ProcessEvent(ACTIVE_OPEN); err != nil {
+		t.Fatalf("ProcessEvent(ACTIVE_OPEN) error = %v", err)
+	}
+	if sm.GetState() != SYN_SENT {
+		t.Errorf("GetState() = %v, want SYN_SENT", sm.GetState())
+	}
+	if sm.Origin() != OriginActive {
+		t.Errorf("Origin() = %v, want OriginActive", sm.Origin())
+	}
+	if name := sm.Table().Name(); name != DefaultMachine {
+		t.Errorf("Table().Name() = %q, want %q", name, DefaultMachine)
+	}
+
+	if _, err := json.Marshal(&sm); err != nil {
+		t.Errorf("json.Marshal() error = %v", err)
+	}
+	if _, err := sm.MarshalBinary(); err != nil {
+		t.Errorf("MarshalBinary() error = %v", err)
+	}
+
+	sm.Reset()
+	if sm.GetState() != CLOSED {
+		t.Errorf("GetState() after Reset = %v, want CLOSED", sm.GetState())
+	}
+}
+
+func newTimedMachine(timeouts map[TCPState]time.Duration) (*TCPStateMachine, *ManualClock, *TimerDriver) {
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	sm := NewTCPStateMachine()
+	sm.SetClock(clock)
+	return sm, clock, sm.StartTimers(timeouts)
+}
+
+func TestTimerDriver_HandshakeTimeout(t *testing.T) {
+	sm, clock, d := newTimedMachine(map[TCPState]time.Duration{SYN_SENT: 5 * time.Second})
+	defer d.Stop()
+	start := clock.Now()
+
+	sm.ProcessEvent(ACTIVE_OPEN)
+	if deadline, ok := d.Deadline(); !ok || !deadline.Equal(start.Add(5*time.Second)) {
+		t.Errorf("Deadline() = %v, %v; want %v", deadline, ok, start.Add(5*time.Second))
+	}
+
+	clock.Advance(4 * time.Second)
+	if sm.GetState() != SYN_SENT {
+		t.Fatalf("GetState() after 4s = %v, want SYN_SENT", sm.GetState())
+	}
+
+	clock.Advance(time.Second)
+	if sm.GetState() != CLOSED {
+		t.Fatalf("GetState() after 5s = %v, want CLOSED", sm.GetState())
+	}
+
+	last := sm.GetHistory()[1]
+	if last.Event != TIMEOUT || !last.Time.Equal(start.Add(5*time.Second)) {
+		t.Errorf("timeout transition = %v, want TIMEOUT at %v", last, start.Add(5*time.Second))
+	}
+	if !strings.Contains(last.Meta.Reason, "SYN_SENT timeout") {
+		t.Errorf("Meta.Reason = %q", last.Meta.Reason)
+	}
+	if _, ok := d.Deadline(); ok || clock.Pending() != 0 {
+		t.Errorf("timer still armed in CLOSED: pending %d", clock.Pending())
+	}
+}
+
+func TestTimerDriver_TransitionCancelsTimer(t *testing.T) {
+	sm, clock, d := newTimedMachine(nil)
+	defer d.Stop()
+
+	sm.ProcessEvent(ACTIVE_OPEN)
+	clock.Advance(time.Second)
+	sm.ProcessEvent(SYN_ACK)
+
+	clock.Advance(time.Hour)
+	if sm.GetState() != ESTABLISHED {
+		t.Errorf("GetState() = %v, want ESTABLISHED", sm.GetState())
+	}
+	if clock.Pending() != 0 {
+		t.Errorf("Pending() = %d, want 0", clock.Pending())
+	}
+}
+
+func TestTimerDriver_TimeWaitRestart(t *testing.T) {
+	sm, clock, d := newTimedMachine(nil)
+	defer d.Stop()
+
+	for _, e := range []TCPEvent{ACTIVE_OPEN, SYN_ACK, CLOSE, ACK, FIN} {
+		sm.ProcessEvent(e)
+	}
+	if sm.GetState() != TIME_WAIT {
+		t.Fatalf("GetState() = %v, want TIME_WAIT", sm.GetState())
+	}
+
+	// Повторный FIN перезапускает 2*MSL
+	clock.Advance(2*DefaultMSL - time.Second)
+	sm.ProcessEvent(FIN)
+	clock.Advance(2*DefaultMSL - time.Second)
+	if sm.GetState() != TIME_WAIT {
+		t.Fatalf("GetState() = %v, want TIME_WAIT after restart", sm.GetState())
+	}
+	clock.Advance(time.Second)
+	if sm.GetState() != CLOSED {
+		t.Errorf("GetState() = %v, want CLOSED after 2MSL", sm.GetState())
+	}
+}
+
+func TestTimerDriver_SetTimeoutAndStop(t *testing.T) {
+	sm, clock, d := newTimedMachine(map[TCPState]time.Duration{})
+
+	sm.ProcessEvent(PASSIVE_OPEN)
+	sm.ProcessEvent(SYN)
+	clock.Advance(time.Hour)
+	if sm.GetState() != SYN_RECEIVED {
+		t.Fatalf("GetState() = %v, want SYN_RECEIVED without timeouts", sm.GetState())
+	}
+
+	// Новый таймаут текущего состояния отсчитывается от момента вызова
+	d.SetTimeout(SYN_RECEIVED, 3*time.Second)
+	if got := d.Timeouts()[SYN_RECEIVED]; got != 3*time.Second {
+		t.Errorf("Timeouts()[SYN_RECEIVED] = %v, want 3s", got)
+	}
+	clock.Advance(3 * time.Second)
+	if sm.GetState() != CLOSED {
+		t.Fatalf("GetState() = %v, want CLOSED", sm.GetState())
+	}
+
+	d.SetTimeout(SYN_SENT, time.Second)
+	d.Stop()
+	d.Stop()
+	sm.ProcessEvent(ACTIVE_OPEN)
+	clock.Advance(time.Minute)
+	if sm.GetState() != SYN_SENT {
+		t.Errorf("GetState() = %v, want SYN_SENT after Stop", sm.GetState())
+	}
+}
+
+func TestTimerDriver_Run(t *testing.T) {
+	sm, clock, d := newTimedMachine(map[TCPState]time.Duration{SYN_SENT: time.Second})
+	defer d.Stop()
+
+	events := make(chan TCPEvent, 2)
+	events <- ACTIVE_OPEN
+	close(events)
+	if err := d.Run(context.Background(), events); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if sm.GetState() != SYN_SENT {
+		t.Fatalf("GetState() = %v, want SYN_SENT", sm.GetState())
+	}
+	clock.Advance(time.Second)
+	if sm.GetState() != CLOSED {
+		t.Errorf("GetState() = %v, want CLOSED", sm.GetState())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.Run(ctx, make(chan TCPEvent)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run(canceled) = %v, want context.Canceled", err)
+	}
+}
+
+func TestTimerDriver_SystemClock(t *testing.T) {
+	sm := NewTCPStateMachine()
+	d := sm.StartTimers(map[TCPState]time.Duration{SYN_SENT: 10 * time.Millisecond})
+	defer d.Stop()
+
+	done := make(chan struct{})
+	sm.SetStateChangeCallback(func(oldState, newState TCPState, event TCPEvent) {
+		if event == TIMEOUT {
+			close(done)
+		}
+	})
+	sm.ProcessEvent(ACTIVE_OPEN)
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("TIMEOUT not delivered")
+	}
+}
+
 func BenchmarkTCPStateMachine_ProcessEvent(b *testing.B) {
 	sm := NewTCPStateMachine()
 
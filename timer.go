@@ -0,0 +1,166 @@
+package tcpconn
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+)
+
+// DefaultMSL - максимальное время жизни сегмента; TIME_WAIT длится 2*MSL
+const DefaultMSL = 30 * time.Second
+
+// DefaultStateTimeouts возвращает таймауты состояний по умолчанию:
+// установление соединения, ожидание FIN собеседника, последний ACK и 2*MSL.
+func DefaultStateTimeouts() map[TCPState]time.Duration {
+	return map[TCPState]time.Duration{
+		SYN_SENT:     75 * time.Second,
+		SYN_RECEIVED: 75 * time.Second,
+		FIN_WAIT_2:   60 * time.Second,
+		LAST_ACK:     60 * time.Second,
+		TIME_WAIT:    2 * DefaultMSL,
+	}
+}
+
+// TimerDriver взводит таймаут при каждом переходе машины и подает TIMEOUT,
+// если машина задержалась в состоянии дольше заданного. Переход в то же
+// состояние (например, повторный FIN в TIME_WAIT) перезапускает таймер.
+type TimerDriver struct {
+	sm     *TCPStateMachine
+	clock  Clock
+	remove func()
+
+	mu       sync.Mutex
+	timeouts map[TCPState]time.Duration
+	timer    Timer
+	state    TCPState  // состояние, для которого взведен таймер
+	deadline time.Time // нулевое, если таймер не взведен
+	gen      uint64
+	stopped  bool
+}
+
+// StartTimers запускает драйвер таймаутов с часами машины (SetClock).
+// timeouts == nil означает DefaultStateTimeouts; состояния без таймаута
+// или с нулевым таймаутом не ограничены по времени.
+func (sm *TCPStateMachine) StartTimers(timeouts map[TCPState]time.Duration) *TimerDriver {
+	if timeouts == nil {
+		timeouts = DefaultStateTimeouts()
+	}
+	d := &TimerDriver{
+		sm:       sm,
+		clock:    sm.Clock(),
+		timeouts: maps.Clone(timeouts),
+	}
+
+	// Наблюдатель регистрируется раньше чтения состояния, чтобы не пропустить переход
+	d.remove = sm.AddObserver(func(t StateTransition) {
+		d.arm(t.ToState)
+	})
+	d.arm(sm.GetState())
+	return d
+}
+
+// arm перезапускает таймер для состояния state
+func (d *TimerDriver) arm(state TCPState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.gen++
+	d.state = state
+	d.deadline = time.Time{}
+
+	timeout := d.timeouts[state]
+	if timeout <= 0 {
+		return
+	}
+	gen := d.gen
+	d.deadline = d.clock.Now().Add(timeout)
+	d.timer = d.clock.AfterFunc(timeout, func() {
+		d.fire(gen, state, timeout)
+	})
+}
+
+// fire подает TIMEOUT, если таймер еще актуален и машина все еще в state
+func (d *TimerDriver) fire(gen uint64, state TCPState, timeout time.Duration) {
+	d.mu.Lock()
+	if d.stopped || gen != d.gen {
+		d.mu.Unlock()
+		return
+	}
+	d.timer = nil
+	d.deadline = time.Time{}
+	d.mu.Unlock()
+
+	meta := TransitionMeta{Reason: fmt.Sprintf("%s timeout after %s", state, timeout)}
+	d.sm.processIf(state, TIMEOUT, meta)
+}
+
+// SetTimeout задает таймаут состояния; 0 снимает ограничение.
+// Если машина сейчас в этом состоянии, таймер перезапускается от текущего момента.
+func (d *TimerDriver) SetTimeout(state TCPState, timeout time.Duration) {
+	d.mu.Lock()
+	d.timeouts[state] = timeout
+	current := d.state == state && !d.stopped
+	d.mu.Unlock()
+
+	if current {
+		d.arm(state)
+	}
+}
+
+// Timeouts возвращает копию таймаутов драйвера
+func (d *TimerDriver) Timeouts() map[TCPState]time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return maps.Clone(d.timeouts)
+}
+
+// Deadline возвращает момент ближайшего TIMEOUT; false, если таймер не взведен
+func (d *TimerDriver) Deadline() (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.deadline, !d.deadline.IsZero()
+}
+
+// Run подает события из events в машину по одному, пока канал не закрыт или
+// ctx не отменен; TIMEOUT по-прежнему подают таймеры драйвера. Ошибки
+// переходов сообщаются через SetErrorCallback. Возвращает ctx.Err() при отмене.
+func (d *TimerDriver) Run(ctx context.Context, events <-chan TCPEvent) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			d.sm.ProcessEventCtx(ctx, event)
+		}
+	}
+}
+
+// Stop останавливает драйвер и отменяет взведенный таймер. Повторный вызов безопасен.
+func (d *TimerDriver) Stop() {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	d.stopped = true
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.deadline = time.Time{}
+	d.mu.Unlock()
+
+	d.remove()
+}
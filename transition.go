@@ -0,0 +1,453 @@
+package tcpconn
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrTransitionRejected возвращается, когда все подходящие строки таблицы отклонены охранными условиями
+	ErrTransitionRejected = errors.New("transition rejected by guard")
+	// ErrMachineExists возвращается при повторной регистрации машины с тем же именем
+	ErrMachineExists = errors.New("state machine already registered")
+	// ErrUnknownMachine возвращается, если машина с таким именем не зарегистрирована
+	ErrUnknownMachine = errors.New("unknown state machine")
+)
+
+// AnyState в поле From строки таблицы означает «из любого состояния».
+// Строки с конкретным From проверяются раньше строк с AnyState.
+const AnyState TCPState = -1
+
+// DefaultMachine - имя машины RFC 9293 в реестре
+const DefaultMachine = "rfc9293"
+
+// TransitionContext описывает переход для охранных условий и действий
+type TransitionContext struct {
+	From  TCPState
+	To    TCPState
+	Event TCPEvent
+	// Origin - происхождение соединения на момент начала перехода
+	Origin Origin
+	// Value - пользовательские данные машины (см. SetValue)
+	Value any
+}
+
+// Guard разрешает или запрещает переход.
+// Вызывается под блокировкой машины и не должен вызывать её методы.
+type Guard func(ctx TransitionContext) bool
+
+// Action выполняется при переходе: как действие строки таблицы или как
+// действие входа/выхода из состояния. Вызывается под блокировкой машины.
+type Action func(ctx TransitionContext)
+
+// Transition - строка таблицы переходов: состояние × событие → новое состояние
+type Transition struct {
+	From  TCPState
+	Event TCPEvent
+	To    TCPState
+	// Guard - необязательное условие; при false проверяется следующая строка
+	Guard Guard
+	// Action - необязательное действие, выполняется между выходом и входом
+	Action Action
+	// Origin - если не OriginNone, переход задает происхождение соединения.
+	// При возврате в начальное состояние происхождение сбрасывается.
+	Origin Origin
+	// Description - пояснение для документации
+	Description string
+}
+
+// transitionKey индексирует строки таблицы
+type transitionKey struct {
+	from  TCPState
+	event TCPEvent
+}
+
+// transitionStep - найденная строка вместе с действиями выхода и входа
+type transitionStep struct {
+	row   Transition
+	exit  Action
+	enter Action
+}
+
+// TransitionTable - декларативное описание машины состояний:
+// строки переходов, начальное состояние, действия входа и выхода и
+// имена пользовательских состояний и событий.
+//
+// Таблица безопасна для конкурентного использования; изменения сразу
+// видны всем машинам, созданным по ней.
+type TransitionTable struct {
+	mu      sync.RWMutex
+	name    string
+	initial TCPState
+	rows    []Transition
+	index   map[transitionKey][]int
+	onEnter map[TCPState]Action
+	onExit  map[TCPState]Action
+	states  map[TCPState]string
+	events  map[TCPEvent]string
+}
+
+// NewTransitionTable создает пустую таблицу с начальным состоянием initial
+func NewTransitionTable(name string, initial TCPState) *TransitionTable {
+	return &TransitionTable{
+		name:    name,
+		initial: initial,
+		index:   make(map[transitionKey][]int),
+		onEnter: make(map[TCPState]Action),
+		onExit:  make(map[TCPState]Action),
+		states:  make(map[TCPState]string),
+		events:  make(map[TCPEvent]string),
+	}
+}
+
+// Name возвращает имя таблицы
+func (t *TransitionTable) Name() string {
+	return t.name
+}
+
+// Initial возвращает начальное состояние
+func (t *TransitionTable) Initial() TCPState {
+	return t.initial
+}
+
+// Add добавляет строки в таблицу. Для одной пары (состояние, событие)
+// допускается несколько строк: выбирается первая, чье условие выполнено.
+func (t *TransitionTable) Add(rows ...Transition) *TransitionTable {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, row := range rows {
+		key := transitionKey{row.From, row.Event}
+		t.index[key] = append(t.index[key], len(t.rows))
+		t.rows = append(t.rows, row)
+	}
+	return t
+}
+
+// OnEnter устанавливает действие при входе в состояние
+func (t *TransitionTable) OnEnter(state TCPState, action Action) *TransitionTable {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onEnter[state] = action
+	return t
+}
+
+// OnExit устанавливает действие при выходе из состояния
+func (t *TransitionTable) OnExit(state TCPState, action Action) *TransitionTable {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onExit[state] = action
+	return t
+}
+
+// NameState задает имя пользовательского состояния для документации и ошибок
+func (t *TransitionTable) NameState(state TCPState, name string) *TransitionTable {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.states[state] = name
+	return t
+}
+
+// NameEvent задает имя пользовательского события для документации и ошибок
+func (t *TransitionTable) NameEvent(event TCPEvent, name string) *TransitionTable {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events[event] = name
+	return t
+}
+
+// StateName возвращает имя состояния с учетом NameState
+func (t *TransitionTable) StateName(state TCPState) string {
+	if state == AnyState {
+		return "*"
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if name, ok := t.states[state]; ok {
+		return name
+	}
+	return state.String()
+}
+
+// EventName возвращает имя события с учетом NameEvent
+func (t *TransitionTable) EventName(event TCPEvent) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if name, ok := t.events[event]; ok {
+		return name
+	}
+	return event.String()
+}
+
+// Transitions возвращает копию строк таблицы в порядке добавления
+func (t *TransitionTable) Transitions() []Transition {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Clone(t.rows)
+}
+
+// States возвращает все состояния таблицы по возрастанию
+func (t *TransitionTable) States() []TCPState {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	seen := map[TCPState]bool{t.initial: true}
+	for _, row := range t.rows {
+		seen[row.From] = true
+		seen[row.To] = true
+	}
+	for state := range t.states {
+		seen[state] = true
+	}
+	delete(seen, AnyState)
+
+	states := make([]TCPState, 0, len(seen))
+	for state := range seen {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+	return states
+}
+
+// Events возвращает все события таблицы по возрастанию
+func (t *TransitionTable) Events() []TCPEvent {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	seen := make(map[TCPEvent]bool)
+	for _, row := range t.rows {
+		seen[row.Event] = true
+	}
+	for event := range t.events {
+		seen[event] = true
+	}
+
+	events := make([]TCPEvent, 0, len(seen))
+	for event := range seen {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+	return events
+}
+
+// Clone возвращает независимую копию таблицы под новым именем
+func (t *TransitionTable) Clone(name string) *TransitionTable {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	c := NewTransitionTable(name, t.initial)
+	c.rows = slices.Clone(t.rows)
+	for key, idx := range t.index {
+		c.index[key] = slices.Clone(idx)
+	}
+	for state, action := range t.onEnter {
+		c.onEnter[state] = action
+	}
+	for state, action := range t.onExit {
+		c.onExit[state] = action
+	}
+	for state, name := range t.states {
+		c.states[state] = name
+	}
+	for event, name := range t.events {
+		c.events[event] = name
+	}
+	return c
+}
+
+// resolve находит строку для пары (состояние, событие) с учетом условий
+func (t *TransitionTable) resolve(from TCPState, event TCPEvent, origin Origin, value any) (transitionStep, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	matched := false
+	for _, key := range [2]transitionKey{{from, event}, {AnyState, event}} {
+		for _, i := range t.index[key] {
+			row := t.rows[i]
+			matched = true
+			if row.Guard != nil && !row.Guard(TransitionContext{From: from, To: row.To, Event: event, Origin: origin, Value: value}) {
+				continue
+			}
+			row.From = from
+			return transitionStep{row: row, exit: t.onExit[from], enter: t.onEnter[row.To]}, nil
+		}
+	}
+
+	fromName, eventName := t.states[from], t.events[event]
+	if fromName == "" {
+		fromName = from.String()
+	}
+	if eventName == "" {
+		eventName = event.String()
+	}
+	if matched {
+		return transitionStep{}, fmt.Errorf("%w: %w: cannot transition from %s on event %s",
+			ErrInvalidTransition, ErrTransitionRejected, fromName, eventName)
+	}
+	return transitionStep{}, fmt.Errorf("%w: cannot transition from %s on event %s",
+		ErrInvalidTransition, fromName, eventName)
+}
+
+// WriteMarkdown выводит таблицу переходов в формате Markdown
+func (t *TransitionTable) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "| From | Event | To | Guard | Description |\n")
+	fmt.Fprintf(&b, "|------|-------|----|-------|-------------|\n")
+	for _, row := range t.Transitions() {
+		guard := ""
+		if row.Guard != nil {
+			guard = "yes"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n",
+			t.StateName(row.From), t.EventName(row.Event), t.StateName(row.To), guard, row.Description)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// DefaultTransitionTable возвращает копию таблицы RFC 9293, по которой
+// работает NewTCPStateMachine. Копию можно дополнять и регистрировать
+// под другим именем, не затрагивая машину по умолчанию.
+func DefaultTransitionTable() *TransitionTable {
+	return rfc9293Table.Clone(DefaultMachine)
+}
+
+// rfc9293Table - таблица машины состояний по умолчанию
+var rfc9293Table = newRFC9293Table()
+
+// passiveOrigin разрешает переход только для пассивно открытых соединений
+func passiveOrigin(ctx TransitionContext) bool {
+	return ctx.Origin == OriginPassive
+}
+
+// newRFC9293Table строит таблицу переходов по RFC 9293 (уточненному RFC 793).
+// Строк для RST в CLOSED и LISTEN нет: RFC предписывает игнорировать такой
+// сегмент (3.10.7.1, 3.10.7.2), и машина отклоняет событие ошибкой перехода,
+// не меняя состояния. TIMEOUT из любого синхронизированного состояния -
+// истечение пользовательского таймаута (3.10.8).
+func newRFC9293Table() *TransitionTable {
+	return NewTransitionTable(DefaultMachine, CLOSED).Add(
+		Transition{From: CLOSED, Event: PASSIVE_OPEN, To: LISTEN, Origin: OriginPassive, Description: "passive open"},
+		Transition{From: CLOSED, Event: ACTIVE_OPEN, To: SYN_SENT, Origin: OriginActive, Description: "active open, send SYN"},
+
+		Transition{From: LISTEN, Event: SYN, To: SYN_RECEIVED, Description: "receive SYN, send SYN-ACK"},
+		Transition{From: LISTEN, Event: SEND, To: SYN_SENT, Origin: OriginActive, Description: "send SYN, become active"},
+		Transition{From: LISTEN, Event: CLOSE, To: CLOSED, Description: "close listener"},
+
+		Transition{From: SYN_SENT, Event: SYN_ACK, To: ESTABLISHED, Description: "receive SYN-ACK, send ACK"},
+		Transition{From: SYN_SENT, Event: SYN, To: SYN_RECEIVED, Description: "simultaneous open, send SYN-ACK"},
+		Transition{From: SYN_SENT, Event: CLOSE, To: CLOSED, Description: "abort connect"},
+		Transition{From: SYN_SENT, Event: TIMEOUT, To: CLOSED, Description: "connect timeout"},
+		Transition{From: SYN_SENT, Event: RST, To: CLOSED, Description: "connection refused"},
+
+		Transition{From: SYN_RECEIVED, Event: ACK, To: ESTABLISHED, Description: "handshake complete"},
+		Transition{From: SYN_RECEIVED, Event: FIN, To: CLOSE_WAIT, Description: "receive FIN, send ACK"},
+		Transition{From: SYN_RECEIVED, Event: FIN_ACK, To: CLOSE_WAIT, Description: "handshake complete with FIN"},
+		Transition{From: SYN_RECEIVED, Event: CLOSE, To: FIN_WAIT_1, Description: "close, send FIN"},
+		Transition{From: SYN_RECEIVED, Event: TIMEOUT, To: CLOSED, Description: "handshake timeout"},
+		Transition{From: SYN_RECEIVED, Event: RST, To: LISTEN, Guard: passiveOrigin, Description: "reset of passive open, back to listen"},
+		Transition{From: SYN_RECEIVED, Event: RST, To: CLOSED, Description: "reset of active open"},
+
+		Transition{From: ESTABLISHED, Event: FIN, To: CLOSE_WAIT, Description: "receive FIN, send ACK"},
+		Transition{From: ESTABLISHED, Event: FIN_ACK, To: CLOSE_WAIT, Description: "receive FIN with data ACK"},
+		Transition{From: ESTABLISHED, Event: CLOSE, To: FIN_WAIT_1, Description: "close, send FIN"},
+		Transition{From: ESTABLISHED, Event: TIMEOUT, To: CLOSED, Description: "user timeout"},
+		Transition{From: ESTABLISHED, Event: RST, To: CLOSED, Description: "connection reset"},
+
+		Transition{From: FIN_WAIT_1, Event: FIN, To: CLOSING, Description: "simultaneous close, send ACK"},
+		Transition{From: FIN_WAIT_1, Event: ACK, To: FIN_WAIT_2, Description: "FIN acknowledged"},
+		Transition{From: FIN_WAIT_1, Event: FIN_ACK, To: TIME_WAIT, Description: "FIN acknowledged with peer FIN"},
+		Transition{From: FIN_WAIT_1, Event: TIMEOUT, To: CLOSED, Description: "user timeout"},
+		Transition{From: FIN_WAIT_1, Event: RST, To: CLOSED, Description: "connection reset"},
+
+		Transition{From: FIN_WAIT_2, Event: FIN, To: TIME_WAIT, Description: "receive FIN, send ACK"},
+		Transition{From: FIN_WAIT_2, Event: FIN_ACK, To: TIME_WAIT, Description: "receive FIN with data ACK"},
+		Transition{From: FIN_WAIT_2, Event: TIMEOUT, To: CLOSED, Description: "FIN_WAIT_2 timeout"},
+		Transition{From: FIN_WAIT_2, Event: RST, To: CLOSED, Description: "connection reset"},
+
+		Transition{From: CLOSE_WAIT, Event: CLOSE, To: LAST_ACK, Description: "close, send FIN"},
+		Transition{From: CLOSE_WAIT, Event: FIN, To: CLOSE_WAIT, Description: "retransmitted FIN"},
+		Transition{From: CLOSE_WAIT, Event: TIMEOUT, To: CLOSED, Description: "user timeout"},
+		Transition{From: CLOSE_WAIT, Event: RST, To: CLOSED, Description: "connection reset"},
+
+		Transition{From: CLOSING, Event: ACK, To: TIME_WAIT, Description: "FIN acknowledged"},
+		Transition{From: CLOSING, Event: FIN_ACK, To: TIME_WAIT, Description: "FIN acknowledged with retransmitted FIN"},
+		Transition{From: CLOSING, Event: FIN, To: CLOSING, Description: "retransmitted FIN"},
+		Transition{From: CLOSING, Event: TIMEOUT, To: CLOSED, Description: "user timeout"},
+		Transition{From: CLOSING, Event: RST, To: CLOSED, Description: "connection reset"},
+
+		Transition{From: LAST_ACK, Event: ACK, To: CLOSED, Description: "FIN acknowledged"},
+		Transition{From: LAST_ACK, Event: FIN_ACK, To: CLOSED, Description: "FIN acknowledged with retransmitted FIN"},
+		Transition{From: LAST_ACK, Event: FIN, To: LAST_ACK, Description: "retransmitted FIN"},
+		Transition{From: LAST_ACK, Event: TIMEOUT, To: CLOSED, Description: "FIN retransmission timeout"},
+		Transition{From: LAST_ACK, Event: RST, To: CLOSED, Description: "connection reset"},
+
+		Transition{From: TIME_WAIT, Event: TIMEOUT, To: CLOSED, Description: "2MSL timeout"},
+		Transition{From: TIME_WAIT, Event: FIN, To: TIME_WAIT, Description: "retransmitted FIN, restart 2MSL"},
+		Transition{From: TIME_WAIT, Event: RST, To: CLOSED, Description: "connection reset"},
+	)
+}
+
+// machines - реестр именованных таблиц. Зарегистрированные таблицы наружу
+// не выдаются, поэтому их нельзя изменить после регистрации.
+var machines = struct {
+	sync.RWMutex
+	tables map[string]*TransitionTable
+}{tables: map[string]*TransitionTable{DefaultMachine: rfc9293Table}}
+
+// RegisterMachine регистрирует копию таблицы под ее именем.
+// Последующие изменения table на зарегистрированную машину не влияют.
+func RegisterMachine(table *TransitionTable) error {
+	registered := table.Clone(table.name)
+
+	machines.Lock()
+	defer machines.Unlock()
+	if _, ok := machines.tables[table.name]; ok {
+		return fmt.Errorf("%w: %s", ErrMachineExists, table.name)
+	}
+	machines.tables[table.name] = registered
+	return nil
+}
+
+// LookupMachine возвращает копию зарегистрированной таблицы по имени.
+// Изменения копии не затрагивают реестр и созданные по нему машины.
+func LookupMachine(name string) (*TransitionTable, bool) {
+	table, ok := lookupMachine(name)
+	if !ok {
+		return nil, false
+	}
+	return table.Clone(name), true
+}
+
+// lookupMachine возвращает саму зарегистрированную таблицу для машин реестра
+func lookupMachine(name string) (*TransitionTable, bool) {
+	machines.RLock()
+	defer machines.RUnlock()
+	table, ok := machines.tables[name]
+	return table, ok
+}
+
+// RegisteredMachines возвращает имена зарегистрированных машин по алфавиту
+func RegisteredMachines() []string {
+	machines.RLock()
+	defer machines.RUnlock()
+	names := make([]string, 0, len(machines.tables))
+	for name := range machines.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewStateMachine создает машину состояний по зарегистрированной таблице
+func NewStateMachine(name string) (*TCPStateMachine, error) {
+	table, ok := lookupMachine(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMachine, name)
+	}
+	return NewTCPStateMachineFromTable(table), nil
+}
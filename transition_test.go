@@ -0,0 +1,327 @@
+package tcpconn
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Упрощенный жизненный цикл в духе QUIC для проверки пользовательских машин
+const (
+	quicIdle TCPState = 100 + iota
+	quicHandshake
+	quicActive
+	quicDraining
+)
+
+const (
+	quicStart TCPEvent = 100 + iota
+	quicHandshakeDone
+	quicClose
+	quicIdleTimeout
+)
+
+func newQUICTable(name string) *TransitionTable {
+	return NewTransitionTable(name, quicIdle).
+		NameState(quicIdle, "IDLE").
+		NameState(quicHandshake, "HANDSHAKE").
+		NameState(quicActive, "ACTIVE").
+		NameState(quicDraining, "DRAINING").
+		NameEvent(quicStart, "START").
+		NameEvent(quicHandshakeDone, "HANDSHAKE_DONE").
+		NameEvent(quicClose, "CLOSE").
+		NameEvent(quicIdleTimeout, "IDLE_TIMEOUT").
+		Add(
+			Transition{From: quicIdle, Event: quicStart, To: quicHandshake},
+			Transition{From: quicHandshake, Event: quicHandshakeDone, To: quicActive},
+			Transition{From: quicActive, Event: quicClose, To: quicDraining},
+			Transition{From: AnyState, Event: quicIdleTimeout, To: quicIdle},
+		)
+}
+
+// rfc9293Legal - все допустимые переходы машины по умолчанию.
+// RST из SYN_RECEIVED зависит от происхождения и проверяется отдельно.
+var rfc9293Legal = map[TCPState]map[TCPEvent]TCPState{
+	CLOSED:       {PASSIVE_OPEN: LISTEN, ACTIVE_OPEN: SYN_SENT},
+	LISTEN:       {SYN: SYN_RECEIVED, SEND: SYN_SENT, CLOSE: CLOSED},
+	SYN_SENT:     {SYN_ACK: ESTABLISHED, SYN: SYN_RECEIVED, CLOSE: CLOSED, TIMEOUT: CLOSED, RST: CLOSED},
+	SYN_RECEIVED: {ACK: ESTABLISHED, FIN: CLOSE_WAIT, FIN_ACK: CLOSE_WAIT, CLOSE: FIN_WAIT_1, TIMEOUT: CLOSED},
+	ESTABLISHED:  {FIN: CLOSE_WAIT, FIN_ACK: CLOSE_WAIT, CLOSE: FIN_WAIT_1, TIMEOUT: CLOSED, RST: CLOSED},
+	FIN_WAIT_1:   {FIN: CLOSING, ACK: FIN_WAIT_2, FIN_ACK: TIME_WAIT, TIMEOUT: CLOSED, RST: CLOSED},
+	FIN_WAIT_2:   {FIN: TIME_WAIT, FIN_ACK: TIME_WAIT, TIMEOUT: CLOSED, RST: CLOSED},
+	CLOSE_WAIT:   {CLOSE: LAST_ACK, FIN: CLOSE_WAIT, TIMEOUT: CLOSED, RST: CLOSED},
+	CLOSING:      {ACK: TIME_WAIT, FIN_ACK: TIME_WAIT, FIN: CLOSING, TIMEOUT: CLOSED, RST: CLOSED},
+	LAST_ACK:     {ACK: CLOSED, FIN_ACK: CLOSED, FIN: LAST_ACK, TIMEOUT: CLOSED, RST: CLOSED},
+	TIME_WAIT:    {TIMEOUT: CLOSED, FIN: TIME_WAIT, RST: CLOSED},
+}
+
+func TestTransitionTable_RFC9293AllPairs(t *testing.T) {
+	table := DefaultTransitionTable()
+	if got := len(table.States()); got != len(rfc9293Legal) {
+		t.Fatalf("len(States()) = %d, want %d", got, len(rfc9293Legal))
+	}
+
+	for _, origin := range []Origin{OriginActive, OriginPassive} {
+		for _, state := range table.States() {
+			for event := PASSIVE_OPEN; event <= SEND; event++ {
+				want, ok := rfc9293Legal[state][event]
+				if state == SYN_RECEIVED && event == RST {
+					want, ok = CLOSED, true
+					if origin == OriginPassive {
+						want = LISTEN
+					}
+				}
+
+				step, err := table.resolve(state, event, origin, nil)
+				if !ok {
+					if !errors.Is(err, ErrInvalidTransition) {
+						t.Errorf("%s: %s on %s = %s, want ErrInvalidTransition", origin, state, event, step.row.To)
+					}
+					continue
+				}
+				if err != nil || step.row.To != want {
+					t.Errorf("%s: %s on %s = %s, %v; want %s", origin, state, event, step.row.To, err, want)
+				}
+			}
+		}
+	}
+}
+
+func TestTCPStateMachine_Origin(t *testing.T) {
+	// Пассивное открытие возвращается в LISTEN после RST
+	sm := NewTCPStateMachine()
+	sm.ProcessEvent(PASSIVE_OPEN)
+	sm.ProcessEvent(SYN)
+	if sm.Origin() != OriginPassive {
+		t.Errorf("Origin() = %s, want PASSIVE", sm.Origin())
+	}
+	if err := sm.ProcessEvent(RST); err != nil || sm.GetState() != LISTEN {
+		t.Errorf("RST in passive SYN_RECEIVED: state %s, err %v; want LISTEN", sm.GetState(), err)
+	}
+
+	// SEND из LISTEN превращает открытие в активное
+	if err := sm.ProcessEvent(SEND); err != nil || sm.GetState() != SYN_SENT {
+		t.Fatalf("SEND in LISTEN: state %s, err %v; want SYN_SENT", sm.GetState(), err)
+	}
+	if sm.Origin() != OriginActive {
+		t.Errorf("Origin() after SEND = %s, want ACTIVE", sm.Origin())
+	}
+
+	// Одновременное открытие: RST из SYN_RECEIVED закрывает соединение
+	sm.ProcessEvent(SYN)
+	if err := sm.ProcessEvent(RST); err != nil || sm.GetState() != CLOSED {
+		t.Errorf("RST in active SYN_RECEIVED: state %s, err %v; want CLOSED", sm.GetState(), err)
+	}
+	if sm.Origin() != OriginNone {
+		t.Errorf("Origin() after CLOSED = %s, want NONE", sm.Origin())
+	}
+}
+
+func TestTCPStateMachine_RSTIgnoredWhenUnsynchronized(t *testing.T) {
+	sm := NewTCPStateMachine()
+	if err := sm.ProcessEvent(RST); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("RST in CLOSED = %v, want ErrInvalidTransition", err)
+	}
+
+	sm.ProcessEvent(PASSIVE_OPEN)
+	if err := sm.ProcessEvent(RST); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("RST in LISTEN = %v, want ErrInvalidTransition", err)
+	}
+	if sm.GetState() != LISTEN {
+		t.Errorf("GetState() = %s, want LISTEN", sm.GetState())
+	}
+}
+
+func TestTCPStateMachine_SimultaneousOpen(t *testing.T) {
+	sm := NewTCPStateMachine()
+	for _, e := range []TCPEvent{ACTIVE_OPEN, SYN, ACK} {
+		if err := sm.ProcessEvent(e); err != nil {
+			t.Fatalf("ProcessEvent(%s) error = %v", e, err)
+		}
+	}
+	if sm.GetState() != ESTABLISHED {
+		t.Errorf("GetState() = %s, want ESTABLISHED", sm.GetState())
+	}
+}
+
+func TestTransitionTable_Guard(t *testing.T) {
+	table := NewTransitionTable("guarded", CLOSED).Add(
+		Transition{From: CLOSED, Event: ACTIVE_OPEN, To: SYN_SENT, Guard: func(ctx TransitionContext) bool {
+			return ctx.Value == "client"
+		}},
+		Transition{From: CLOSED, Event: ACTIVE_OPEN, To: LISTEN, Guard: func(ctx TransitionContext) bool {
+			return ctx.Value == "server"
+		}},
+	)
+
+	sm := NewTCPStateMachineFromTable(table)
+	err := sm.ProcessEvent(ACTIVE_OPEN)
+	if !errors.Is(err, ErrTransitionRejected) || !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("ProcessEvent() = %v, want ErrTransitionRejected", err)
+	}
+
+	sm.SetValue("server")
+	if err := sm.ProcessEvent(ACTIVE_OPEN); err != nil {
+		t.Fatalf("ProcessEvent() error = %v", err)
+	}
+	if sm.GetState() != LISTEN {
+		t.Errorf("GetState() = %v, want LISTEN", sm.GetState())
+	}
+}
+
+func TestTransitionTable_Actions(t *testing.T) {
+	var calls []string
+	record := func(name string) Action {
+		return func(ctx TransitionContext) {
+			calls = append(calls, name+":"+ctx.From.String()+"->"+ctx.To.String())
+		}
+	}
+
+	table := DefaultTransitionTable().
+		OnExit(CLOSED, record("exit")).
+		OnEnter(SYN_SENT, record("enter"))
+	table.Add(Transition{From: SYN_SENT, Event: FIN, To: CLOSED, Action: record("action")})
+	table.OnExit(SYN_SENT, record("exit"))
+
+	sm := NewTCPStateMachineFromTable(table)
+	sm.ProcessEvent(ACTIVE_OPEN)
+	sm.ProcessEvent(FIN)
+
+	want := []string{
+		"exit:CLOSED->SYN_SENT",
+		"enter:CLOSED->SYN_SENT",
+		"exit:SYN_SENT->CLOSED",
+		"action:SYN_SENT->CLOSED",
+	}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+
+	// Изменения копии не затрагивают машину по умолчанию
+	if err := NewTCPStateMachine().ProcessEvent(FIN); err == nil {
+		t.Error("default machine accepted a transition added to a copy")
+	}
+}
+
+func TestTransitionTable_RegistryIsolated(t *testing.T) {
+	extra := Transition{From: ESTABLISHED, Event: SEND, To: CLOSED}
+
+	// Копии из реестра и из машины не меняют машину по умолчанию
+	table, ok := LookupMachine(DefaultMachine)
+	if !ok {
+		t.Fatal("LookupMachine(DefaultMachine) not found")
+	}
+	table.Add(extra)
+	NewTCPStateMachine().Table().Add(extra)
+
+	for _, newMachine := range []func() *TCPStateMachine{
+		NewTCPStateMachine,
+		func() *TCPStateMachine { sm, _ := NewStateMachine(DefaultMachine); return sm },
+	} {
+		sm := newMachine()
+		sm.ProcessEvent(ACTIVE_OPEN)
+		sm.ProcessEvent(SYN_ACK)
+		if err := sm.ProcessEvent(SEND); err == nil {
+			t.Error("registered machine accepted a transition added to a copy")
+		}
+	}
+
+	// Изменения исходной таблицы после регистрации не видны реестру
+	custom := newQUICTable("quic-isolated")
+	if err := RegisterMachine(custom); err != nil {
+		t.Fatalf("RegisterMachine() error = %v", err)
+	}
+	custom.Add(Transition{From: quicIdle, Event: quicClose, To: quicDraining})
+	sm, _ := NewStateMachine("quic-isolated")
+	if err := sm.ProcessEvent(quicClose); err == nil {
+		t.Error("registered machine accepted a transition added after registration")
+	}
+}
+
+func TestTransitionTable_CustomMachine(t *testing.T) {
+	table := newQUICTable("quic-test")
+	if err := RegisterMachine(table); err != nil {
+		t.Fatalf("RegisterMachine() error = %v", err)
+	}
+	if err := RegisterMachine(newQUICTable("quic-test")); !errors.Is(err, ErrMachineExists) {
+		t.Errorf("second RegisterMachine() = %v, want ErrMachineExists", err)
+	}
+	if _, err := NewStateMachine("sctp-missing"); !errors.Is(err, ErrUnknownMachine) {
+		t.Errorf("NewStateMachine(unknown) = %v, want ErrUnknownMachine", err)
+	}
+
+	names := RegisteredMachines()
+	if !strings.Contains(strings.Join(names, ","), DefaultMachine) {
+		t.Errorf("RegisteredMachines() = %v, want %s", names, DefaultMachine)
+	}
+
+	sm, err := NewStateMachine("quic-test")
+	if err != nil {
+		t.Fatalf("NewStateMachine() error = %v", err)
+	}
+	if sm.GetState() != quicIdle {
+		t.Fatalf("GetState() = %v, want IDLE", sm.GetState())
+	}
+	for _, e := range []TCPEvent{quicStart, quicHandshakeDone, quicClose} {
+		if err := sm.ProcessEvent(e); err != nil {
+			t.Fatalf("ProcessEvent(%s) error = %v", table.EventName(e), err)
+		}
+	}
+	if sm.GetState() != quicDraining {
+		t.Errorf("GetState() = %s, want DRAINING", table.StateName(sm.GetState()))
+	}
+
+	err = sm.ProcessEvent(quicStart)
+	if err == nil || !strings.Contains(err.Error(), "from DRAINING on event START") {
+		t.Errorf("ProcessEvent(START) = %v, want named invalid transition", err)
+	}
+
+	if err := sm.ProcessEvent(quicIdleTimeout); err != nil || sm.GetState() != quicIdle {
+		t.Errorf("wildcard IDLE_TIMEOUT: state %s, err %v", table.StateName(sm.GetState()), err)
+	}
+
+	sm.ProcessEvent(quicStart)
+	sm.Reset()
+	if sm.GetState() != quicIdle {
+		t.Errorf("Reset() state = %s, want IDLE", table.StateName(sm.GetState()))
+	}
+}
+
+func TestTransitionTable_Export(t *testing.T) {
+	table := DefaultTransitionTable()
+
+	rows := table.Transitions()
+	legal := 2 // две строки RST из SYN_RECEIVED
+	for _, events := range rfc9293Legal {
+		legal += len(events)
+	}
+	if len(rows) != legal {
+		t.Errorf("len(Transitions()) = %d, want %d", len(rows), legal)
+	}
+	rows[0].To = ESTABLISHED
+	if table.Transitions()[0].To != LISTEN {
+		t.Error("Transitions() returned the table's own slice")
+	}
+
+	if got := len(table.States()); got != 11 {
+		t.Errorf("len(States()) = %d, want 11", got)
+	}
+	if got := len(table.Events()); got != 11 {
+		t.Errorf("len(Events()) = %d, want 11", got)
+	}
+
+	var b strings.Builder
+	if err := table.WriteMarkdown(&b); err != nil {
+		t.Fatalf("WriteMarkdown() error = %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"| From | Event | To | Guard | Description |",
+		"| SYN_RECEIVED | RST | LISTEN | yes | reset of passive open, back to listen |",
+		"| TIME_WAIT | TIMEOUT | CLOSED |  | 2MSL timeout |",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WriteMarkdown() missing %q", want)
+		}
+	}
+}